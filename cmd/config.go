@@ -20,6 +20,15 @@ type Generate struct {
 	SchemaName   string             `yaml:"schemaName"`
 	Resolvers    []ResolverGenerate `yaml:"resolvers"`
 	Postgres     []PostgresGenerate `yaml:"postgres"`
+	Policies     PolicyGenerate     `yaml:"policies"`
+}
+
+// PolicyGenerate Where to read the GraphQL schema from, and where to create
+// OPA policy skeletons for it
+type PolicyGenerate struct {
+	Skip   bool     `yaml:"skip"`   // Don't generate any policy files
+	Schema []string `yaml:"schema"` // Schema files to read.  Defaults to schema.graphql
+	Folder string   `yaml:"folder"` // Defaults to policies/bundle/api
 }
 
 // ResolverGenerate Which resolver related things to generate code for
@@ -61,6 +61,13 @@ var genCmd = cli.Command{
 		tasks = append(tasks, Task{Folder: "resolvers", Build: resolverBuild})
 		generateFiles(ctx, config, tasks)
 
+		// Create any missing policies for the schema.  Failing to do so
+		// shouldn't stop the GraphQL code being generated:
+		err = policyBuild(config)
+		if err != nil {
+			log.Printf("WARNING: Could not create policies: %s", err)
+		}
+
 		// Recreate GraphQL Code
 		_ = generateGQL(ctx)
 	},
@@ -458,6 +465,7 @@ import (
 	"{{.Config.PackageName}}/loader"
 	"{{.Config.PackageName}}/models"
 	"{{.Config.PackageName}}/gnorm/dbl"
+	"github.com/episub/spawn/middleware"
 	"github.com/episub/spawn/opa"
 	opentracing "github.com/opentracing/opentracing-go"
 )
@@ -467,6 +475,9 @@ import (
 var {{.}}Input = func(ctx context.Context, input map[string]interface{}, i models.{{.}}) error {
 	input["{{camel .}}"] = i
 	input["user"] = GetUserFromContext(ctx)
+	if actor, ok := middleware.ActorFromContext(ctx); ok {
+		input["actor"] = actor
+	}
 
 	return nil
 }
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/episub/spawn/opa"
+	"github.com/urfave/cli"
+)
+
+var policyCmd = cli.Command{
+	Name:  "policy",
+	Usage: "work with OPA policies",
+	Subcommands: []cli.Command{
+		policyTestCmd,
+	},
+}
+
+var policyTestCmd = cli.Command{
+	Name:  "test",
+	Usage: "run rego tests and replay recorded fixtures against the policy bundle",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "bundle", Usage: "the policy bundle to test", Value: "policies/bundle"},
+		cli.StringFlag{Name: "fixtures", Usage: "folder of recorded request inputs to replay", Value: "policies/fixtures"},
+		cli.BoolFlag{Name: "verbose, v", Usage: "print passing tests as well as failures"},
+		cli.StringFlag{Name: "folder", Usage: "where the project is"},
+	},
+	Action: func(ctx *cli.Context) {
+		if len(ctx.String("folder")) > 0 {
+			err := os.Chdir(ctx.String("folder"))
+			if err != nil {
+				exit(err)
+			}
+		}
+
+		// Fixtures are optional, so ignore the folder if it hasn't been created:
+		fixtures := ctx.String("fixtures")
+		if _, err := os.Stat(fixtures); os.IsNotExist(err) {
+			fixtures = ""
+		}
+
+		report, err := opa.RunTests(context.Background(), ctx.String("bundle"), fixtures)
+		if err != nil {
+			exit(err)
+		}
+
+		for _, r := range report.Results {
+			switch {
+			case !r.Passed:
+				fmt.Printf("FAIL: %s (%s): %s\n", r.Name, r.Duration, r.Error)
+			case ctx.Bool("verbose"):
+				fmt.Printf("PASS: %s (%s)\n", r.Name, r.Duration)
+			}
+		}
+
+		fmt.Println("\nCoverage:")
+		for _, c := range report.Coverage {
+			fmt.Printf("  %6.1f%%  %s\n", c.Coverage, c.Rule)
+		}
+
+		failed := report.Failed()
+		fmt.Printf("\nPASS: %d/%d\n", len(report.Results)-failed, len(report.Results))
+
+		if failed > 0 {
+			exit(fmt.Errorf("%d policy test(s) failed", failed))
+		}
+	},
+}
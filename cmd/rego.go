@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"text/template"
+
+	"github.com/episub/spawn/middleware"
+	"github.com/vektah/gqlparser"
+	"github.com/vektah/gqlparser/ast"
+)
+
+var regoQueryTemplate *template.Template
+var regoMutationTemplate *template.Template
+var regoEntityTemplate *template.Template
+
+// regoKeywords Names that cannot be used as-is in a rego package path
+var regoKeywords = map[string]bool{
+	"as":      true,
+	"default": true,
+	"else":    true,
+	"false":   true,
+	"import":  true,
+	"not":     true,
+	"null":    true,
+	"package": true,
+	"some":    true,
+	"true":    true,
+	"with":    true,
+}
+
+// regoPolicy Values passed to the rego templates
+type regoPolicy struct {
+	Package string
+	Name    string
+	Fields  []string
+}
+
+// policyBuild Creates a policy for each query, mutation and object type in
+// the schema, matching the paths checked by ResolverMiddleware.  Existing
+// files are never overwritten
+func policyBuild(config Config) error {
+	if config.Generate.Policies.Skip {
+		return nil
+	}
+
+	files := config.Generate.Policies.Schema
+	if len(files) == 0 {
+		files = []string{"schema.graphql"}
+	}
+
+	folder := config.Generate.Policies.Folder
+	if len(folder) == 0 {
+		folder = "policies/bundle/api"
+	}
+
+	var sources []*ast.Source
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if os.IsNotExist(err) {
+			log.Printf("WARNING: Not creating policies, since schema %s was not found", f)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		sources = append(sources, &ast.Source{Name: f, Input: string(b)})
+	}
+
+	schema, gerr := gqlparser.LoadSchema(sources...)
+	if gerr != nil {
+		return gerr
+	}
+
+	if schema.Query != nil {
+		for _, f := range schema.Query.Fields {
+			if isIntrospection(f.Name) {
+				continue
+			}
+			err := createPolicy(regoQueryTemplate, folder, "query", f.Name, regoPolicy{Name: f.Name})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if schema.Mutation != nil {
+		for _, f := range schema.Mutation.Fields {
+			err := createPolicy(regoMutationTemplate, folder, "mutation", f.Name, regoPolicy{Name: f.Name})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, d := range schema.Types {
+		// Mutation and subscription fields are never checked against an
+		// entity policy:
+		if d.Kind != ast.Object || d.BuiltIn || isIntrospection(d.Name) || d == schema.Mutation || d == schema.Subscription {
+			continue
+		}
+
+		var fields []string
+		for _, f := range d.Fields {
+			if !isIntrospection(f.Name) {
+				fields = append(fields, f.Name)
+			}
+		}
+
+		err := createPolicy(regoEntityTemplate, folder, "entity", middleware.EntityPolicyName(d.Name), regoPolicy{Name: d.Name, Fields: fields})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createPolicy Writes the policy to folder/prefix/name.rego, unless that file
+// already exists
+func createPolicy(t *template.Template, folder string, prefix string, name string, p regoPolicy) error {
+	fileName := path.Join(folder, prefix, name+".rego")
+
+	_, err := os.Stat(fileName)
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	err = os.MkdirAll(path.Dir(fileName), 0755)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Creating policy %s", fileName)
+
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	p.Package = regoPackage("api", prefix, name)
+
+	return t.Execute(f, p)
+}
+
+// regoPackage Joins the parts into a rego package path, quoting any that are
+// keywords
+func regoPackage(parts ...string) string {
+	var pkg string
+	for i, p := range parts {
+		switch {
+		case regoKeywords[p]:
+			pkg += fmt.Sprintf("[%q]", p)
+		case i > 0:
+			pkg += "." + p
+		default:
+			pkg += p
+		}
+	}
+
+	return pkg
+}
+
+// isIntrospection Returns true for GraphQL's reserved __ names
+func isIntrospection(name string) bool {
+	return len(name) > 1 && name[:2] == "__"
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+)
+
+const testSchema = `
+type Query {
+	todos: [Todo!]!
+}
+
+type Mutation {
+	createTodo(title: String!): Todo
+}
+
+type Todo {
+	todoID: ID!
+	title: String!
+}
+
+type APIKey {
+	id: ID!
+}
+`
+
+func TestRegoPackage(t *testing.T) {
+	var tests = []struct {
+		Name    string
+		Parts   []string
+		Package string
+	}{
+		{"Query", []string{"api", "query", "todos"}, "api.query.todos"},
+		{"Keyword", []string{"api", "mutation", "default"}, `api.mutation["default"]`},
+	}
+
+	for _, test := range tests {
+		if p := regoPackage(test.Parts...); p != test.Package {
+			t.Errorf("%s: Expected '%s', but was '%s'", test.Name, test.Package, p)
+		}
+	}
+}
+
+func TestPolicyBuild(t *testing.T) {
+	loadTemplates()
+
+	dir, err := ioutil.TempDir("", "spawn-policies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	schema := path.Join(dir, "schema.graphql")
+	err = ioutil.WriteFile(schema, []byte(testSchema), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var config Config
+	config.Generate.Policies.Schema = []string{schema}
+	config.Generate.Policies.Folder = path.Join(dir, "api")
+
+	// An existing policy is left alone:
+	existing := "package api.query.todos\n\naccess = true\n"
+	err = os.MkdirAll(path.Join(dir, "api", "query"), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(path.Join(dir, "api", "query", "todos.rego"), []byte(existing), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = policyBuild(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		File     string
+		Package  string
+		Contains string
+	}{
+		{"query/todos.rego", "data.api.query.todos", "access = true"},
+		{"mutation/createTodo.rego", "data.api.mutation.createTodo", "default allow = false"},
+		{"entity/todo.rego", "data.api.entity.todo", `"title"`},
+		{"entity/aPIKey.rego", "data.api.entity.aPIKey", `"id"`},
+	}
+
+	for _, test := range tests {
+		b, err := ioutil.ReadFile(path.Join(dir, "api", test.File))
+		if err != nil {
+			t.Errorf("%s: %s", test.File, err)
+			continue
+		}
+
+		module, err := ast.ParseModule(test.File, string(b))
+		if err != nil {
+			t.Errorf("%s: Expected valid rego, but had error %s", test.File, err)
+			continue
+		}
+
+		if p := module.Package.Path.String(); p != test.Package {
+			t.Errorf("%s: Expected package %s, but was %s", test.File, test.Package, p)
+		}
+
+		if !strings.Contains(string(b), test.Contains) {
+			t.Errorf("%s: Expected to contain %s, but was:\n%s", test.File, test.Contains, b)
+		}
+	}
+}
+
+func TestPolicyBuildWithoutSchema(t *testing.T) {
+	loadTemplates()
+
+	dir, err := ioutil.TempDir("", "spawn-policies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var config Config
+	config.Generate.Policies.Schema = []string{path.Join(dir, "schema.graphql")}
+	config.Generate.Policies.Folder = path.Join(dir, "api")
+
+	err = policyBuild(config)
+	if err != nil {
+		t.Errorf("Expected missing schema to be skipped, but had error %s", err)
+	}
+
+	if _, err := os.Stat(config.Generate.Policies.Folder); !os.IsNotExist(err) {
+		t.Errorf("Expected no policies created")
+	}
+}
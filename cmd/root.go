@@ -34,6 +34,7 @@ func Execute() {
 	app.Commands = []cli.Command{
 		genCmd,
 		initCmd,
+		policyCmd,
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -48,6 +49,9 @@ func loadTemplates() {
 	filterTemplate = loadTemplateFromFile("models/filter.gotmpl")
 	postgresTemplate = loadTemplateFromFile("loader/gen.gotmpl")
 	resolverTemplate = loadTemplateFromFile("resolvers/gen.gotmpl")
+	regoQueryTemplate = loadTemplateFromFile("rego/query.gotmpl")
+	regoMutationTemplate = loadTemplateFromFile("rego/mutation.gotmpl")
+	regoEntityTemplate = loadTemplateFromFile("rego/entity.gotmpl")
 }
 
 // loadTemplateFromFile Loads template from the package's local directory, under static folder
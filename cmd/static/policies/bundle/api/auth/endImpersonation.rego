@@ -0,0 +1,5 @@
+package api.auth.endImpersonation
+
+# Anyone impersonating may stop.  The handler has already checked that the
+# actor is impersonating someone
+default allow = true
@@ -0,0 +1,9 @@
+package api.auth.impersonate
+
+# Deny by default.  E.g., to let support staff impersonate customers:
+#
+# allow {
+#   input.actor.role == "support"
+#   input.user.role == "customer"
+# }
+default allow = false
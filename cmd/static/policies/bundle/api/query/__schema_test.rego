@@ -0,0 +1,9 @@
+package api.query.__schema
+
+test_access {
+	access
+}
+
+test_allow {
+	allow
+}
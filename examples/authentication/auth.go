@@ -4,11 +4,11 @@ import (
 	"context"
 	"fmt"
 	"strconv"
-	"strings"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/episub/spawn/middleware"
+	"github.com/episub/spawn/sanitise"
 	"github.com/episub/spawn/security"
 	"github.com/example/todo/gnorm/public/session"
 	"github.com/example/todo/gnorm/public/user"
@@ -66,9 +66,9 @@ func authenticateUser(ctx context.Context, username string, password string) (mi
 		return User{}, fmt.Errorf("Must provide both username and password")
 	}
 
-	// Usernames should be stored in database in lower case so that we don't
-	// differentiate between coolcat and CoolCat
-	username = strings.ToLower(username)
+	// Usernames are stored in a normalised form, so look them up in the same
+	// form:
+	username = sanitise.Field("User", "username", username)
 
 	user, err := loader.Loader.OneUser(ctx, []sq.Sqlizer{sq.Eq{user.UsernameCol: username}}, nil)
 
@@ -76,7 +76,24 @@ func authenticateUser(ctx context.Context, username string, password string) (mi
 		return nil, err
 	}
 
-	return User{Row: user}, security.AuthenticateUser(ctx, []byte{}, []byte(user.Password), []byte(password))
+	rehash, err := security.AuthenticatePassword(ctx, []byte{}, []byte(user.Password), []byte(password))
+	if err != nil {
+		return nil, err
+	}
+
+	// Upgrade hashes made with older algorithms or parameters while we have
+	// the password:
+	if rehash {
+		hash, err := security.Hash([]byte(password))
+		if err == nil {
+			err = loader.Loader.SetUserPassword(ctx, user.UserID, hash)
+		}
+		if err != nil {
+			log.WithField("error", err).Error("Failed to rehash password")
+		}
+	}
+
+	return User{Row: user}, nil
 }
 
 // createSession Creates a new session for user
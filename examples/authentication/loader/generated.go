@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/99designs/gqlgen/graphql"
+	"github.com/episub/spawn/validate"
 	"github.com/vektah/gqlparser/gqlerror"
 )
 
@@ -18,8 +19,17 @@ func runBatchLoaders() {
 	log.Printf("...done")
 }
 
+// init Makes each model available to policies through spawn.load, e.g.,
+// spawn.load("user", input.entity.userID).  Only models with a query and an
+// int, string or uuid.UUID primary key are supported
+func init() {
+}
+
 // updatePath Used to keep track of nested field name in create or update actions.  E.g., address in a client update should be something like, client.person.address.address1.  This allows us to send back informative errors to the client so they can track which field exactly an error relates to
-const updatePath = "updatePath"
+const updatePath = contextKey("updatePath")
+
+// contextKey Type for keys of values this package stores in context
+type contextKey string
 
 // getPath Returns the path for the given field, so that we can nest validation error fields.  E.g., return client.person.email instead of just email
 func getPath(ctx context.Context, field string) string {
@@ -62,6 +72,15 @@ func addPathToContext(ctx context.Context, path string) context.Context {
 	return context.WithValue(ctx, updatePath, append(p, path))
 }
 
+// validateStruct Validates v according to its validate tags, nesting error
+// fields under the current update path, e.g., client.person.email.  Call from
+// validation hooks with structs that have json and validate tags
+func validateStruct(ctx context.Context, v interface{}) bool {
+	p, _ := ctx.Value(updatePath).([]string)
+
+	return validate.Struct(ctx, strings.Join(p, "."), v)
+}
+
 // Returns true if there's any graphql errors.  If 'top' is set to true, it only returns such errors if this is the top path
 func hasGQLErrors(ctx context.Context, top bool) bool {
 	// We don't care about 'ok' value because if it's not set, we can assume path is top level
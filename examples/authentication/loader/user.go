@@ -3,9 +3,32 @@ package loader
 import (
 	"context"
 
+	sq "github.com/Masterminds/squirrel"
+	"github.com/episub/spawn/sanitise"
 	"github.com/example/todo/gnorm/public/user"
 )
 
+// init Usernames are stored in a normalised form, so that we don't
+// differentiate between coolcat and CoolCat, or between forms of the same
+// Unicode characters
+func init() {
+	sanitise.Register("User", sanitise.Fields{
+		"username": sanitise.Identifier,
+	})
+}
+
+// SetUserPassword Replaces the user's password hash
+func (l *PostgresLoader) SetUserPassword(ctx context.Context, userID int, hash []byte) error {
+	_, err := user.Update(
+		ctx,
+		l.pool,
+		map[string]interface{}{user.PasswordCol: hash},
+		[]sq.Sqlizer{sq.Eq{user.UserIDCol: userID}},
+	)
+
+	return sanitiseError(err)
+}
+
 func hydrateModelUser(ctx context.Context, i user.Row) (o user.Row) {
 	return i
 }
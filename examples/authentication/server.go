@@ -116,7 +116,7 @@ func startRouters(tracer opentracing.Tracer) {
 
 	externalRouter := newRouter(tracer)
 	externalRouter.Use(em.DefaultMW)
-	externalRouter.Get("/authenticate", auth.AuthenticationHandler)
+	externalRouter.Post("/authenticate", auth.AuthenticationHandler)
 	externalRouter.Get("/logout", auth.LogoutHandler)
 	externalRouter.Handle("/", handler.Playground("GraphQL playground", "/query"))
 	externalRouter.Route("/query", func(r chi.Router) {
@@ -0,0 +1,83 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Message An email to send
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer Delivers messages.  Projects provide their own for their mail
+// provider, or use LogMailer or FileMailer while developing locally
+type Mailer interface {
+	Send(context.Context, Message) error
+}
+
+// LogMailer Logs messages instead of sending them
+type LogMailer struct {
+	Logger *logrus.Logger
+}
+
+// Send Logs the message
+func (m LogMailer) Send(ctx context.Context, msg Message) error {
+	l := m.Logger
+	if l == nil {
+		l = logrus.StandardLogger()
+	}
+
+	l.WithFields(logrus.Fields{
+		"to":      msg.To,
+		"subject": msg.Subject,
+	}).Info(msg.Body)
+
+	return nil
+}
+
+// FileMailer Writes each message to a file in Dir instead of sending it, so
+// that links in them can be followed while developing locally
+type FileMailer struct {
+	Dir string
+}
+
+// Send Writes the message to a new .eml file in Dir
+func (m FileMailer) Send(ctx context.Context, msg Message) error {
+	err := os.MkdirAll(m.Dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), fileSafe(msg.To))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(msg.Body)
+
+	return ioutil.WriteFile(filepath.Join(m.Dir, name), []byte(b.String()), 0600)
+}
+
+// fileSafe Replaces characters that may not be valid in file names
+func fileSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '@':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
@@ -0,0 +1,309 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/episub/spawn/mail"
+	"github.com/episub/spawn/security"
+	"github.com/episub/spawn/validate"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/sirupsen/logrus"
+	"github.com/vektah/gqlparser/gqlerror"
+)
+
+const (
+	// maxAccountRequestSize Limit on the size of a reset or verification
+	// request body
+	maxAccountRequestSize = 1 << 12
+	// defaultPasswordMinLength Minimum length of new passwords, unless
+	// AccountEmails.PasswordMinLength is set
+	defaultPasswordMinLength = 8
+)
+
+// AccountEmails Functions for the password reset and email verification
+// flows, which send single-use tokens to users by email
+type AccountEmails struct {
+	// Tokens Issues and redeems the tokens sent in emails
+	Tokens *Tokens
+	// Mailer Sends the emails.  Use mail.LogMailer or mail.FileMailer while
+	// developing locally
+	Mailer mail.Mailer
+	// GetUserByEmail Returns the user with the email address, for password
+	// reset requests
+	GetUserByEmail func(context.Context, string) (User, error)
+	// SetPassword Stores the user's new password hash, from security.Hash.
+	// The hash includes its salt, so clear any separately stored salt
+	SetPassword func(ctx context.Context, user User, hash []byte) error
+	// SetEmailVerified Records that the user has verified their email
+	// address.  Delete any outstanding verification tokens when a user changes
+	// their address, so that an old token can't verify the new one
+	SetEmailVerified func(context.Context, User) error
+	// ResetMessage Returns the password reset email, which should contain a
+	// link to the project's reset page including the token
+	ResetMessage func(ctx context.Context, user User, email string, token string) mail.Message
+	// VerifyMessage Returns the verification email, which should contain a
+	// link to the project's verification page including the token
+	VerifyMessage func(ctx context.Context, user User, email string, token string) mail.Message
+	// PasswordMinLength Minimum length of new passwords.  Defaults to 8
+	PasswordMinLength uint
+	// PasswordValidator Rules new passwords must pass.  Defaults to
+	// validate.PasswordUpperLowerNumber
+	PasswordValidator *validate.PasswordValidator
+}
+
+// accountRequest Body accepted by the reset and verification handlers
+type accountRequest struct {
+	Email    string `json:"email"`
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// readAccountRequest Reads the JSON body of a reset or verification request
+func readAccountRequest(w http.ResponseWriter, r *http.Request) (accountRequest, error) {
+	var req accountRequest
+
+	if r.Method != http.MethodPost {
+		return req, fmt.Errorf("Expected POST, but was %s", r.Method)
+	}
+
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAccountRequestSize)).Decode(&req)
+	return req, err
+}
+
+// SendPasswordReset Issues a password reset token for the user and emails
+// it to them at the given address
+func (a Auth) SendPasswordReset(ctx context.Context, user User, email string) error {
+	token, err := a.AccountEmails.Tokens.Issue(ctx, user, TokenPasswordReset)
+	if err != nil {
+		return err
+	}
+
+	return a.AccountEmails.Mailer.Send(ctx, a.AccountEmails.ResetMessage(ctx, user, email, token))
+}
+
+// SendEmailVerification Issues an email verification token for the user and
+// emails it to them at the given address, e.g., after sign up or when they
+// change their address
+func (a Auth) SendEmailVerification(ctx context.Context, user User, email string) error {
+	token, err := a.AccountEmails.Tokens.Issue(ctx, user, TokenEmailVerification)
+	if err != nil {
+		return err
+	}
+
+	return a.AccountEmails.Mailer.Send(ctx, a.AccountEmails.VerifyMessage(ctx, user, email, token))
+}
+
+// RequestPasswordResetHandler Emails a password reset token to the user with
+// the address given as {"email": "..."}.  Always responds with success, so
+// that the handler can't be used to discover which addresses have accounts.
+// The user is looked up and emailed after responding, so that the response
+// takes as long either way
+func (a Auth) RequestPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	span, ctx := opentracing.StartSpanFromContext(r.Context(), "requestPasswordResetHandler")
+	defer span.Finish()
+
+	req, err := readAccountRequest(w, r)
+	email := strings.TrimSpace(req.Email)
+	if err != nil || len(email) == 0 {
+		writeStatusError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	parent := span.Context()
+	values := detachedContext{ctx}
+	sendInBackground(func() {
+		span := opentracing.StartSpan("sendPasswordReset", opentracing.FollowsFrom(parent))
+		defer span.Finish()
+
+		a.requestPasswordReset(opentracing.ContextWithSpan(values, span), email)
+	})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// requestPasswordReset Sends a password reset to the user with the address,
+// if they have an active account
+func (a Auth) requestPasswordReset(ctx context.Context, email string) {
+	user, err := a.AccountEmails.GetUserByEmail(ctx, email)
+	switch {
+	case err != nil:
+		log.WithField("error", err).Info("No user for password reset request")
+	case user.GetInactive():
+		log.WithField("user", user.GetID()).Info("Password reset requested for inactive user")
+	default:
+		err = a.SendPasswordReset(ctx, user, email)
+		if err != nil {
+			log.WithFields(logrus.Fields{"error": err, "user": user.GetID()}).Error("Failed to send password reset")
+		}
+	}
+}
+
+// sendInBackground Runs f after the handler has responded.  Replaced in
+// tests, so that they can wait for it
+var sendInBackground = func(f func()) {
+	go f()
+}
+
+// detachedContext Keeps the values of a request's context, such as its
+// locale, for work done after responding, but isn't cancelled when the
+// request ends
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// ResetPasswordHandler Sets a new password given {"token": "...",
+// "password": "..."}, with a token from RequestPasswordResetHandler.  The
+// password must pass AccountEmails.PasswordValidator.  The user's other reset
+// tokens and all of their existing sessions are destroyed, so
+// Tokens.DeleteTokens and Auth.DestroyAllSessions must be set
+func (a Auth) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	span, ctx := opentracing.StartSpanFromContext(r.Context(), "resetPasswordHandler")
+	defer span.Finish()
+
+	// Refuse before changing anything, rather than leave old sessions or
+	// tokens valid after the reset:
+	if a.DestroyAllSessions == nil || a.AccountEmails.Tokens.DeleteTokens == nil {
+		log.Error("Auth.DestroyAllSessions and Tokens.DeleteTokens must be set to reset passwords")
+		writeStatusError(w, http.StatusInternalServerError, "Could not reset password")
+		return
+	}
+
+	req, err := readAccountRequest(w, r)
+	if err != nil {
+		writeStatusError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	// Check the password before redeeming, so that a rejected password
+	// doesn't use up the token:
+	vctx := validate.WithLocale(validate.SetContext(ctx), validate.MatchLocale(r.Header.Get("Accept-Language")))
+	if !a.validNewPassword(vctx, req.Password) {
+		writeValidationErrors(vctx, w)
+		return
+	}
+
+	user, err := a.AccountEmails.Tokens.Redeem(ctx, TokenPasswordReset, req.Token)
+	if err == nil && user.GetInactive() {
+		err = ErrInvalidAccountToken
+	}
+	if err != nil {
+		log.WithField("error", err).Info("Rejected password reset token")
+		writeStatusError(w, http.StatusBadRequest, getSafeError(err, ErrInvalidAccountToken.Error()))
+		return
+	}
+
+	fields := logrus.Fields{"user": user.GetID()}
+
+	// Other reset links sent to the user must not work once this one has:
+	err = a.AccountEmails.Tokens.RevokeAll(ctx, user, TokenPasswordReset)
+	if err != nil {
+		log.WithFields(fields).WithField("error", err).Error("Failed to delete password reset tokens")
+		writeStatusError(w, http.StatusInternalServerError, "Could not reset password")
+		return
+	}
+
+	hash, err := security.Hash([]byte(req.Password))
+	if err != nil {
+		log.WithFields(fields).WithField("error", err).Error("Failed to hash password")
+		writeStatusError(w, http.StatusInternalServerError, "Could not reset password")
+		return
+	}
+
+	err = a.AccountEmails.SetPassword(ctx, user, hash)
+	if err != nil {
+		log.WithFields(fields).WithField("error", err).Error("Failed to set password")
+		writeStatusError(w, http.StatusInternalServerError, "Could not reset password")
+		return
+	}
+
+	log.WithFields(fields).Info("Password reset")
+
+	// Anyone who knew the old password may still be logged in:
+	err = a.LogoutEverywhere(ctx, user)
+	if err != nil {
+		log.WithFields(fields).WithField("error", err).Error("Failed to destroy sessions after password reset")
+		writeStatusError(w, http.StatusInternalServerError, "Password reset, but could not log out existing sessions")
+		return
+	}
+
+	a.logout(w, r)
+	w.WriteHeader(http.StatusOK)
+}
+
+// VerifyEmailHandler Marks the user's email address as verified, given
+// {"token": "..."} with a token from SendEmailVerification
+func (a Auth) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	span, ctx := opentracing.StartSpanFromContext(r.Context(), "verifyEmailHandler")
+	defer span.Finish()
+
+	req, err := readAccountRequest(w, r)
+	if err != nil {
+		writeStatusError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	user, err := a.AccountEmails.Tokens.Redeem(ctx, TokenEmailVerification, req.Token)
+	if err != nil {
+		log.WithField("error", err).Info("Rejected email verification token")
+		writeStatusError(w, http.StatusBadRequest, getSafeError(err, ErrInvalidAccountToken.Error()))
+		return
+	}
+
+	err = a.AccountEmails.SetEmailVerified(ctx, user)
+	if err != nil {
+		log.WithFields(logrus.Fields{"error": err, "user": user.GetID()}).Error("Failed to set email verified")
+		writeStatusError(w, http.StatusInternalServerError, "Could not verify email")
+		return
+	}
+
+	log.WithField("user", user.GetID()).Info("Email verified")
+	w.WriteHeader(http.StatusOK)
+}
+
+// validNewPassword Returns true if the password passes the configured rules,
+// adding validation errors to ctx otherwise
+func (a Auth) validNewPassword(ctx context.Context, password string) bool {
+	minLength := a.AccountEmails.PasswordMinLength
+	if minLength == 0 {
+		minLength = defaultPasswordMinLength
+	}
+
+	validator := validate.PasswordUpperLowerNumber
+	if a.AccountEmails.PasswordValidator != nil {
+		validator = *a.AccountEmails.PasswordValidator
+	}
+
+	return validate.Password(ctx, password, minLength, validator, "password")
+}
+
+// writeValidationErrors Writes a 400 response with the first validation
+// error in ctx as a gqlerror, including its field, code and params.  The code
+// is the validation code, e.g., LENGTH_MIN, not the HTTP status
+func writeValidationErrors(ctx context.Context, w http.ResponseWriter) {
+	errs := validate.ListErrors(ctx)
+	if len(errs) == 0 {
+		writeStatusError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	b, err := json.Marshal(gqlerror.Error{
+		Message:    errs[0].Message,
+		Extensions: errs[0].Extensions(),
+	})
+	if err != nil {
+		log.WithField("error", err).Error("Could not json encode error message")
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(b)
+}
@@ -0,0 +1,316 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/episub/spawn/mail"
+	"github.com/episub/spawn/validate"
+)
+
+type testMailer struct {
+	sent []mail.Message
+}
+
+func (m *testMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// last Returns the body of the last message sent, which is the token
+func (m *testMailer) last() string {
+	if len(m.sent) == 0 {
+		return ""
+	}
+
+	return m.sent[len(m.sent)-1].Body
+}
+
+type testToken struct {
+	user    User
+	purpose TokenPurpose
+	expiry  time.Time
+}
+
+// accountsTest Records what the account handlers store
+type accountsTest struct {
+	mailer    *testMailer
+	tokens    map[string]testToken
+	passwords map[string][]byte
+	verified  map[string]bool
+	loggedOut map[string]bool
+}
+
+// newAccountsTest Returns an Auth with tokens and users kept in memory.
+// Emails contain only the token
+func newAccountsTest() (Auth, *accountsTest) {
+	at := &accountsTest{
+		mailer:    &testMailer{},
+		tokens:    make(map[string]testToken),
+		passwords: make(map[string][]byte),
+		verified:  make(map[string]bool),
+		loggedOut: make(map[string]bool),
+	}
+
+	message := func(ctx context.Context, u User, email string, token string) mail.Message {
+		return mail.Message{To: email, Body: token}
+	}
+
+	a := Auth{
+		DestroyAllSessions: func(ctx context.Context, u User) error {
+			at.loggedOut[u.GetID()] = true
+			return nil
+		},
+		AccountEmails: &AccountEmails{
+			Tokens: &Tokens{
+				SaveToken: func(ctx context.Context, u User, purpose TokenPurpose, hash string, expiry time.Time) error {
+					at.tokens[hash] = testToken{u, purpose, expiry}
+					return nil
+				},
+				ConsumeToken: func(ctx context.Context, purpose TokenPurpose, hash string) (User, time.Time, error) {
+					t, ok := at.tokens[hash]
+					if !ok || t.purpose != purpose {
+						return nil, time.Time{}, ErrInvalidAccountToken
+					}
+					delete(at.tokens, hash)
+					return t.user, t.expiry, nil
+				},
+				DeleteTokens: func(ctx context.Context, u User, purpose TokenPurpose) error {
+					for hash, t := range at.tokens {
+						if t.user.GetID() == u.GetID() && t.purpose == purpose {
+							delete(at.tokens, hash)
+						}
+					}
+					return nil
+				},
+			},
+			Mailer: at.mailer,
+			GetUserByEmail: func(ctx context.Context, email string) (User, error) {
+				if email != "user@example.com" {
+					return nil, fmt.Errorf("No user with email %s", email)
+				}
+				return testUser("42"), nil
+			},
+			SetPassword: func(ctx context.Context, u User, hash []byte) error {
+				at.passwords[u.GetID()] = hash
+				return nil
+			},
+			SetEmailVerified: func(ctx context.Context, u User) error {
+				at.verified[u.GetID()] = true
+				return nil
+			},
+			ResetMessage:  message,
+			VerifyMessage: message,
+		},
+	}
+
+	return a, at
+}
+
+// postAccount Posts the JSON body to the handler, returning the status
+func postAccount(handler http.HandlerFunc, body string) int {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	return w.Code
+}
+
+func TestRequestPasswordReset(t *testing.T) {
+	a, at := newAccountsTest()
+
+	original := sendInBackground
+	defer func() { sendInBackground = original }()
+
+	var pending []func()
+	sendInBackground = func(f func()) {
+		pending = append(pending, f)
+	}
+
+	var tests = []struct {
+		Name   string
+		Body   string
+		Status int
+		Sent   int
+	}{
+		{"Known address", `{"email":"user@example.com"}`, http.StatusOK, 1},
+		{"Unknown address", `{"email":"other@example.com"}`, http.StatusOK, 1},
+		{"No address", `{}`, http.StatusBadRequest, 1},
+	}
+
+	for _, test := range tests {
+		sent := len(at.mailer.sent)
+		status := postAccount(a.RequestPasswordResetHandler, test.Body)
+
+		// Nothing is sent until after responding:
+		if len(at.mailer.sent) != sent {
+			t.Errorf("%s: Expected email sent after responding", test.Name)
+		}
+
+		for _, f := range pending {
+			f()
+		}
+		pending = nil
+
+		if status != test.Status || len(at.mailer.sent) != test.Sent {
+			t.Errorf("%s: Expected status %d and %d sent, but was %d and %d", test.Name, test.Status, test.Sent, status, len(at.mailer.sent))
+		}
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	a, at := newAccountsTest()
+	ctx := context.Background()
+
+	if err := a.SendPasswordReset(ctx, testUser("42"), "user@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	other := at.mailer.last()
+
+	if err := a.SendPasswordReset(ctx, testUser("42"), "user@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	token := at.mailer.last()
+
+	// A rejected password doesn't use up the token:
+	if status := postAccount(a.ResetPasswordHandler, `{"token":"`+token+`","password":"weak"}`); status != http.StatusBadRequest {
+		t.Errorf("Expected weak password rejected, but was %d", status)
+	}
+
+	if status := postAccount(a.ResetPasswordHandler, `{"token":"`+token+`","password":"Correct1Horse"}`); status != http.StatusOK {
+		t.Fatalf("Expected password reset, but was %d", status)
+	}
+
+	if len(at.passwords["42"]) == 0 {
+		t.Errorf("Expected password stored")
+	}
+
+	if !at.loggedOut["42"] {
+		t.Errorf("Expected existing sessions destroyed")
+	}
+
+	var tests = []struct {
+		Name  string
+		Token string
+	}{
+		{"Used token", token},
+		{"Other reset token", other},
+		{"Unknown token", "unknown"},
+		{"No token", ""},
+	}
+
+	for _, test := range tests {
+		status := postAccount(a.ResetPasswordHandler, `{"token":"`+test.Token+`","password":"Correct1Horse"}`)
+		if status != http.StatusBadRequest {
+			t.Errorf("%s: Expected token rejected, but was %d", test.Name, status)
+		}
+	}
+}
+
+func TestResetPasswordMisconfigured(t *testing.T) {
+	withoutLogout, at := newAccountsTest()
+	withoutLogout.DestroyAllSessions = nil
+
+	withoutDelete, _ := newAccountsTest()
+	withoutDelete.AccountEmails.Tokens.DeleteTokens = nil
+
+	var tests = []struct {
+		Name string
+		Auth Auth
+	}{
+		{"Without DestroyAllSessions", withoutLogout},
+		{"Without DeleteTokens", withoutDelete},
+	}
+
+	for _, test := range tests {
+		if err := test.Auth.SendPasswordReset(context.Background(), testUser("42"), "user@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		token := test.Auth.AccountEmails.Mailer.(*testMailer).last()
+
+		status := postAccount(test.Auth.ResetPasswordHandler, `{"token":"`+token+`","password":"Correct1Horse"}`)
+		if status != http.StatusInternalServerError {
+			t.Errorf("%s: Expected error, but was %d", test.Name, status)
+		}
+	}
+
+	if len(at.passwords) != 0 {
+		t.Errorf("Expected password unchanged")
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	a, at := newAccountsTest()
+	ctx := context.Background()
+
+	if err := a.SendPasswordReset(ctx, testUser("42"), "user@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	reset := at.mailer.last()
+
+	a.AccountEmails.Tokens.Lifetimes = map[TokenPurpose]time.Duration{TokenEmailVerification: time.Nanosecond}
+	if err := a.SendEmailVerification(ctx, testUser("42"), "user@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	expired := at.mailer.last()
+	time.Sleep(time.Millisecond)
+
+	a.AccountEmails.Tokens.Lifetimes = nil
+	if err := a.SendEmailVerification(ctx, testUser("42"), "user@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	token := at.mailer.last()
+
+	var tests = []struct {
+		Name     string
+		Token    string
+		Status   int
+		Verified bool
+	}{
+		{"Reset token", reset, http.StatusBadRequest, false},
+		{"Expired", expired, http.StatusBadRequest, false},
+		{"Valid", token, http.StatusOK, true},
+		{"Used", token, http.StatusBadRequest, true},
+	}
+
+	for _, test := range tests {
+		status := postAccount(a.VerifyEmailHandler, `{"token":"`+test.Token+`"}`)
+		if status != test.Status || at.verified["42"] != test.Verified {
+			t.Errorf("%s: Expected status %d and verified %t, but was %d and %t", test.Name, test.Status, test.Verified, status, at.verified["42"])
+		}
+	}
+}
+
+func TestWriteValidationErrors(t *testing.T) {
+	ctx := validate.SetContext(context.Background())
+	validate.MinimumLength(ctx, 8, "short", "password")
+
+	w := httptest.NewRecorder()
+	writeValidationErrors(ctx, w)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected bad request, but was %d", w.Code)
+	}
+
+	var body struct {
+		Extensions map[string]interface{} `json:"extensions"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	// The code is the validation code, not the HTTP status:
+	if code, ok := body.Extensions["code"].(string); !ok || code != validate.CodeLengthMin {
+		t.Errorf("Expected code %s, but was %v", validate.CodeLengthMin, body.Extensions["code"])
+	}
+
+	if body.Extensions["field"] != "password" {
+		t.Errorf("Expected field password, but was %v", body.Extensions["field"])
+	}
+}
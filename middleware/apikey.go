@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/episub/spawn/security"
+	"github.com/episub/spawn/vars"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultAPIKeyHeader = "X-API-Key"
+	// apiKeyIDLength Number of characters of a token kept for a key's id
+	apiKeyIDLength = 9
+	// apiKeyTouchInterval Last used times are only updated this often, to
+	// avoid a write on every request
+	apiKeyTouchInterval = time.Minute
+)
+
+// APIKey A stored API key, for machine clients such as integrations and CI
+// scripts
+type APIKey interface {
+	GetID() string
+	// GetHash Returns the hash of the key's secret, from security.HashToken
+	GetHash() string
+	// GetScopes Returns the permissions granted to the key, which are passed
+	// to policies as input.scopes
+	GetScopes() []string
+	// GetUser Returns the user the key acts as
+	GetUser(context.Context) (User, error)
+	// GetExpiry Returns when the key expires, or zero if it doesn't
+	GetExpiry() time.Time
+	GetRevoked() bool
+	GetLastUsed() time.Time
+}
+
+// ErrInvalidAPIKey Key is malformed, unknown, revoked or expired
+var ErrInvalidAPIKey = SafeError("Invalid API key")
+
+func (a Auth) apiKeyHeader() string {
+	if len(a.APIKeyHeader) > 0 {
+		return a.APIKeyHeader
+	}
+
+	return defaultAPIKeyHeader
+}
+
+// NewAPIKey Creates a key acting as user with the given scopes, returning the
+// key to give to the client.  Only the hash is stored, so the key can't be
+// shown again
+func (a Auth) NewAPIKey(ctx context.Context, user User, scopes []string, expiry time.Time) (string, error) {
+	if a.CreateAPIKey == nil {
+		return "", fmt.Errorf("Auth.CreateAPIKey must be set to create API keys")
+	}
+
+	id, err := security.NewToken()
+	if err != nil {
+		return "", err
+	}
+	// Shorter ids are easier to recognise in lists of keys:
+	id = id[:apiKeyIDLength]
+
+	secret, err := security.NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = a.CreateAPIKey(ctx, user, id, security.HashToken(secret), scopes, expiry)
+	if err != nil {
+		return "", err
+	}
+
+	log.WithFields(logrus.Fields{"user": user.GetID(), "key": id}).Info("API key created")
+
+	return id + "." + secret, nil
+}
+
+// RevokeKey Revokes the key with the given ID, so that it's rejected from
+// the next request
+func (a Auth) RevokeKey(ctx context.Context, id string) error {
+	if a.RevokeAPIKey == nil {
+		return fmt.Errorf("Auth.RevokeAPIKey must be set to revoke API keys")
+	}
+
+	err := a.RevokeAPIKey(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	log.WithField("key", id).Info("API key revoked")
+
+	return nil
+}
+
+// splitAPIKey Returns the id and secret of the key
+func splitAPIKey(key string) (string, string, bool) {
+	parts := strings.SplitN(key, ".", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return "", "", false
+	}
+
+	return parts[0], parts[1], true
+}
+
+// validateAPIKey Returns the stored key if key is valid
+func (a Auth) validateAPIKey(ctx context.Context, key string) (APIKey, error) {
+	id, secret, ok := splitAPIKey(key)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	k, err := a.GetAPIKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !security.MatchToken(k.GetHash(), secret) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if k.GetRevoked() {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if expiry := k.GetExpiry(); !expiry.IsZero() && time.Now().After(expiry) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	return k, nil
+}
+
+// serveAPIKey Validates the API key, and if valid serves the request as the
+// key's user, with its scopes in the context
+func (a Auth) serveAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, key string) {
+	k, err := a.validateAPIKey(r.Context(), key)
+	if err != nil {
+		log.WithField("error", err).Info("Rejected API key")
+		a.SetUnauthorised(w, r)
+		return
+	}
+
+	user, err := k.GetUser(r.Context())
+	if err != nil {
+		log.WithFields(logrus.Fields{"error": err, "key": k.GetID()}).Warning("Could not fetch API key user")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if user.GetInactive() {
+		a.SetUnauthorised(w, r)
+		return
+	}
+
+	if a.TouchAPIKey != nil && time.Since(k.GetLastUsed()) > apiKeyTouchInterval {
+		if err := a.TouchAPIKey(r.Context(), k, time.Now()); err != nil {
+			log.WithFields(logrus.Fields{"error": err, "key": k.GetID()}).Error("Failed to update API key last used")
+		}
+	}
+
+	ctx := context.WithValue(r.Context(), vars.ScopesKey, k.GetScopes())
+	ctx = a.GetAuthenticationContext(ctx, user)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// ScopesFromContext Returns the scopes of the API key used for the request,
+// and false if the request wasn't made with an API key
+func ScopesFromContext(ctx context.Context) ([]string, bool) {
+	scopes, ok := ctx.Value(vars.ScopesKey).([]string)
+	return scopes, ok
+}
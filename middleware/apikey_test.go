@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+type testAPIKey struct {
+	id      string
+	hash    string
+	scopes  []string
+	expiry  time.Time
+	revoked bool
+}
+
+func (k *testAPIKey) GetID() string                         { return k.id }
+func (k *testAPIKey) GetHash() string                       { return k.hash }
+func (k *testAPIKey) GetScopes() []string                   { return k.scopes }
+func (k *testAPIKey) GetUser(context.Context) (User, error) { return testUser("42"), nil }
+func (k *testAPIKey) GetExpiry() time.Time                  { return k.expiry }
+func (k *testAPIKey) GetRevoked() bool                      { return k.revoked }
+func (k *testAPIKey) GetLastUsed() time.Time                { return time.Now() }
+
+// newAPIKeyTest Returns an Auth storing keys in memory
+func newAPIKeyTest() (Auth, map[string]*testAPIKey) {
+	keys := make(map[string]*testAPIKey)
+
+	return Auth{
+		GetAPIKey: func(ctx context.Context, id string) (APIKey, error) {
+			k, ok := keys[id]
+			if !ok {
+				return nil, ErrInvalidAPIKey
+			}
+			return k, nil
+		},
+		CreateAPIKey: func(ctx context.Context, user User, id string, hash string, scopes []string, expiry time.Time) error {
+			keys[id] = &testAPIKey{id: id, hash: hash, scopes: scopes, expiry: expiry}
+			return nil
+		},
+		RevokeAPIKey: func(ctx context.Context, id string) error {
+			keys[id].revoked = true
+			return nil
+		},
+	}, keys
+}
+
+func TestAPIKey(t *testing.T) {
+	a, keys := newAPIKeyTest()
+	ctx := context.Background()
+
+	key, err := a.NewAPIKey(ctx, testUser("42"), []string{"todos:read"}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, _, _ := splitAPIKey(key)
+	if len(id) != apiKeyIDLength {
+		t.Errorf("Expected id of %d characters, but was '%s'", apiKeyIDLength, id)
+	}
+
+	expired, err := a.NewAPIKey(ctx, testUser("42"), nil, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		Name  string
+		Key   string
+		Valid bool
+	}{
+		{"Valid", key, true},
+		{"Wrong secret", id + ".wrong", false},
+		{"Malformed", id, false},
+		{"Expired", expired, false},
+	}
+
+	for _, test := range tests {
+		_, err := a.validateAPIKey(ctx, test.Key)
+		if (err == nil) != test.Valid {
+			t.Errorf("%s: Expected valid %t, but had error %v", test.Name, test.Valid, err)
+		}
+	}
+
+	err = a.RevokeKey(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !keys[id].revoked {
+		t.Errorf("Expected key marked as revoked")
+	}
+
+	if _, err := a.validateAPIKey(ctx, key); err != ErrInvalidAPIKey {
+		t.Errorf("Expected revoked key to be rejected, but had error %v", err)
+	}
+
+	a.RevokeAPIKey = nil
+	if err := a.RevokeKey(ctx, id); err == nil {
+		t.Errorf("Expected error revoking without Auth.RevokeAPIKey")
+	}
+}
+
+func TestAPIKeyScopesInFieldInput(t *testing.T) {
+	a, _ := newAPIKeyTest()
+
+	key, err := a.NewAPIKey(context.Background(), testUser("42"), []string{"todos:read"}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var input map[string]interface{}
+	original := authorisedStrings
+	defer func() { authorisedStrings = original }()
+	authorisedStrings = func(ctx context.Context, policy string, data map[string]interface{}) ([]string, error) {
+		input = data
+		return []string{"title"}, nil
+	}
+
+	var allowed bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parent := fieldContext(r.Context(), "Query", "todo")
+		graphql.GetResolverContext(parent).Result = testNode{ID: "1"}
+
+		ctx := fieldContext(parent, "Todo", "title")
+		allowed, err = hasFieldAccess(ctx, "Title", func(context.Context, string, string, map[string]interface{}) error { return nil })
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(defaultAPIKeyHeader, key)
+	a.SessionMW(next).ServeHTTP(httptest.NewRecorder(), r)
+
+	if err != nil || !allowed {
+		t.Fatalf("Expected field allowed, but was %t with error %v", allowed, err)
+	}
+
+	if scopes, _ := input["scopes"].([]string); !reflect.DeepEqual(scopes, []string{"todos:read"}) {
+		t.Errorf("Expected key's scopes in field policy input, but had %v", input["scopes"])
+	}
+}
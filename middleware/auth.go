@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/episub/spawn/store"
@@ -29,6 +32,74 @@ type Auth struct {
 	CreateSession    func(context.Context, User) (string, time.Time, error)
 	Debug            bool
 	GetSession       func(context.Context, string) (Session, error)
+
+	// CookieDomain Domain attribute for the session cookie.  Empty means the
+	// cookie is only sent to the host that set it
+	CookieDomain string
+	// CookiePath Path attribute for the session cookie.  Defaults to "/"
+	CookiePath string
+	// CookieSameSite SameSite attribute for the session cookie.  Defaults to
+	// http.SameSiteLaxMode
+	CookieSameSite http.SameSite
+	// CSRF When set, CSRFMW checks cookie authenticated requests with these
+	// options
+	CSRF *CSRF
+
+	// JWT Validates bearer tokens that are JWTs.  When nil, bearer tokens are
+	// only accepted as session ids
+	JWT *JWTValidator
+	// ClaimsUser Returns the user for the claims of a validated JWT
+	ClaimsUser func(context.Context, Claims) (User, error)
+
+	// Throttle When set, AuthenticationHandler limits login attempts by
+	// username and IP
+	Throttle *Throttle
+	// SessionLifetime When set along with ExtendSession, sessions slide: each
+	// request made with less than RefreshThreshold remaining extends the
+	// session to SessionLifetime from now
+	SessionLifetime time.Duration
+	// RefreshThreshold See SessionLifetime
+	RefreshThreshold time.Duration
+	// ExtendSession Stores the requested expiry for the session, returning the
+	// expiry actually set, e.g., if the project caps the total lifetime
+	ExtendSession func(context.Context, Session, time.Time) (time.Time, error)
+	// DestroyAllSessions Destroys every session belonging to the user
+	DestroyAllSessions func(context.Context, User) error
+
+	// APIKeyHeader Header machine clients send API keys in.  Defaults to
+	// X-API-Key
+	APIKeyHeader string
+	// GetAPIKey Returns the stored key with the given ID.  When nil, API keys
+	// are not accepted
+	GetAPIKey func(context.Context, string) (APIKey, error)
+	// CreateAPIKey Stores a new key.  Only the hash of the secret is given
+	CreateAPIKey func(ctx context.Context, user User, id string, hash string, scopes []string, expiry time.Time) error
+	// RevokeAPIKey Marks the key with the given ID as revoked, so that its
+	// GetRevoked returns true
+	RevokeAPIKey func(ctx context.Context, id string) error
+	// TouchAPIKey Optional.  Records when the key was last used
+	TouchAPIKey func(context.Context, APIKey, time.Time) error
+
+	// GetUserByID Returns the user with the given ID, for impersonation
+	GetUserByID func(context.Context, string) (User, error)
+	// StartImpersonation Records on the session that its user is acting as
+	// the given user, who ImpersonatingSession should then return
+	StartImpersonation func(context.Context, Session, User) error
+	// EndImpersonation Clears any impersonation from the session
+	EndImpersonation func(context.Context, Session) error
+
+	// MFA When set, users enrolled in MFA must provide a second factor
+	// before their session is authenticated
+	MFA *MFA
+
+	// AccountEmails Required for the password reset and email verification
+	// handlers
+	AccountEmails *AccountEmails
+
+	// LegacyQueryCredentials Allows AuthenticationHandler to read credentials
+	// from the query string of a GET request.  Avoid if possible, since the
+	// password ends up in access logs and browser history
+	LegacyQueryCredentials bool
 }
 
 // User Generic user interface used by functions, allowing projects to provide
@@ -72,43 +143,32 @@ func NewAuth(
 	}
 }
 
-// SessionMW Manages cookies, and puts the user and session in the context if appropriate, and returns unauthorised if session is expired or user is inactive
+// SessionMW Manages cookies, and puts the user and session in the context if appropriate, and returns unauthorised if session is expired or user is inactive.
+// Clients without cookies may instead send an 'Authorization: Bearer' header,
+// holding either a session id or, if JWT is configured, a signed JWT.  Machine
+// clients may send an API key in the APIKeyHeader if GetAPIKey is set
 func (a Auth) SessionMW(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		c, err := r.Cookie(a.CookieName)
-		if err == nil && c != nil {
-			// Cookie found:
-			session, err := a.GetSession(r.Context(), c.Value)
-			if err != nil {
-				log.WithFields(logrus.Fields{"error": err, "session": c.Value}).Warning("Failed to fetch session from database")
-				a.SetUnauthorised(w, r)
-				return
-			}
-
-			// Invalidate if expired:
-			if time.Now().After(session.GetExpiry()) || (!c.Expires.IsZero() && time.Now().After(c.Expires)) {
-				log.WithField("session", session.GetID()).Info("Session expired")
-				a.SetUnauthorised(w, r)
-				return
-			}
+		if key := r.Header.Get(a.apiKeyHeader()); len(key) > 0 && a.GetAPIKey != nil {
+			a.serveAPIKey(w, r, next, key)
+			return
+		}
 
-			// Invalidate if user inactive
-			user, err := session.GetUser(r.Context())
-			if err != nil {
-				log.WithFields(logrus.Fields{"error": err}).Warning("Could not fetch session user")
-				w.WriteHeader(http.StatusInternalServerError)
+		if token, ok := bearerToken(r); ok {
+			if a.JWT != nil && isJWT(token) {
+				a.serveJWT(w, r, next, token)
 				return
 			}
 
-			// If inactive, don't use them:
-			if user.GetInactive() {
-				a.SetUnauthorised(w, r)
-				return
-			}
+			a.serveSession(w, r, next, token, false, false)
+			return
+		}
 
-			ctx := context.WithValue(r.Context(), "session", session)
-			ctx = a.GetAuthenticationContext(ctx, user)
-			next.ServeHTTP(w, r.WithContext(ctx))
+		c, err := r.Cookie(a.CookieName)
+		if err == nil && c != nil {
+			// Cookie found:
+			expired := !c.Expires.IsZero() && time.Now().After(c.Expires)
+			a.serveSession(w, r, next, c.Value, true, expired)
 			return
 		}
 
@@ -116,6 +176,139 @@ func (a Auth) SessionMW(next http.Handler) http.Handler {
 	})
 }
 
+// bearerToken Returns the token from the Authorization header, if present
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "Bearer ") {
+		return "", false
+	}
+
+	token := strings.TrimSpace(h[7:])
+	return token, len(token) > 0
+}
+
+// serveSession Validates the session with the given id, and if valid serves
+// the request with the session and its user in the context.  Sessions close to
+// expiry are extended if sliding expiry is enabled
+func (a Auth) serveSession(w http.ResponseWriter, r *http.Request, next http.Handler, id string, fromCookie bool, cookieExpired bool) {
+	session, err := a.GetSession(r.Context(), id)
+	if err != nil {
+		log.WithFields(logrus.Fields{"error": err, "session": id}).Warning("Failed to fetch session from database")
+		a.SetUnauthorised(w, r)
+		return
+	}
+
+	// Invalidate if expired:
+	if time.Now().After(session.GetExpiry()) || cookieExpired {
+		log.WithField("session", session.GetID()).Info("Session expired")
+		a.SetUnauthorised(w, r)
+		return
+	}
+
+	pending, err := a.sessionPending(session)
+	if err != nil {
+		log.WithFields(logrus.Fields{"error": err, "session": session.GetID()}).Error("Could not check whether session is pending MFA")
+		a.SetUnauthorised(w, r)
+		return
+	}
+
+	// Sessions waiting on a second factor aren't authenticated yet, but are
+	// left alone so that MFAVerifyHandler can complete them:
+	if pending {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	// Invalidate if user inactive
+	user, err := session.GetUser(r.Context())
+	if err != nil {
+		log.WithFields(logrus.Fields{"error": err}).Warning("Could not fetch session user")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// If inactive, don't use them:
+	if user.GetInactive() {
+		a.SetUnauthorised(w, r)
+		return
+	}
+
+	a.slideSession(w, r, session, fromCookie)
+
+	ctx := WithSession(r.Context(), session)
+
+	target, err := impersonatedUser(ctx, session)
+	if err != nil {
+		log.WithFields(logrus.Fields{"error": err, "session": session.GetID()}).Warning("Could not fetch impersonated user")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if target != nil {
+		ctx = a.GetImpersonationContext(ctx, user, target)
+	} else {
+		ctx = a.GetAuthenticationContext(ctx, user)
+	}
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// slideSession Extends the session if sliding expiry is enabled and it's
+// within RefreshThreshold of expiring, updating the cookie if that's how the
+// session was sent.  Failure to extend is logged, since the session remains
+// valid until its current expiry
+func (a Auth) slideSession(w http.ResponseWriter, r *http.Request, session Session, fromCookie bool) {
+	if a.SessionLifetime <= 0 || a.ExtendSession == nil {
+		return
+	}
+
+	if time.Until(session.GetExpiry()) > a.RefreshThreshold {
+		return
+	}
+
+	expiry, err := a.ExtendSession(r.Context(), session, time.Now().Add(a.SessionLifetime))
+	if err != nil {
+		log.WithFields(logrus.Fields{"error": err, "session": session.GetID()}).Error("Failed to extend session")
+		return
+	}
+
+	if fromCookie {
+		http.SetCookie(w, a.sessionCookie(session.GetID(), expiry))
+	}
+}
+
+// serveJWT Validates the JWT, and if valid serves the request with the user
+// for its claims in the context
+func (a Auth) serveJWT(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	claims, err := a.JWT.Validate(token)
+	if err != nil {
+		log.WithField("error", err).Info("Rejected bearer token")
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		a.SetUnauthorised(w, r)
+		return
+	}
+
+	if a.ClaimsUser == nil {
+		log.Error("Auth.ClaimsUser must be set to accept JWTs")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	user, err := a.ClaimsUser(r.Context(), claims)
+	if err != nil {
+		log.WithFields(logrus.Fields{"error": err, "subject": claims.Subject()}).Warning("Could not fetch user for token")
+		a.SetUnauthorised(w, r)
+		return
+	}
+
+	if user.GetInactive() {
+		a.SetUnauthorised(w, r)
+		return
+	}
+
+	next.ServeHTTP(w, r.WithContext(a.GetAuthenticationContext(r.Context(), user)))
+}
+
 // EnforceAuthenticationMW Adds authentication related information to context and rejects request if unauthenticated
 func (a Auth) EnforceAuthenticationMW(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -127,6 +320,13 @@ func (a Auth) EnforceAuthenticationMW(next http.Handler) http.Handler {
 			return
 		}
 
+		// The context already holds the user, and re-adding them would replace
+		// the actor as creator when impersonating:
+		if IsImpersonating(r.Context()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		next.ServeHTTP(w, r.WithContext(a.GetAuthenticationContext(r.Context(), user)))
 	})
 }
@@ -134,21 +334,20 @@ func (a Auth) EnforceAuthenticationMW(next http.Handler) http.Handler {
 // GetAuthenticationContext Sets the user and the user ID in context
 func (a Auth) GetAuthenticationContext(ctx context.Context, user User) context.Context {
 	if user != nil {
-		ctx = context.WithValue(ctx, "user", user)
-		ctx = context.WithValue(ctx, "created_by", user.GetID())
+		ctx = WithUser(ctx, user)
 	}
 	return ctx
 }
 
+// GetImpersonationContext Sets user as the effective user and actor as the
+// real user, whose ID is used as the creator of changes
+func (a Auth) GetImpersonationContext(ctx context.Context, actor User, user User) context.Context {
+	return WithImpersonation(ctx, actor, user)
+}
+
 // CheckAuthenticated Returns true if user is authenticated (present in context)
 func (a *Auth) CheckAuthenticated(w http.ResponseWriter, r *http.Request) (User, bool) {
-	user, ok := r.Context().Value("user").(User)
-
-	if !ok {
-		return nil, false
-	}
-
-	return user, ok
+	return UserFromContext(r.Context())
 }
 
 // SetUnauthorised Used to present a standard unauthorised response
@@ -156,10 +355,16 @@ func (a Auth) SetUnauthorised(w http.ResponseWriter, r *http.Request) {
 	a.logout(w, r)
 	w.Header().Add("Content-Type", "application/json")
 	w.WriteHeader(http.StatusUnauthorized)
+	writeError(w, "Invalid or expired session", 401)
+}
+
+// writeError Writes a gqlerror with the message and code as the body.  The
+// status code should already have been written
+func writeError(w http.ResponseWriter, message string, code interface{}) {
 	gerr := gqlerror.Error{}
-	gerr.Message = "Invalid or expired session"
+	gerr.Message = message
 	gerr.Extensions = map[string]interface{}{
-		"code": 401,
+		"code": code,
 	}
 
 	b, err := json.Marshal(gerr)
@@ -169,6 +374,27 @@ func (a Auth) SetUnauthorised(w http.ResponseWriter, r *http.Request) {
 	w.Write(b)
 }
 
+// writeStatusError Writes the status code and a gqlerror body
+func writeStatusError(w http.ResponseWriter, status int, message string) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	writeError(w, message, status)
+}
+
+// writeJSON Writes v as the JSON body of a 200 response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.WithField("error", err).Error("Could not json encode response")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
 // CustomAuthenticationHandler Returns a function for authenticating user,
 // using a custom function provided for checking the authentication details.
 // Handles all the session destruction and creation and so forth
@@ -185,66 +411,196 @@ func (a Auth) CustomAuthenticationHandler(
 
 		user, err := authenticator(r)
 
+		var terr ThrottledError
+		if errors.As(err, &terr) {
+			w.Header().Set("Retry-After", strconv.Itoa(retrySeconds(terr.RetryAfter)))
+			writeStatusError(w, http.StatusTooManyRequests, terr.Error())
+			log.WithFields(logrus.Fields{"error": err}).Info("Throttled user authentication request")
+			return
+		}
+
 		if err != nil {
-			w.WriteHeader(http.StatusForbidden)
-			fmt.Fprintf(w, getSafeError(err, invalidLoginMsg))
+			writeStatusError(w, http.StatusForbidden, getSafeError(err, invalidLoginMsg))
 			log.WithFields(logrus.Fields{"error": err}).Info("Failed to validate user authentication request")
 			return
 		}
 
-		session, expiry, err := a.CreateSession(ctx, user)
+		required, err := a.mfaRequired(ctx, user)
+		if err != nil {
+			writeStatusError(w, http.StatusInternalServerError, getSafeError(err, invalidLoginMsg))
+			log.WithField("error", err).Error("Failed to check MFA enrolment")
+			return
+		}
+
+		if required {
+			err = a.startPendingSession(ctx, w, user)
+			if err != nil {
+				writeStatusError(w, http.StatusInternalServerError, getSafeError(err, invalidLoginMsg))
+				log.WithField("error", err).Error("Failed to create pending session")
+				return
+			}
+
+			writeJSON(w, map[string]interface{}{"mfaRequired": true})
+			return
+		}
+
+		_, err = a.startSession(ctx, w, user)
 
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, getSafeError(err, invalidLoginMsg))
+			writeStatusError(w, http.StatusInternalServerError, getSafeError(err, invalidLoginMsg))
 			log.WithField("error", err).Error("Failed to create session")
 			return
 		}
 
-		var c http.Cookie
-		c.Name = a.CookieName
-		c.Value = session
-		c.Expires = expiry
-		c.HttpOnly = true
-		if !a.Debug {
-			c.Secure = true
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// startSession Creates a session for the user and sets the session cookie,
+// along with a new CSRF token if enabled.  Returns the session id
+func (a Auth) startSession(ctx context.Context, w http.ResponseWriter, user User) (string, error) {
+	session, expiry, err := a.CreateSession(ctx, user)
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, a.sessionCookie(session, expiry))
+
+	if a.CSRF != nil {
+		err = a.CSRF.setToken(w, a)
+		if err != nil {
+			log.WithField("error", err).Error("Failed to set CSRF token")
 		}
-		http.SetCookie(w, &c)
+	}
 
-		w.WriteHeader(http.StatusOK)
+	return session, nil
+}
+
+// RotateSession Replaces the current session with a new one for the same
+// user, setting the new session cookie and returning its id.  Call after a
+// change in privilege, e.g., a password change or role change, so that a
+// session id captured beforehand can't be used afterwards.  Returns
+// ErrImpersonating while impersonating, since the new session would be the
+// impersonated user's own
+func (a Auth) RotateSession(w http.ResponseWriter, r *http.Request) (string, error) {
+	span, ctx := opentracing.StartSpanFromContext(r.Context(), "rotateSession")
+	defer span.Finish()
+
+	if IsImpersonating(ctx) {
+		return "", ErrImpersonating
+	}
+
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return "", fmt.Errorf("No user in context to rotate session for")
 	}
+
+	if session, ok := SessionFromContext(ctx); ok {
+		err := session.Destroy(ctx)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return a.startSession(ctx, w, user)
+}
+
+// credentials Login details sent to AuthenticationHandler
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
 }
 
-// AuthenticationHandler Authenticates user and returns jwt if valid
+// maxCredentialsSize Limit on the size of a login request body
+const maxCredentialsSize = 1 << 16
+
+// AuthenticationHandler Authenticates user and starts a session if valid.
+// Credentials are read from a JSON or form encoded POST body, or from the
+// query string of a GET request if LegacyQueryCredentials is set
 func (a Auth) AuthenticationHandler(w http.ResponseWriter, r *http.Request) {
 	span, ctx := opentracing.StartSpanFromContext(r.Context(), "authenticationHandler")
 	defer span.Finish()
 
+	if r.Method != http.MethodPost && !(a.LegacyQueryCredentials && r.Method == http.MethodGet) {
+		w.Header().Set("Allow", http.MethodPost)
+		writeStatusError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
 	// We define the function used for verifying user, and call standard function
 	// above for handling actual  session creation/deletion
 	f := func(r *http.Request) (User, error) {
-		var username, password string
-
-		// Grab username and password
-		if len(r.URL.Query()["username"]) > 0 {
-			username = r.URL.Query()["username"][0]
-		}
-
-		if len(r.URL.Query()["password"]) > 0 {
-			password = r.URL.Query()["password"][0]
+		creds, err := readCredentials(w, r)
+		if err != nil {
+			return nil, err
 		}
+		username, password := creds.Username, creds.Password
 
 		// If no username or password provided, request is bad
 		if len(username) == 0 || len(password) == 0 {
 			return nil, fmt.Errorf("Attempt to authenticate with empty username or password")
 		}
 
-		return a.AuthenticateUser(ctx, username, password)
+		if a.Throttle == nil {
+			return a.AuthenticateUser(ctx, username, password)
+		}
+
+		attempt, err := a.Throttle.Attempt(ctx, username, a.Throttle.clientIP(r))
+		if err != nil {
+			return nil, err
+		}
+
+		user, err := a.AuthenticateUser(ctx, username, password)
+		if err != nil {
+			if ferr := attempt.Failed(ctx); ferr != nil {
+				log.WithField("error", ferr).Error("Failed to record failed login attempt")
+			}
+			return nil, err
+		}
+
+		if serr := attempt.Succeeded(ctx); serr != nil {
+			log.WithField("error", serr).Error("Failed to reset login attempts")
+		}
+
+		return user, nil
 	}
 
 	a.CustomAuthenticationHandler(f)(w, r)
 }
 
+// readCredentials Reads the username and password from the request body, or
+// from the query string for legacy GET requests
+func readCredentials(w http.ResponseWriter, r *http.Request) (credentials, error) {
+	var creds credentials
+
+	if r.Method == http.MethodGet {
+		creds.Username = r.URL.Query().Get("username")
+		creds.Password = r.URL.Query().Get("password")
+		return creds, nil
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxCredentialsSize)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		err := json.NewDecoder(r.Body).Decode(&creds)
+		if err != nil {
+			return creds, fmt.Errorf("Could not decode credentials: %s", err)
+		}
+		return creds, nil
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		return creds, fmt.Errorf("Could not parse credentials: %s", err)
+	}
+
+	creds.Username = r.PostForm.Get("username")
+	creds.Password = r.PostForm.Get("password")
+
+	return creds, nil
+}
+
 // LogoutHandler Authenticates user and returns jwt if valid
 func (a Auth) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	a.logout(w, r)
@@ -253,20 +609,84 @@ func (a Auth) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// LogoutEverywhereHandler Destroys all of the current user's sessions, on
+// every device, and clears the cookie on this one.  Forbidden while
+// impersonating.  Must be used after SessionMW
+func (a Auth) LogoutEverywhereHandler(w http.ResponseWriter, r *http.Request) {
+	span, ctx := opentracing.StartSpanFromContext(r.Context(), "logoutEverywhereHandler")
+	defer span.Finish()
+
+	if refuseImpersonation(w, r) {
+		return
+	}
+
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		a.SetUnauthorised(w, r)
+		return
+	}
+
+	err := a.LogoutEverywhere(ctx, user)
+	if err != nil {
+		log.WithFields(logrus.Fields{"error": err, "user": user.GetID()}).Error("Failed to destroy all sessions")
+		writeStatusError(w, http.StatusInternalServerError, "Could not log out of all sessions")
+		return
+	}
+
+	a.logout(w, r)
+	w.WriteHeader(http.StatusOK)
+}
+
+// LogoutEverywhere Destroys all sessions for the user, e.g., after a password
+// reset or when an administrator disables an account
+func (a Auth) LogoutEverywhere(ctx context.Context, user User) error {
+	if a.DestroyAllSessions == nil {
+		return fmt.Errorf("Auth.DestroyAllSessions must be set to log out everywhere")
+	}
+
+	return a.DestroyAllSessions(ctx, user)
+}
+
 // logout Logs the user out
 func (a Auth) logout(w http.ResponseWriter, r *http.Request) {
 	a.DestroySession(r)
 
+	http.SetCookie(w, a.sessionCookie("", time.Unix(0, 0)))
+
+	if a.CSRF != nil {
+		http.SetCookie(w, a.cookie(a.CSRF.cookieName(), "", time.Unix(0, 0), false))
+	}
+}
+
+// sessionCookie Returns the session cookie with the configured attributes
+func (a Auth) sessionCookie(value string, expires time.Time) *http.Cookie {
+	return a.cookie(a.CookieName, value, expires, true)
+}
+
+// cookie Returns a cookie with the configured domain, path and SameSite
+// attributes.  Cookies are only marked Secure outside of debug mode, so that
+// they can be used without SSL while developing
+func (a Auth) cookie(name string, value string, expires time.Time, httpOnly bool) *http.Cookie {
 	c := &http.Cookie{
-		Name:    a.CookieName,
-		Value:   "",
-		Path:    "/",
-		Expires: time.Unix(0, 0),
+		Name:     name,
+		Value:    value,
+		Domain:   a.CookieDomain,
+		Path:     a.CookiePath,
+		Expires:  expires,
+		HttpOnly: httpOnly,
+		SameSite: a.CookieSameSite,
+		Secure:   !a.Debug,
+	}
+
+	if len(c.Path) == 0 {
+		c.Path = "/"
+	}
 
-		HttpOnly: true,
+	if c.SameSite == 0 {
+		c.SameSite = http.SameSiteLaxMode
 	}
 
-	http.SetCookie(w, c)
+	return c
 }
 
 // DestroySession Destroys session if one exists
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/episub/spawn/vars"
+)
+
+// LegacyContextKeys When true, WithUser and WithSession also store values
+// under the old string keys "user", "session" and "created_by", for project
+// code still reading ctx.Value("user").  Set to false once all such code uses
+// the accessor functions
+var LegacyContextKeys = true
+
+// legacy* The string keys values were stored under before vars.ContextKey
+const (
+	legacyUserKey      = "user"
+	legacySessionKey   = "session"
+	legacyCreatedByKey = "created_by"
+)
+
+// WithUser Returns a copy of ctx holding the user, and their ID as the
+// creator of any changes
+func WithUser(ctx context.Context, user User) context.Context {
+	ctx = context.WithValue(ctx, vars.UserKey, user)
+	ctx = context.WithValue(ctx, vars.CreatedByKey, user.GetID())
+
+	if LegacyContextKeys {
+		ctx = context.WithValue(ctx, legacyUserKey, user)
+		ctx = context.WithValue(ctx, legacyCreatedByKey, user.GetID())
+	}
+
+	return ctx
+}
+
+// WithImpersonation Returns a copy of ctx holding user as the effective user
+// and actor as the real user acting as them.  Changes are recorded as made by
+// the actor
+func WithImpersonation(ctx context.Context, actor User, user User) context.Context {
+	ctx = WithUser(ctx, user)
+	ctx = context.WithValue(ctx, vars.ActorKey, actor)
+	ctx = context.WithValue(ctx, vars.CreatedByKey, actor.GetID())
+
+	if LegacyContextKeys {
+		ctx = context.WithValue(ctx, legacyCreatedByKey, actor.GetID())
+	}
+
+	return ctx
+}
+
+// WithSession Returns a copy of ctx holding the session
+func WithSession(ctx context.Context, session Session) context.Context {
+	ctx = context.WithValue(ctx, vars.SessionKey, session)
+
+	if LegacyContextKeys {
+		ctx = context.WithValue(ctx, legacySessionKey, session)
+	}
+
+	return ctx
+}
+
+// UserFromContext Returns the authenticated user, if any
+func UserFromContext(ctx context.Context) (User, bool) {
+	if user, ok := ctx.Value(vars.UserKey).(User); ok {
+		return user, true
+	}
+
+	user, ok := ctx.Value(legacyUserKey).(User)
+	return user, ok
+}
+
+// ActorFromContext Returns the real user making the request, who is the
+// same as the user unless impersonating
+func ActorFromContext(ctx context.Context) (User, bool) {
+	if actor, ok := ctx.Value(vars.ActorKey).(User); ok {
+		return actor, true
+	}
+
+	return UserFromContext(ctx)
+}
+
+// IsImpersonating Returns true if the actor is impersonating another user
+func IsImpersonating(ctx context.Context) bool {
+	_, ok := ctx.Value(vars.ActorKey).(User)
+	return ok
+}
+
+// AddUserInput Adds the user, actor and API key scopes to the policy input,
+// if present
+func AddUserInput(ctx context.Context, input map[string]interface{}) {
+	if user, ok := UserFromContext(ctx); ok {
+		input["user"] = user
+	}
+
+	if actor, ok := ActorFromContext(ctx); ok {
+		input["actor"] = actor
+	}
+
+	if scopes, ok := ScopesFromContext(ctx); ok {
+		input["scopes"] = scopes
+	}
+}
+
+// SessionFromContext Returns the current session, if any
+func SessionFromContext(ctx context.Context) (Session, bool) {
+	if session, ok := ctx.Value(vars.SessionKey).(Session); ok {
+		return session, true
+	}
+
+	session, ok := ctx.Value(legacySessionKey).(Session)
+	return session, ok
+}
+
+// CreatedByFromContext Returns the ID of the user making changes, if any
+func CreatedByFromContext(ctx context.Context) (string, bool) {
+	if id, ok := ctx.Value(vars.CreatedByKey).(string); ok {
+		return id, true
+	}
+
+	id, ok := ctx.Value(legacyCreatedByKey).(string)
+	return id, ok
+}
@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultCSRFCookieName = "csrf_token"
+	defaultCSRFHeaderName = "X-CSRF-Token"
+	csrfTokenBytes        = 32
+)
+
+// CSRF Options for protecting cookie authenticated requests against cross-site
+// request forgery.  Requests authenticated with a bearer token are not checked,
+// since browsers never add those automatically
+type CSRF struct {
+	// CookieName Cookie holding the token for double-submit checks.  It is
+	// readable by javascript so the client can copy it into the header.
+	// Defaults to csrf_token
+	CookieName string
+	// HeaderName Header clients must send with unsafe requests.  Defaults to
+	// X-CSRF-Token
+	HeaderName string
+	// DoubleSubmit When true, the header must match the token in the cookie.
+	// When false, the header only needs to be present, which browsers won't
+	// allow a cross-site form or request to do without a CORS preflight
+	DoubleSubmit bool
+	// TrustedOrigins Origins other than the request's own host that may make
+	// requests, e.g., https://app.example.com
+	TrustedOrigins []string
+}
+
+// safeMethods Methods that must not change state, so are not checked
+var safeMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+func (c *CSRF) cookieName() string {
+	if len(c.CookieName) > 0 {
+		return c.CookieName
+	}
+
+	return defaultCSRFCookieName
+}
+
+func (c *CSRF) headerName() string {
+	if len(c.HeaderName) > 0 {
+		return c.HeaderName
+	}
+
+	return defaultCSRFHeaderName
+}
+
+// setToken Sets a new random token in the CSRF cookie, which lasts as long as
+// the browser session
+func (c *CSRF) setToken(w http.ResponseWriter, a Auth) error {
+	b := make([]byte, csrfTokenBytes)
+	_, err := io.ReadFull(rand.Reader, b)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, a.cookie(c.cookieName(), base64.RawURLEncoding.EncodeToString(b), time.Time{}, false))
+	return nil
+}
+
+// CSRFMW Rejects unsafe requests authenticated with the session cookie unless
+// they come from a trusted origin and carry the CSRF header.  Does nothing if
+// Auth.CSRF is not set
+func (a Auth) CSRFMW(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.CSRF == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Only cookies are sent automatically by the browser.  SessionMW ignores
+		// the cookie when a bearer token is present:
+		if _, ok := bearerToken(r); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if _, err := r.Cookie(a.CookieName); err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if safeMethods[r.Method] {
+			// Sessions created before CSRF was enabled won't have a token yet:
+			if _, err := r.Cookie(a.CSRF.cookieName()); err != nil && a.CSRF.DoubleSubmit {
+				if err := a.CSRF.setToken(w, a); err != nil {
+					log.WithField("error", err).Error("Failed to set CSRF token")
+				}
+			}
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !a.CSRF.trustedOrigin(r) {
+			log.WithFields(logrus.Fields{"origin": r.Header.Get("Origin"), "referer": r.Referer()}).Warning("Rejected cross-site request")
+			csrfFailed(w)
+			return
+		}
+
+		if !a.CSRF.validHeader(r) {
+			log.Warning("Rejected request with missing or invalid CSRF token")
+			csrfFailed(w)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// trustedOrigin Checks the Origin header, or Referer if there is no Origin,
+// against the request's host and the trusted origins.  Requests with
+// neither header are allowed through to the token check
+func (c *CSRF) trustedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 || origin == "null" {
+		origin = r.Referer()
+	}
+
+	if len(origin) == 0 {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || len(u.Host) == 0 {
+		return false
+	}
+
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	for _, t := range c.TrustedOrigins {
+		tu, err := url.Parse(t)
+		if err == nil && strings.EqualFold(tu.Scheme, u.Scheme) && strings.EqualFold(tu.Host, u.Host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validHeader Checks the CSRF header is present and, for double-submit,
+// matches the cookie
+func (c *CSRF) validHeader(r *http.Request) bool {
+	header := r.Header.Get(c.headerName())
+	if len(header) == 0 {
+		return false
+	}
+
+	if !c.DoubleSubmit {
+		return true
+	}
+
+	cookie, err := r.Cookie(c.cookieName())
+	if err != nil || len(cookie.Value) == 0 {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) == 1
+}
+
+func csrfFailed(w http.ResponseWriter) {
+	writeStatusError(w, http.StatusForbidden, "Request failed cross-site request forgery checks")
+}
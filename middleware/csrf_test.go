@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCSRFMW(t *testing.T) {
+	a := Auth{
+		CookieName: "session",
+		CSRF: &CSRF{
+			DoubleSubmit:   true,
+			TrustedOrigins: []string{"https://app.example.com"},
+		},
+	}
+
+	var tests = []struct {
+		Name    string
+		Method  string
+		Session bool
+		Bearer  bool
+		Cookie  string
+		Header  string
+		Origin  string
+		Referer string
+		Allowed bool
+	}{
+		{Name: "Matching token", Method: http.MethodPost, Session: true, Cookie: "token", Header: "token", Allowed: true},
+		{Name: "Mismatched token", Method: http.MethodPost, Session: true, Cookie: "token", Header: "other"},
+		{Name: "Missing header", Method: http.MethodPost, Session: true, Cookie: "token"},
+		{Name: "Missing cookie", Method: http.MethodPost, Session: true, Header: "token"},
+		{Name: "Same origin", Method: http.MethodPost, Session: true, Cookie: "token", Header: "token", Origin: "https://example.com", Allowed: true},
+		{Name: "Trusted origin", Method: http.MethodPost, Session: true, Cookie: "token", Header: "token", Origin: "https://app.example.com", Allowed: true},
+		{Name: "Cross origin", Method: http.MethodPost, Session: true, Cookie: "token", Header: "token", Origin: "https://evil.example.com"},
+		{Name: "Trusted host over http", Method: http.MethodPost, Session: true, Cookie: "token", Header: "token", Origin: "http://app.example.com"},
+		{Name: "Cross-site referer", Method: http.MethodPost, Session: true, Cookie: "token", Header: "token", Referer: "https://evil.example.com/form"},
+		{Name: "Same site referer", Method: http.MethodPost, Session: true, Cookie: "token", Header: "token", Referer: "https://example.com/form", Allowed: true},
+		{Name: "Safe method", Method: http.MethodGet, Session: true, Origin: "https://evil.example.com", Allowed: true},
+		{Name: "Bearer token", Method: http.MethodPost, Session: true, Bearer: true, Origin: "https://evil.example.com", Allowed: true},
+		{Name: "No session", Method: http.MethodPost, Allowed: true},
+	}
+
+	for _, test := range tests {
+		var called bool
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		})
+
+		r := httptest.NewRequest(test.Method, "https://example.com/query", nil)
+		if test.Session {
+			r.AddCookie(&http.Cookie{Name: "session", Value: "session"})
+		}
+		if test.Bearer {
+			r.Header.Set("Authorization", "Bearer token")
+		}
+		if len(test.Cookie) > 0 {
+			r.AddCookie(&http.Cookie{Name: defaultCSRFCookieName, Value: test.Cookie})
+		}
+		if len(test.Header) > 0 {
+			r.Header.Set(defaultCSRFHeaderName, test.Header)
+		}
+		if len(test.Origin) > 0 {
+			r.Header.Set("Origin", test.Origin)
+		}
+		if len(test.Referer) > 0 {
+			r.Header.Set("Referer", test.Referer)
+		}
+
+		w := httptest.NewRecorder()
+		a.CSRFMW(next).ServeHTTP(w, r)
+
+		if called != test.Allowed {
+			t.Errorf("%s: Expected allowed %t, but was %t with status %d", test.Name, test.Allowed, called, w.Code)
+		}
+
+		if !called && w.Code != http.StatusForbidden {
+			t.Errorf("%s: Expected forbidden, but was %d", test.Name, w.Code)
+		}
+	}
+}
+
+func TestCSRFHeaderOnly(t *testing.T) {
+	a := Auth{CookieName: "session", CSRF: &CSRF{}}
+
+	var tests = []struct {
+		Name    string
+		Header  string
+		Allowed bool
+	}{
+		{"Header", "1", true},
+		{"No header", "", false},
+	}
+
+	for _, test := range tests {
+		var called bool
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		})
+
+		r := httptest.NewRequest(http.MethodPost, "https://example.com/query", nil)
+		r.AddCookie(&http.Cookie{Name: "session", Value: "session"})
+		if len(test.Header) > 0 {
+			r.Header.Set(defaultCSRFHeaderName, test.Header)
+		}
+
+		a.CSRFMW(next).ServeHTTP(httptest.NewRecorder(), r)
+
+		if called != test.Allowed {
+			t.Errorf("%s: Expected allowed %t, but was %t", test.Name, test.Allowed, called)
+		}
+	}
+}
+
+func TestCSRFSetsToken(t *testing.T) {
+	a := Auth{CookieName: "session", CSRF: &CSRF{DoubleSubmit: true}}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/query", nil)
+	r.AddCookie(&http.Cookie{Name: "session", Value: "session"})
+	w := httptest.NewRecorder()
+	a.CSRFMW(next).ServeHTTP(w, r)
+
+	var token string
+	for _, c := range w.Result().Cookies() {
+		if c.Name == defaultCSRFCookieName {
+			token = c.Value
+		}
+	}
+
+	if len(token) == 0 {
+		t.Errorf("Expected CSRF token set for existing session")
+	}
+}
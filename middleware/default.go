@@ -15,10 +15,19 @@ import (
 // DefaultMW Sets up items needed for most requests
 // - Adds a data object to the context, used for passing data through to OPA requests
 // - Sets validation context
+// - Sets the locale for validation messages from the Accept-Language header
+// - Sets the user's timezone for date validation from the Time-Zone header,
+// an IANA name such as Australia/Sydney, if valid
 func DefaultMW(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := context.WithValue(r.Context(), vars.SharedData, store.NewDataStore())
 		ctx = validate.SetContext(ctx)
+		ctx = validate.WithLocale(ctx, validate.MatchLocale(r.Header.Get("Accept-Language")))
+		if tz := r.Header.Get("Time-Zone"); len(tz) > 0 {
+			if loc, err := validate.LoadTimezone(tz); err == nil {
+				ctx = validate.WithTimezone(ctx, loc)
+			}
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/sirupsen/logrus"
+)
+
+// maxImpersonateRequestSize Limit on the size of an impersonation request body
+const maxImpersonateRequestSize = 1 << 12
+
+// ErrImpersonating Returned by actions on the user's own account, such as
+// rotating their session, which aren't permitted while impersonating them
+var ErrImpersonating = errors.New("Not permitted while impersonating a user")
+
+// refuseImpersonation Writes a forbidden response and returns true if the
+// request is impersonating a user.  Used by handlers acting on the user's
+// own account or sessions, which only the user may do
+func refuseImpersonation(w http.ResponseWriter, r *http.Request) bool {
+	if !IsImpersonating(r.Context()) {
+		return false
+	}
+
+	writeStatusError(w, http.StatusForbidden, ErrImpersonating.Error())
+	return true
+}
+
+// ImpersonatingSession Optional interface for sessions whose user can act as
+// another user.  Session.GetUser still returns the real user
+type ImpersonatingSession interface {
+	// GetImpersonatedUser Returns the user being impersonated, or nil if none
+	GetImpersonatedUser(context.Context) (User, error)
+}
+
+// impersonatedUser Returns the user the session is impersonating, if any
+func impersonatedUser(ctx context.Context, session Session) (User, error) {
+	s, ok := session.(ImpersonatingSession)
+	if !ok {
+		return nil, nil
+	}
+
+	return s.GetImpersonatedUser(ctx)
+}
+
+// ImpersonateHandler Starts impersonating the user with the ID given as
+// {"userID": "..."}, if permitted by the data.api.auth.impersonate policy.
+// Input to the policy holds the actor and the user to impersonate.  Inactive
+// users can't be impersonated.  Needs Auth.GetUserByID and
+// Auth.StartImpersonation, responding 501 without them.  Must be used after
+// SessionMW and EnforceAuthenticationMW
+func (a Auth) ImpersonateHandler(w http.ResponseWriter, r *http.Request) {
+	span, ctx := opentracing.StartSpanFromContext(r.Context(), "impersonateHandler")
+	defer span.Finish()
+
+	actor, ok := ActorFromContext(ctx)
+	session, hasSession := SessionFromContext(ctx)
+	if !ok || !hasSession {
+		a.SetUnauthorised(w, r)
+		return
+	}
+
+	if IsImpersonating(ctx) {
+		writeStatusError(w, http.StatusConflict, "Already impersonating a user")
+		return
+	}
+
+	if a.GetUserByID == nil || a.StartImpersonation == nil {
+		log.Error("Auth.GetUserByID and Auth.StartImpersonation must be set to impersonate users")
+		writeStatusError(w, http.StatusNotImplemented, "Impersonation is not available")
+		return
+	}
+
+	var req struct {
+		UserID string `json:"userID"`
+	}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImpersonateRequestSize)).Decode(&req)
+	if err != nil || len(req.UserID) == 0 {
+		writeStatusError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	fields := logrus.Fields{"actor": actor.GetID(), "user": req.UserID}
+
+	target, err := a.GetUserByID(ctx, req.UserID)
+	if err != nil {
+		log.WithFields(fields).WithField("error", err).Info("Could not fetch user to impersonate")
+		writeStatusError(w, http.StatusForbidden, "Not permitted to impersonate this user")
+		return
+	}
+
+	// As at login, inactive users can't be acted as:
+	if target == nil || target.GetInactive() {
+		log.WithFields(fields).Info("Cannot impersonate inactive user")
+		writeStatusError(w, http.StatusForbidden, "Not permitted to impersonate this user")
+		return
+	}
+
+	_, _, err = CheckAllowed(ctx, "auth", "impersonate", map[string]interface{}{"actor": actor, "user": target})
+	if err != nil {
+		log.WithFields(fields).WithField("error", err).Warning("Impersonation rejected")
+		writeStatusError(w, http.StatusForbidden, "Not permitted to impersonate this user")
+		return
+	}
+
+	err = a.StartImpersonation(ctx, session, target)
+	if err != nil {
+		log.WithFields(fields).WithField("error", err).Error("Failed to start impersonation")
+		writeStatusError(w, http.StatusInternalServerError, "Could not start impersonation")
+		return
+	}
+
+	log.WithFields(fields).Info("Impersonation started")
+	w.WriteHeader(http.StatusOK)
+}
+
+// EndImpersonationHandler Returns the session to acting as the real user, if
+// permitted by the data.api.auth.endImpersonation policy.  Needs
+// Auth.EndImpersonation, responding 501 without it.  Must be used after
+// SessionMW and EnforceAuthenticationMW
+func (a Auth) EndImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	span, ctx := opentracing.StartSpanFromContext(r.Context(), "endImpersonationHandler")
+	defer span.Finish()
+
+	actor, _ := ActorFromContext(ctx)
+	user, ok := UserFromContext(ctx)
+	session, hasSession := SessionFromContext(ctx)
+	if !ok || !hasSession {
+		a.SetUnauthorised(w, r)
+		return
+	}
+
+	if !IsImpersonating(ctx) {
+		writeStatusError(w, http.StatusConflict, "Not impersonating a user")
+		return
+	}
+
+	if a.EndImpersonation == nil {
+		log.Error("Auth.EndImpersonation must be set to end impersonation")
+		writeStatusError(w, http.StatusNotImplemented, "Impersonation is not available")
+		return
+	}
+
+	fields := logrus.Fields{"actor": actor.GetID(), "user": user.GetID()}
+
+	_, _, err := CheckAllowed(ctx, "auth", "endImpersonation", map[string]interface{}{"actor": actor, "user": user})
+	if err != nil {
+		log.WithFields(fields).WithField("error", err).Warning("Ending impersonation rejected")
+		writeStatusError(w, http.StatusForbidden, "Not permitted to end impersonation")
+		return
+	}
+
+	err = a.EndImpersonation(ctx, session)
+	if err != nil {
+		log.WithFields(fields).WithField("error", err).Error("Failed to end impersonation")
+		writeStatusError(w, http.StatusInternalServerError, "Could not end impersonation")
+		return
+	}
+
+	log.WithFields(fields).Info("Impersonation ended")
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestImpersonationRefused(t *testing.T) {
+	a := newMFATest("")
+	a.DestroyAllSessions = func(ctx context.Context, u User) error {
+		t.Errorf("Expected sessions of %s not destroyed", u.GetID())
+		return nil
+	}
+
+	ctx := WithImpersonation(context.Background(), testUser("support"), testUser("42"))
+
+	var tests = []struct {
+		Name    string
+		Handler http.HandlerFunc
+	}{
+		{"Logout everywhere", a.LogoutEverywhereHandler},
+		{"MFA enrol", a.MFAEnrolHandler},
+		{"MFA confirm", a.MFAConfirmHandler},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`)).WithContext(ctx)
+		w := httptest.NewRecorder()
+		test.Handler(w, r)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: Expected forbidden while impersonating, but was %d", test.Name, w.Code)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil).WithContext(ctx)
+	if _, err := a.RotateSession(httptest.NewRecorder(), r); err != ErrImpersonating {
+		t.Errorf("Expected ErrImpersonating rotating session, but was %v", err)
+	}
+}
+
+type inactiveUser string
+
+func (u inactiveUser) GetID() string     { return string(u) }
+func (u inactiveUser) GetInactive() bool { return true }
+
+func TestImpersonateHandler(t *testing.T) {
+	users := map[string]User{"42": testUser("42"), "7": inactiveUser("7")}
+	getUser := func(ctx context.Context, id string) (User, error) {
+		if u, ok := users[id]; ok {
+			return u, nil
+		}
+		return nil, fmt.Errorf("No user %s", id)
+	}
+
+	var started bool
+	start := func(context.Context, Session, User) error {
+		started = true
+		return nil
+	}
+
+	var tests = []struct {
+		Name   string
+		Auth   Auth
+		UserID string
+		Status int
+	}{
+		{"Inactive user", Auth{GetUserByID: getUser, StartImpersonation: start}, "7", http.StatusForbidden},
+		{"Unknown user", Auth{GetUserByID: getUser, StartImpersonation: start}, "8", http.StatusForbidden},
+		{"Without GetUserByID", Auth{StartImpersonation: start}, "42", http.StatusNotImplemented},
+		{"Without StartImpersonation", Auth{GetUserByID: getUser}, "42", http.StatusNotImplemented},
+	}
+
+	ctx := WithSession(WithUser(context.Background(), testUser("support")), testSession{"session", testUser("support")})
+
+	for _, test := range tests {
+		body := fmt.Sprintf(`{"userID": "%s"}`, test.UserID)
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)).WithContext(ctx)
+		w := httptest.NewRecorder()
+		test.Auth.ImpersonateHandler(w, r)
+
+		if w.Code != test.Status {
+			t.Errorf("%s: Expected status %d, but was %d", test.Name, test.Status, w.Code)
+		}
+	}
+
+	if started {
+		t.Errorf("Expected no impersonation started")
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil).WithContext(WithSession(WithImpersonation(context.Background(), testUser("support"), testUser("42")), testSession{"session", testUser("support")}))
+	w := httptest.NewRecorder()
+	Auth{}.EndImpersonationHandler(w, r)
+
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected ending impersonation without EndImpersonation not implemented, but was %d", w.Code)
+	}
+}
@@ -0,0 +1,395 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Claims The claims of a validated JWT
+type Claims map[string]interface{}
+
+// String Returns the named claim if it is a string, otherwise empty string
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Subject Returns the 'sub' claim
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+// JWTValidator Validates JWTs signed with HS256, RS256 or ES256 against a set
+// of keys, identified by their 'kid'
+type JWTValidator struct {
+	// Issuer If set, the 'iss' claim must match
+	Issuer string
+	// Audience If set, the 'aud' claim must contain this value
+	Audience string
+	// Leeway Allowed clock skew when checking 'exp' and 'nbf'
+	Leeway time.Duration
+
+	keys  map[string]interface{}
+	mutex *sync.RWMutex
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// jwk A single JSON Web Key, https://tools.ietf.org/html/rfc7517
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+var (
+	// ErrInvalidToken Token is malformed, its signature doesn't match, or it
+	// has no expiry
+	ErrInvalidToken = SafeError("Invalid token")
+	// ErrExpiredToken Token has expired or is not yet valid
+	ErrExpiredToken = SafeError("Expired token")
+
+	// errSignature Token's key is unknown or its signature doesn't match any
+	// key.  Returned as ErrInvalidToken by Validate
+	errSignature = errors.New("Unknown key or invalid signature")
+)
+
+// NewJWTValidator Returns a validator with no keys.  Issuer and audience are
+// only checked if not empty
+func NewJWTValidator(issuer string, audience string) *JWTValidator {
+	return &JWTValidator{
+		Issuer:   issuer,
+		Audience: audience,
+		Leeway:   time.Minute,
+		keys:     make(map[string]interface{}),
+		mutex:    &sync.RWMutex{},
+	}
+}
+
+// AddHMACKey Adds a shared secret for HS256 tokens
+func (v *JWTValidator) AddHMACKey(kid string, secret []byte) {
+	v.addKey(kid, secret)
+}
+
+// AddPublicKey Adds an *rsa.PublicKey for RS256 tokens or *ecdsa.PublicKey
+// for ES256 tokens
+func (v *JWTValidator) AddPublicKey(kid string, key crypto.PublicKey) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return fmt.Errorf("Only P-256 keys are supported for ES256")
+		}
+	default:
+		return fmt.Errorf("Unsupported key type %T", key)
+	}
+
+	v.addKey(kid, key)
+	return nil
+}
+
+func (v *JWTValidator) addKey(kid string, key interface{}) {
+	v.mutex.Lock()
+	v.keys[kid] = key
+	v.mutex.Unlock()
+}
+
+// LoadJWKS Adds all keys in the JSON Web Key Set
+func (v *JWTValidator) LoadJWKS(b []byte) error {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	err := json.Unmarshal(b, &set)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range set.Keys {
+		key, err := k.key()
+		if err != nil {
+			return fmt.Errorf("Key '%s': %s", k.Kid, err)
+		}
+
+		v.addKey(k.Kid, key)
+	}
+
+	return nil
+}
+
+// LoadJWKSFile Adds all keys in the JSON Web Key Set file
+func (v *JWTValidator) LoadJWKSFile(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return v.LoadJWKS(b)
+}
+
+// FetchJWKS Adds all keys in the JSON Web Key Set served at url
+func (v *JWTValidator) FetchJWKS(ctx context.Context, client *http.Client, url string) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Fetching JWKS from %s returned status %d", url, res.StatusCode)
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	return v.LoadJWKS(b)
+}
+
+// key Converts the JWK to a key usable for validation
+func (k jwk) key() (interface{}, error) {
+	switch k.Kty {
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("Unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported key type %s", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+// isJWT Returns true if the token has the three parts of a JWT, as opposed
+// to an opaque session id
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Validate Checks the token's signature, expiry, issuer and audience, and
+// returns its claims if valid.  Tokens without an 'exp' claim are rejected
+func (v *JWTValidator) Validate(token string) (Claims, error) {
+	claims, err := v.validate(token)
+	if err == errSignature {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, err
+}
+
+// validate As Validate, but returns errSignature if the token's key is
+// unknown or its signature doesn't match, e.g., if the keys have been rotated
+func (v *JWTValidator) validate(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header jwtHeader
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	switch header.Alg {
+	case "HS256", "RS256", "ES256":
+	default:
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	err = v.verify(header, []byte(parts[0]+"."+parts[1]), signature)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, v.checkClaims(claims)
+}
+
+// verify Checks the signature with the key named in the header, or every
+// key if the header doesn't name one
+func (v *JWTValidator) verify(header jwtHeader, signed []byte, signature []byte) error {
+	v.mutex.RLock()
+	var keys []interface{}
+	if len(header.Kid) > 0 {
+		if k, ok := v.keys[header.Kid]; ok {
+			keys = append(keys, k)
+		}
+	} else {
+		for _, k := range v.keys {
+			keys = append(keys, k)
+		}
+	}
+	v.mutex.RUnlock()
+
+	hash := sha256.Sum256(signed)
+
+	for _, key := range keys {
+		switch k := key.(type) {
+		case []byte:
+			if header.Alg != "HS256" {
+				continue
+			}
+			mac := hmac.New(sha256.New, k)
+			mac.Write(signed)
+			if hmac.Equal(signature, mac.Sum(nil)) {
+				return nil
+			}
+		case *rsa.PublicKey:
+			if header.Alg != "RS256" {
+				continue
+			}
+			if rsa.VerifyPKCS1v15(k, crypto.SHA256, hash[:], signature) == nil {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			if header.Alg != "ES256" || len(signature) != 64 {
+				continue
+			}
+			r := new(big.Int).SetBytes(signature[:32])
+			s := new(big.Int).SetBytes(signature[32:])
+			if ecdsa.Verify(k, hash[:], r, s) {
+				return nil
+			}
+		}
+	}
+
+	return errSignature
+}
+
+// checkClaims Validates the registered claims.  Tokens must have an expiry,
+// since one without would be valid forever
+func (v *JWTValidator) checkClaims(claims Claims) error {
+	now := time.Now()
+
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return ErrInvalidToken
+	}
+
+	if now.After(exp.Add(v.Leeway)) {
+		return ErrExpiredToken
+	}
+
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(v.Leeway).Before(nbf) {
+		return ErrExpiredToken
+	}
+
+	if len(v.Issuer) > 0 && claims.String("iss") != v.Issuer {
+		return ErrInvalidToken
+	}
+
+	if len(v.Audience) > 0 && !audienceContains(claims["aud"], v.Audience) {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
+
+func numericDate(v interface{}) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(f), 0), true
+}
+
+// audienceContains The 'aud' claim may be a single string or an array
+func audienceContains(aud interface{}, audience string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == audience
+	case []interface{}:
+		for _, v := range a {
+			if s, ok := v.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	d := json.NewDecoder(strings.NewReader(string(b)))
+	d.UseNumber()
+	return d.Decode(v)
+}
@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// signJWT Returns a token with the claims, signed with the key for alg.
+// Tokens with alg 'none' are left unsigned
+func signJWT(t *testing.T, alg string, kid string, key interface{}, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid})
+	payload, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		// r and s are each padded to 32 bytes:
+		signature = make([]byte, 64)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(signature[32-len(rb):32], rb)
+		copy(signature[64-len(sb):], sb)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// jwtClaims Returns valid claims, with the changes applied.  Nil values
+// remove the claim
+func jwtClaims(changes map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{
+		"iss": "https://auth.example.com",
+		"aud": "api",
+		"sub": "42",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+
+	for k, v := range changes {
+		if v == nil {
+			delete(claims, k)
+			continue
+		}
+		claims[k] = v
+	}
+
+	return claims
+}
+
+func TestJWTValidate(t *testing.T) {
+	secret := []byte("shared secret")
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The RSA public key as an attacker would use it for an HS256 secret:
+	rsaPublic, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys are loaded from a JWKS, as they would be from a provider:
+	jwks, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "oct", "kid": "hs", "k": base64.RawURLEncoding.EncodeToString(secret)},
+			{
+				"kty": "RSA",
+				"kid": "rs",
+				"n":   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{
+				"kty": "EC",
+				"kid": "es",
+				"crv": "P-256",
+				"x":   base64.RawURLEncoding.EncodeToString(ecKey.X.Bytes()),
+				"y":   base64.RawURLEncoding.EncodeToString(ecKey.Y.Bytes()),
+			},
+		},
+	})
+
+	v := NewJWTValidator("https://auth.example.com", "api")
+	err = v.LoadJWKS(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hour := int64(time.Hour.Seconds())
+	now := time.Now().Unix()
+
+	var tests = []struct {
+		Name  string
+		Token string
+		Err   error
+	}{
+		{"HS256", signJWT(t, "HS256", "hs", secret, jwtClaims(nil)), nil},
+		{"RS256", signJWT(t, "RS256", "rs", rsaKey, jwtClaims(nil)), nil},
+		{"ES256", signJWT(t, "ES256", "es", ecKey, jwtClaims(nil)), nil},
+		{"Without kid", signJWT(t, "ES256", "", ecKey, jwtClaims(nil)), nil},
+		{"Audience list", signJWT(t, "RS256", "rs", rsaKey, jwtClaims(map[string]interface{}{"aud": []string{"other", "api"}})), nil},
+		{"None", signJWT(t, "none", "hs", nil, jwtClaims(nil)), ErrInvalidToken},
+		{"Wrong alg", signJWT(t, "RS256", "hs", secret, jwtClaims(nil)), ErrInvalidToken},
+		{"HS256 with RSA key", signJWT(t, "HS256", "rs", rsaPublic, jwtClaims(nil)), ErrInvalidToken},
+		{"Wrong key", signJWT(t, "HS256", "hs", []byte("guess"), jwtClaims(nil)), ErrInvalidToken},
+		{"Unknown kid", signJWT(t, "HS256", "other", secret, jwtClaims(nil)), ErrInvalidToken},
+		{"Expired", signJWT(t, "HS256", "hs", secret, jwtClaims(map[string]interface{}{"exp": now - hour})), ErrExpiredToken},
+		{"No expiry", signJWT(t, "HS256", "hs", secret, jwtClaims(map[string]interface{}{"exp": nil})), ErrInvalidToken},
+		{"Not yet valid", signJWT(t, "HS256", "hs", secret, jwtClaims(map[string]interface{}{"nbf": now + hour})), ErrExpiredToken},
+		{"Within leeway", signJWT(t, "HS256", "hs", secret, jwtClaims(map[string]interface{}{"exp": now - 10, "nbf": now + 10})), nil},
+		{"Wrong issuer", signJWT(t, "HS256", "hs", secret, jwtClaims(map[string]interface{}{"iss": "https://evil.example.com"})), ErrInvalidToken},
+		{"Wrong audience", signJWT(t, "HS256", "hs", secret, jwtClaims(map[string]interface{}{"aud": "other"})), ErrInvalidToken},
+		{"No audience", signJWT(t, "HS256", "hs", secret, jwtClaims(map[string]interface{}{"aud": nil})), ErrInvalidToken},
+		{"Malformed", "a.b.c", ErrInvalidToken},
+	}
+
+	for _, test := range tests {
+		claims, err := v.Validate(test.Token)
+		if err != test.Err {
+			t.Errorf("%s: Expected error %v, but was %v", test.Name, test.Err, err)
+			continue
+		}
+
+		if err == nil && claims.Subject() != "42" {
+			t.Errorf("%s: Expected subject 42, but was '%s'", test.Name, claims.Subject())
+		}
+	}
+}
@@ -0,0 +1,420 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/episub/spawn/security"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/sirupsen/logrus"
+)
+
+// recoveryCodeCount Number of recovery codes issued on enrolment
+const recoveryCodeCount = 10
+
+// maxMFARequestSize Limit on the size of an MFA request body
+const maxMFARequestSize = 1 << 12
+
+// MFA Functions for storing users' second factors.  When set on Auth, users
+// with a TOTP secret are given a pending session on login, which SessionMW
+// treats as unauthenticated until MFAVerifyHandler accepts a code
+type MFA struct {
+	// Issuer Name shown for the account in authenticator apps
+	Issuer string
+	// CreatePendingSession Creates a short-lived session for a user that has
+	// passed the password step.  GetSession must return it as a
+	// PendingSession reporting true
+	CreatePendingSession func(context.Context, User) (string, time.Time, error)
+	// GetTOTPSecret Returns the user's confirmed TOTP secret, or empty string
+	// if not enrolled
+	GetTOTPSecret func(context.Context, User) (string, error)
+	// SaveTOTPSecret Stores the user's confirmed TOTP secret and hashed
+	// recovery codes, replacing any previous ones
+	SaveTOTPSecret func(ctx context.Context, user User, secret string, recoveryHashes [][]byte) error
+	// GetRecoveryCodes Returns the user's unused hashed recovery codes.
+	// Optional, but recovery codes are only issued and accepted when both it
+	// and UseRecoveryCode are set
+	GetRecoveryCodes func(context.Context, User) ([][]byte, error)
+	// UseRecoveryCode Removes the hashed recovery code, so it can't be used
+	// again
+	UseRecoveryCode func(ctx context.Context, user User, hash []byte) error
+	// UseTOTPStep Called with the time step of each accepted code.  Return an
+	// error if the step is not later than the last one used, to prevent the
+	// same code being used twice
+	UseTOTPStep func(ctx context.Context, user User, step uint64) error
+}
+
+// PendingSession Interface for sessions, reporting whether the session is
+// still waiting on a second factor.  Sessions must implement it when
+// Auth.MFA is set
+type PendingSession interface {
+	GetMFAPending() bool
+}
+
+// errNoPendingSession Returned for sessions that don't implement
+// PendingSession when MFA is set, since a pending session would otherwise
+// pass as fully authenticated
+var errNoPendingSession = errors.New("Sessions must implement PendingSession when Auth.MFA is set")
+
+// sessionPending Returns true if the session is waiting on a second factor.
+// Returns an error if MFA is set but the session can't report whether it's
+// pending
+func (a Auth) sessionPending(session Session) (bool, error) {
+	p, ok := session.(PendingSession)
+	if ok {
+		return p.GetMFAPending(), nil
+	}
+
+	if a.MFA != nil {
+		return false, errNoPendingSession
+	}
+
+	return false, nil
+}
+
+// errNoRecoveryCodes Returned when a recovery code is given but recovery
+// codes aren't enabled
+var errNoRecoveryCodes = errors.New("MFA.GetRecoveryCodes and MFA.UseRecoveryCode must be set to use recovery codes")
+
+// recoveryCodes Returns true if recovery codes are enabled
+func (m *MFA) recoveryCodes() bool {
+	return m.GetRecoveryCodes != nil && m.UseRecoveryCode != nil
+}
+
+// mfa Returns the MFA settings, or an error if they aren't set or are
+// missing the functions needed to prevent codes being replayed
+func (a Auth) mfa() (*MFA, error) {
+	if a.MFA == nil {
+		return nil, errors.New("Auth.MFA must be set to use MFA")
+	}
+
+	if a.MFA.UseTOTPStep == nil {
+		return nil, errors.New("MFA.UseTOTPStep must be set, so that codes can't be replayed")
+	}
+
+	return a.MFA, nil
+}
+
+// mfaRequest Body accepted by the MFA handlers
+type mfaRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+	Secret       string `json:"secret"`
+	CurrentCode  string `json:"currentCode"`
+}
+
+// mfaRequired Returns true if the user has enrolled in MFA
+func (a Auth) mfaRequired(ctx context.Context, user User) (bool, error) {
+	if a.MFA == nil {
+		return false, nil
+	}
+
+	mfa, err := a.mfa()
+	if err != nil {
+		return false, err
+	}
+
+	secret, err := mfa.GetTOTPSecret(ctx, user)
+	return len(secret) > 0, err
+}
+
+// startPendingSession Creates a pending session and sets the session cookie
+func (a Auth) startPendingSession(ctx context.Context, w http.ResponseWriter, user User) error {
+	session, expiry, err := a.MFA.CreatePendingSession(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, a.sessionCookie(session, expiry))
+	return nil
+}
+
+// MFAEnrolHandler Returns a new TOTP secret and its otpauth URI for the
+// current user to add to an authenticator app.  Nothing is stored until the
+// secret is confirmed with MFAConfirmHandler.  Forbidden while
+// impersonating.  Must be used after SessionMW and EnforceAuthenticationMW
+func (a Auth) MFAEnrolHandler(w http.ResponseWriter, r *http.Request) {
+	mfa, err := a.mfa()
+	if err != nil {
+		log.WithField("error", err).Error("MFA is not configured")
+		writeStatusError(w, http.StatusInternalServerError, "Could not start enrolment")
+		return
+	}
+
+	if refuseImpersonation(w, r) {
+		return
+	}
+
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		a.SetUnauthorised(w, r)
+		return
+	}
+
+	secret, err := security.NewTOTPSecret()
+	if err != nil {
+		log.WithField("error", err).Error("Failed to generate TOTP secret")
+		writeStatusError(w, http.StatusInternalServerError, "Could not start enrolment")
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"secret": secret,
+		"uri":    security.TOTPURI(mfa.Issuer, user.GetID(), secret),
+	})
+}
+
+// MFAConfirmHandler Accepts the secret from MFAEnrolHandler along with a code
+// generated from it, and if valid stores the secret and returns new recovery
+// codes, if enabled.  The codes are only ever shown this once.  Users already enrolled
+// must also provide a code from their current secret as currentCode.
+// Forbidden while impersonating
+func (a Auth) MFAConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	span, ctx := opentracing.StartSpanFromContext(r.Context(), "mfaConfirmHandler")
+	defer span.Finish()
+
+	mfa, err := a.mfa()
+	if err != nil {
+		log.WithField("error", err).Error("MFA is not configured")
+		writeStatusError(w, http.StatusInternalServerError, "Could not confirm enrolment")
+		return
+	}
+
+	if refuseImpersonation(w, r) {
+		return
+	}
+
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		a.SetUnauthorised(w, r)
+		return
+	}
+
+	req, err := readMFARequest(w, r)
+	if err != nil {
+		writeStatusError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	current, err := mfa.GetTOTPSecret(ctx, user)
+	if err != nil {
+		log.WithField("error", err).Error("Failed to fetch TOTP secret")
+		writeStatusError(w, http.StatusInternalServerError, "Could not confirm enrolment")
+		return
+	}
+
+	if len(current) > 0 {
+		step, err := security.ValidateTOTP(current, req.CurrentCode, time.Now())
+		if err == nil {
+			err = mfa.UseTOTPStep(ctx, user, step)
+		}
+		if err != nil {
+			writeStatusError(w, http.StatusForbidden, "Invalid current code")
+			return
+		}
+	}
+
+	if _, err := security.ValidateTOTP(req.Secret, req.Code, time.Now()); err != nil {
+		writeStatusError(w, http.StatusForbidden, "Invalid code")
+		return
+	}
+
+	codes := []string{}
+	if mfa.recoveryCodes() {
+		codes, err = security.NewRecoveryCodes(recoveryCodeCount)
+		if err != nil {
+			log.WithField("error", err).Error("Failed to generate recovery codes")
+			writeStatusError(w, http.StatusInternalServerError, "Could not confirm enrolment")
+			return
+		}
+	}
+
+	hashes := make([][]byte, len(codes))
+	for i, c := range codes {
+		hashes[i], err = security.HashRecoveryCode(c)
+		if err != nil {
+			log.WithField("error", err).Error("Failed to hash recovery code")
+			writeStatusError(w, http.StatusInternalServerError, "Could not confirm enrolment")
+			return
+		}
+	}
+
+	err = mfa.SaveTOTPSecret(ctx, user, req.Secret, hashes)
+	if err != nil {
+		log.WithField("error", err).Error("Failed to save TOTP secret")
+		writeStatusError(w, http.StatusInternalServerError, "Could not confirm enrolment")
+		return
+	}
+
+	log.WithField("user", user.GetID()).Info("MFA enrolled")
+	writeJSON(w, map[string]interface{}{"recoveryCodes": codes})
+}
+
+// MFAVerifyHandler Completes login for a pending session, given either a
+// TOTP code or an unused recovery code.  On success the pending session is
+// replaced with a full session.  Use without SessionMW, since SessionMW
+// doesn't accept pending sessions
+func (a Auth) MFAVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	span, ctx := opentracing.StartSpanFromContext(r.Context(), "mfaVerifyHandler")
+	defer span.Finish()
+
+	mfa, err := a.mfa()
+	if err != nil {
+		log.WithField("error", err).Error("MFA is not configured")
+		writeStatusError(w, http.StatusInternalServerError, "Could not verify code")
+		return
+	}
+
+	session, user, err := a.pendingSession(r)
+	if err != nil {
+		log.WithField("error", err).Info("Rejected MFA verification")
+		a.SetUnauthorised(w, r)
+		return
+	}
+
+	var attempt *LoginAttempt
+	if a.Throttle != nil {
+		attempt, err = a.Throttle.Attempt(ctx, mfaThrottleKey(user), a.Throttle.clientIP(r))
+		var terr ThrottledError
+		if errors.As(err, &terr) {
+			w.Header().Set("Retry-After", strconv.Itoa(retrySeconds(terr.RetryAfter)))
+			writeStatusError(w, http.StatusTooManyRequests, terr.Error())
+			return
+		}
+		if err != nil {
+			log.WithField("error", err).Error("Failed to check MFA attempts")
+			writeStatusError(w, http.StatusInternalServerError, "Could not verify code")
+			return
+		}
+	}
+
+	req, err := readMFARequest(w, r)
+	if err != nil {
+		writeStatusError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	err = verifySecondFactor(ctx, mfa, user, req)
+	if err != nil {
+		log.WithFields(logrus.Fields{"error": err, "user": user.GetID()}).Info("Failed second factor")
+		if attempt != nil {
+			if ferr := attempt.Failed(ctx); ferr != nil {
+				log.WithField("error", ferr).Error("Failed to record failed MFA attempt")
+			}
+		}
+		writeStatusError(w, http.StatusForbidden, "Invalid code")
+		return
+	}
+
+	if attempt != nil {
+		if serr := attempt.Succeeded(ctx); serr != nil {
+			log.WithField("error", serr).Error("Failed to reset MFA attempts")
+		}
+	}
+
+	err = session.Destroy(ctx)
+	if err != nil {
+		log.WithField("error", err).Error("Failed to destroy pending session")
+	}
+
+	_, err = a.startSession(ctx, w, user)
+	if err != nil {
+		log.WithField("error", err).Error("Failed to create session")
+		writeStatusError(w, http.StatusInternalServerError, "Could not create session")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func mfaThrottleKey(user User) string {
+	return "mfa:" + user.GetID()
+}
+
+// pendingSession Returns the pending session sent with the request, and its
+// user
+func (a Auth) pendingSession(r *http.Request) (Session, User, error) {
+	id, ok := bearerToken(r)
+	if !ok {
+		c, err := r.Cookie(a.CookieName)
+		if err != nil {
+			return nil, nil, fmt.Errorf("No session")
+		}
+		id = c.Value
+	}
+
+	session, err := a.GetSession(r.Context(), id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pending, err := a.sessionPending(session)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !pending {
+		return nil, nil, fmt.Errorf("Session is not pending MFA")
+	}
+
+	if time.Now().After(session.GetExpiry()) {
+		return nil, nil, fmt.Errorf("Pending session expired")
+	}
+
+	user, err := session.GetUser(r.Context())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if user.GetInactive() {
+		return nil, nil, fmt.Errorf("User inactive")
+	}
+
+	return session, user, nil
+}
+
+// verifySecondFactor Checks the TOTP code or recovery code in the request
+func verifySecondFactor(ctx context.Context, mfa *MFA, user User, req mfaRequest) error {
+	if len(req.RecoveryCode) > 0 {
+		if !mfa.recoveryCodes() {
+			return errNoRecoveryCodes
+		}
+
+		hashes, err := mfa.GetRecoveryCodes(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		i := security.MatchRecoveryCode(ctx, hashes, req.RecoveryCode)
+		if i < 0 {
+			return security.ErrInvalidCode
+		}
+
+		log.WithField("user", user.GetID()).Info("Recovery code used")
+		return mfa.UseRecoveryCode(ctx, user, hashes[i])
+	}
+
+	secret, err := mfa.GetTOTPSecret(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	step, err := security.ValidateTOTP(secret, req.Code, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return mfa.UseTOTPStep(ctx, user, step)
+}
+
+func readMFARequest(w http.ResponseWriter, r *http.Request) (mfaRequest, error) {
+	var req mfaRequest
+
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMFARequestSize)).Decode(&req)
+	return req, err
+}
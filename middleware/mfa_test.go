@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/episub/spawn/security"
+)
+
+type testSession struct {
+	id   string
+	user User
+}
+
+func (s testSession) GetUser(context.Context) (User, error) { return s.user, nil }
+func (s testSession) Destroy(context.Context) error         { return nil }
+func (s testSession) GetExpiry() time.Time                  { return time.Now().Add(time.Hour) }
+func (s testSession) GetID() string                         { return s.id }
+
+type testPendingSession struct {
+	testSession
+	pending bool
+}
+
+func (s testPendingSession) GetMFAPending() bool { return s.pending }
+
+// newMFATest Returns an Auth whose sessions are pending if their id starts
+// with "pending", for a user enrolled with secret
+func newMFATest(secret string) Auth {
+	var lastStep uint64
+
+	return Auth{
+		CookieName: "session",
+		CreateSession: func(ctx context.Context, u User) (string, time.Time, error) {
+			return "full", time.Now().Add(time.Hour), nil
+		},
+		GetSession: func(ctx context.Context, id string) (Session, error) {
+			return testPendingSession{testSession{id, testUser("42")}, strings.HasPrefix(id, "pending")}, nil
+		},
+		MFA: &MFA{
+			GetTOTPSecret: func(context.Context, User) (string, error) { return secret, nil },
+			UseTOTPStep: func(ctx context.Context, u User, step uint64) error {
+				if step <= lastStep {
+					return fmt.Errorf("Step already used")
+				}
+				lastStep = step
+				return nil
+			},
+		},
+	}
+}
+
+func TestSessionMWPending(t *testing.T) {
+	a := newMFATest("")
+
+	var tests = []struct {
+		Name          string
+		GetSession    func(context.Context, string) (Session, error)
+		Status        int
+		Authenticated bool
+	}{
+		{"Full", a.GetSession, http.StatusOK, true},
+		{"Pending", func(ctx context.Context, id string) (Session, error) {
+			return testPendingSession{testSession{id, testUser("42")}, true}, nil
+		}, http.StatusOK, false},
+		{"Without PendingSession", func(ctx context.Context, id string) (Session, error) {
+			return testSession{id, testUser("42")}, nil
+		}, http.StatusUnauthorized, false},
+	}
+
+	for _, test := range tests {
+		a.GetSession = test.GetSession
+
+		var authenticated bool
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, authenticated = UserFromContext(r.Context())
+		})
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer session-1")
+		w := httptest.NewRecorder()
+		a.SessionMW(next).ServeHTTP(w, r)
+
+		if w.Code != test.Status || authenticated != test.Authenticated {
+			t.Errorf("%s: Expected status %d and authenticated %t, but was %d and %t", test.Name, test.Status, test.Authenticated, w.Code, authenticated)
+		}
+	}
+}
+
+func TestMFAVerifyReplay(t *testing.T) {
+	secret, err := security.NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := security.TOTPCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := newMFATest(secret)
+
+	verify := func() int {
+		r := httptest.NewRequest(http.MethodPost, "/mfa/verify", strings.NewReader(`{"code":"`+code+`"}`))
+		r.Header.Set("Authorization", "Bearer pending-1")
+		w := httptest.NewRecorder()
+		a.MFAVerifyHandler(w, r)
+		return w.Code
+	}
+
+	if status := verify(); status != http.StatusOK {
+		t.Fatalf("Expected code accepted, but was %d", status)
+	}
+
+	if status := verify(); status != http.StatusForbidden {
+		t.Errorf("Expected replayed code rejected, but was %d", status)
+	}
+}
+
+func TestMFAMisconfigured(t *testing.T) {
+	withoutStep := newMFATest("secret")
+	withoutStep.MFA.UseTOTPStep = nil
+
+	withoutMFA := newMFATest("")
+	withoutMFA.MFA = nil
+
+	var tests = []struct {
+		Name    string
+		Handler http.HandlerFunc
+	}{
+		{"Verify without UseTOTPStep", withoutStep.MFAVerifyHandler},
+		{"Enrol without UseTOTPStep", withoutStep.MFAEnrolHandler},
+		{"Enrol without MFA", withoutMFA.MFAEnrolHandler},
+		{"Confirm without MFA", withoutMFA.MFAConfirmHandler},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/mfa", strings.NewReader(`{"code":"123456"}`))
+		r.Header.Set("Authorization", "Bearer pending-1")
+		r = r.WithContext(WithUser(r.Context(), testUser("42")))
+		w := httptest.NewRecorder()
+		test.Handler(w, r)
+
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("%s: Expected error, but was %d", test.Name, w.Code)
+		}
+	}
+
+	if _, err := withoutStep.mfaRequired(context.Background(), testUser("42")); err == nil {
+		t.Errorf("Expected login to fail without UseTOTPStep")
+	}
+}
+
+func TestMFAWithoutRecoveryCodes(t *testing.T) {
+	secret, err := security.NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := security.TOTPCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := newMFATest("")
+	var saved [][]byte
+	a.MFA.SaveTOTPSecret = func(ctx context.Context, u User, secret string, recoveryHashes [][]byte) error {
+		saved = recoveryHashes
+		return nil
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/mfa/confirm", strings.NewReader(`{"secret":"`+secret+`","code":"`+code+`"}`))
+	r = r.WithContext(WithUser(r.Context(), testUser("42")))
+	w := httptest.NewRecorder()
+	a.MFAConfirmHandler(w, r)
+
+	if w.Code != http.StatusOK || len(saved) != 0 || !strings.Contains(w.Body.String(), `"recoveryCodes":[]`) {
+		t.Errorf("Expected enrolment without recovery codes, but was %d with %d saved: %s", w.Code, len(saved), w.Body.String())
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/mfa/verify", strings.NewReader(`{"recoveryCode":"abcd-efgh-ijkl-mnop"}`))
+	r.Header.Set("Authorization", "Bearer pending-1")
+	w = httptest.NewRecorder()
+	a.MFAVerifyHandler(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected recovery code refused, but was %d", w.Code)
+	}
+}
@@ -0,0 +1,479 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultOIDCCookieName = "oidc_state"
+	// oidcStateLifetime How long the user has to sign in with the provider
+	oidcStateLifetime = 10 * time.Minute
+	// defaultJWKSRefetchInterval Minimum time between fetching the keys again
+	defaultJWKSRefetchInterval = 5 * time.Minute
+)
+
+// OIDC An OpenID Connect provider to sign in with, using the authorization
+// code flow with PKCE.  Endpoints are found with Discover, unless set
+type OIDC struct {
+	// Issuer The provider's issuer, e.g., https://accounts.google.com
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL Where the provider sends the user back to, which must be
+	// routed to OIDCCallbackHandler
+	RedirectURL string
+	// Scopes Defaults to openid, email and profile
+	Scopes []string
+	// ClaimsUser Returns the user for the claims of a validated ID token,
+	// e.g., by looking up or creating a user with the 'email' claim
+	ClaimsUser func(context.Context, Claims) (User, error)
+	// AfterLogin Where to send the user once signed in.  Defaults to "/"
+	AfterLogin string
+	// MFAStep Where to send users enrolled in MFA, with a pending session,
+	// to enter their second factor with MFAVerifyHandler.  Required when
+	// Auth.MFA is set
+	MFAStep string
+	// TrustProviderMFA When true, users enrolled in MFA get a full session
+	// without a second factor if the ID token's 'amr' claim includes 'mfa'.
+	// Off by default, since it relies on the provider's MFA instead of ours
+	TrustProviderMFA bool
+	// CookieName Cookie holding the state of a sign in while the user is
+	// with the provider.  Defaults to oidc_state, and must differ between
+	// providers
+	CookieName string
+	// Client Used for requests to the provider.  Defaults to
+	// http.DefaultClient
+	Client *http.Client
+
+	AuthorizationEndpoint string
+	TokenEndpoint         string
+	JWKSURI               string
+	// JWKSRefetchInterval Minimum time between fetching the keys again when
+	// an ID token is signed by an unknown key.  Defaults to 5 minutes
+	JWKSRefetchInterval time.Duration
+
+	validator    *JWTValidator
+	refetchMutex sync.Mutex
+	lastRefetch  time.Time
+}
+
+// oidcState Kept in a cookie between the redirect and callback
+type oidcState struct {
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+}
+
+// NewOIDC Returns a provider with its endpoints and keys discovered from the
+// issuer
+func NewOIDC(
+	ctx context.Context,
+	issuer string,
+	clientID string,
+	clientSecret string,
+	redirectURL string,
+	claimsUser func(context.Context, Claims) (User, error),
+) (*OIDC, error) {
+	o := &OIDC{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		ClaimsUser:   claimsUser,
+	}
+
+	return o, o.Discover(ctx)
+}
+
+func (o *OIDC) client() *http.Client {
+	if o.Client != nil {
+		return o.Client
+	}
+
+	return http.DefaultClient
+}
+
+func (o *OIDC) cookieName() string {
+	if len(o.CookieName) > 0 {
+		return o.CookieName
+	}
+
+	return defaultOIDCCookieName
+}
+
+// Discover Fetches any endpoints not already set from the issuer's
+// /.well-known/openid-configuration, then loads the signing keys
+func (o *OIDC) Discover(ctx context.Context) error {
+	if len(o.AuthorizationEndpoint) == 0 || len(o.TokenEndpoint) == 0 || len(o.JWKSURI) == 0 {
+		var config struct {
+			Issuer                string `json:"issuer"`
+			AuthorizationEndpoint string `json:"authorization_endpoint"`
+			TokenEndpoint         string `json:"token_endpoint"`
+			JWKSURI               string `json:"jwks_uri"`
+		}
+
+		err := o.getJSON(ctx, strings.TrimSuffix(o.Issuer, "/")+"/.well-known/openid-configuration", &config)
+		if err != nil {
+			return err
+		}
+
+		if config.Issuer != o.Issuer {
+			return fmt.Errorf("Discovered issuer %s does not match %s", config.Issuer, o.Issuer)
+		}
+
+		if len(o.AuthorizationEndpoint) == 0 {
+			o.AuthorizationEndpoint = config.AuthorizationEndpoint
+		}
+		if len(o.TokenEndpoint) == 0 {
+			o.TokenEndpoint = config.TokenEndpoint
+		}
+		if len(o.JWKSURI) == 0 {
+			o.JWKSURI = config.JWKSURI
+		}
+	}
+
+	o.validator = NewJWTValidator(o.Issuer, o.ClientID)
+	return o.validator.FetchJWKS(ctx, o.client(), o.JWKSURI)
+}
+
+func (o *OIDC) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := o.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Fetching %s returned status %d", url, res.StatusCode)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// randomString Returns n random bytes, base64url encoded
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := io.ReadFull(rand.Reader, b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// pkceChallenge Returns the S256 code challenge for the verifier
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// OIDCLoginHandler Redirects the user to the provider to sign in
+func (a Auth) OIDCLoginHandler(o *OIDC) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var state oidcState
+		var err error
+
+		for _, s := range []*string{&state.State, &state.Nonce, &state.Verifier} {
+			*s, err = randomString(32)
+			if err != nil {
+				log.WithField("error", err).Error("Failed to generate OIDC state")
+				writeStatusError(w, http.StatusInternalServerError, "Could not start sign in")
+				return
+			}
+		}
+
+		b, err := json.Marshal(state)
+		if err != nil {
+			log.WithField("error", err).Error("Failed to encode OIDC state")
+			writeStatusError(w, http.StatusInternalServerError, "Could not start sign in")
+			return
+		}
+
+		c := a.cookie(o.cookieName(), base64.RawURLEncoding.EncodeToString(b), time.Now().Add(oidcStateLifetime), true)
+		// The callback is a cross-site navigation from the provider, which a
+		// strict cookie wouldn't be sent with:
+		c.SameSite = http.SameSiteLaxMode
+		http.SetCookie(w, c)
+
+		scopes := o.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{"openid", "email", "profile"}
+		}
+
+		v := url.Values{}
+		v.Set("response_type", "code")
+		v.Set("client_id", o.ClientID)
+		v.Set("redirect_uri", o.RedirectURL)
+		v.Set("scope", strings.Join(scopes, " "))
+		v.Set("state", state.State)
+		v.Set("nonce", state.Nonce)
+		v.Set("code_challenge", pkceChallenge(state.Verifier))
+		v.Set("code_challenge_method", "S256")
+
+		sep := "?"
+		if strings.Contains(o.AuthorizationEndpoint, "?") {
+			sep = "&"
+		}
+
+		http.Redirect(w, r, o.AuthorizationEndpoint+sep+v.Encode(), http.StatusFound)
+	}
+}
+
+// OIDCCallbackHandler Completes sign in when the provider redirects back,
+// exchanging the code for an ID token, validating it, and starting a session
+// for the user returned by ClaimsUser
+func (a Auth) OIDCCallbackHandler(o *OIDC) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		span, ctx := opentracing.StartSpanFromContext(r.Context(), "oidcCallbackHandler")
+		defer span.Finish()
+
+		state, err := o.readState(r)
+		http.SetCookie(w, a.cookie(o.cookieName(), "", time.Unix(0, 0), true))
+		if err != nil {
+			log.WithField("error", err).Info("Rejected OIDC callback")
+			writeStatusError(w, http.StatusForbidden, "Invalid sign in request")
+			return
+		}
+
+		q := r.URL.Query()
+		if e := q.Get("error"); len(e) > 0 {
+			log.WithFields(logrus.Fields{"error": e, "description": q.Get("error_description")}).Info("Provider declined sign in")
+			writeStatusError(w, http.StatusForbidden, "Sign in was not completed")
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(state.State)) != 1 {
+			log.Warning("OIDC callback state mismatch")
+			writeStatusError(w, http.StatusForbidden, "Invalid sign in request")
+			return
+		}
+
+		idToken, err := o.exchange(ctx, q.Get("code"), state.Verifier)
+		if err != nil {
+			log.WithField("error", err).Error("Failed to exchange OIDC code")
+			writeStatusError(w, http.StatusBadGateway, "Could not complete sign in")
+			return
+		}
+
+		claims, err := o.validate(ctx, idToken)
+		if err != nil {
+			log.WithField("error", err).Warning("Rejected OIDC ID token")
+			writeStatusError(w, http.StatusForbidden, "Invalid sign in request")
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(claims.String("nonce")), []byte(state.Nonce)) != 1 {
+			log.Warning("OIDC ID token nonce mismatch")
+			writeStatusError(w, http.StatusForbidden, "Invalid sign in request")
+			return
+		}
+
+		user, err := o.ClaimsUser(ctx, claims)
+		if err != nil {
+			log.WithFields(logrus.Fields{"error": err, "subject": claims.Subject()}).Info("No user for OIDC claims")
+			writeStatusError(w, http.StatusForbidden, getSafeError(err, "Invalid login credential(s)"))
+			return
+		}
+
+		if user.GetInactive() {
+			writeStatusError(w, http.StatusForbidden, "Invalid login credential(s)")
+			return
+		}
+
+		// As with password logins, don't share a session across machines:
+		a.DestroySession(r)
+
+		required, err := a.mfaRequired(ctx, user)
+		if err != nil {
+			log.WithField("error", err).Error("Failed to check MFA enrolment")
+			writeStatusError(w, http.StatusInternalServerError, "Could not create session")
+			return
+		}
+
+		if required && !(o.TrustProviderMFA && providerMFA(claims)) {
+			if len(o.MFAStep) == 0 {
+				log.Error("OIDC.MFAStep must be set when Auth.MFA is set")
+				writeStatusError(w, http.StatusInternalServerError, "Could not create session")
+				return
+			}
+
+			err = a.startPendingSession(ctx, w, user)
+			if err != nil {
+				log.WithField("error", err).Error("Failed to create pending session")
+				writeStatusError(w, http.StatusInternalServerError, "Could not create session")
+				return
+			}
+
+			http.Redirect(w, r, o.MFAStep, http.StatusFound)
+			return
+		}
+
+		_, err = a.startSession(ctx, w, user)
+		if err != nil {
+			log.WithField("error", err).Error("Failed to create session")
+			writeStatusError(w, http.StatusInternalServerError, "Could not create session")
+			return
+		}
+
+		after := o.AfterLogin
+		if len(after) == 0 {
+			after = "/"
+		}
+
+		http.Redirect(w, r, after, http.StatusFound)
+	}
+}
+
+// providerMFA Returns true if the claims say the provider used more than one
+// factor, with 'mfa' in the 'amr' claim
+func providerMFA(claims Claims) bool {
+	amr, _ := claims["amr"].([]interface{})
+	for _, m := range amr {
+		if m == "mfa" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readState Returns the state stored in the cookie by OIDCLoginHandler
+func (o *OIDC) readState(r *http.Request) (oidcState, error) {
+	var state oidcState
+
+	c, err := r.Cookie(o.cookieName())
+	if err != nil {
+		return state, fmt.Errorf("No OIDC state cookie")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(c.Value)
+	if err != nil {
+		return state, err
+	}
+
+	err = json.Unmarshal(b, &state)
+	if err != nil {
+		return state, err
+	}
+
+	if len(state.State) == 0 || len(state.Nonce) == 0 || len(state.Verifier) == 0 {
+		return state, fmt.Errorf("Incomplete OIDC state")
+	}
+
+	return state, nil
+}
+
+// exchange Swaps the authorization code for an ID token at the token endpoint
+func (o *OIDC) exchange(ctx context.Context, code string, verifier string) (string, error) {
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", o.RedirectURL)
+	v.Set("client_id", o.ClientID)
+	v.Set("code_verifier", verifier)
+	if len(o.ClientSecret) > 0 {
+		v.Set("client_secret", o.ClientSecret)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, o.TokenEndpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := o.client().Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Token endpoint returned status %d: %s", res.StatusCode, b)
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+
+	err = json.Unmarshal(b, &token)
+	if err != nil {
+		return "", err
+	}
+
+	if len(token.IDToken) == 0 {
+		return "", fmt.Errorf("Token endpoint did not return an ID token")
+	}
+
+	return token.IDToken, nil
+}
+
+// validate Validates the ID token.  If its key is unknown or the signature
+// doesn't match, the keys are fetched again in case the provider has rotated
+// them, at most once per JWKSRefetchInterval
+func (o *OIDC) validate(ctx context.Context, idToken string) (Claims, error) {
+	if o.validator == nil {
+		return nil, fmt.Errorf("OIDC provider has not been discovered")
+	}
+
+	claims, err := o.validator.validate(idToken)
+	if err != errSignature {
+		return claims, err
+	}
+
+	if !o.mayRefetchJWKS() {
+		return nil, ErrInvalidToken
+	}
+
+	if ferr := o.validator.FetchJWKS(ctx, o.client(), o.JWKSURI); ferr != nil {
+		return nil, ferr
+	}
+
+	return o.validator.Validate(idToken)
+}
+
+// mayRefetchJWKS Returns true, and records the time, if the keys haven't been
+// fetched again within JWKSRefetchInterval.  Stops tokens signed by unknown
+// keys from making a request to the provider each
+func (o *OIDC) mayRefetchJWKS() bool {
+	o.refetchMutex.Lock()
+	defer o.refetchMutex.Unlock()
+
+	interval := o.JWKSRefetchInterval
+	if interval == 0 {
+		interval = defaultJWKSRefetchInterval
+	}
+
+	if !o.lastRefetch.IsZero() && time.Since(o.lastRefetch) < interval {
+		return false
+	}
+
+	o.lastRefetch = time.Now()
+	return true
+}
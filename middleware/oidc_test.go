@@ -0,0 +1,331 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// stubIDP A minimal OpenID Connect provider, which issues an ID token for
+// whichever code and nonce the test sets
+type stubIDP struct {
+	server      *httptest.Server
+	key         *rsa.PrivateKey
+	code        string
+	nonce       string
+	challenge   string
+	amr         []string
+	jwksFetches int
+}
+
+func newStubIDP(t *testing.T) *stubIDP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &stubIDP{key: key}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.jwksFetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+			}},
+		})
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("code") != idp.code || pkceChallenge(r.PostForm.Get("code_verifier")) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_grant"}`)
+			return
+		}
+
+		claims := map[string]interface{}{
+			"iss":   idp.server.URL,
+			"aud":   "client",
+			"sub":   "42",
+			"nonce": idp.nonce,
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}
+		if idp.amr != nil {
+			claims["amr"] = idp.amr
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.sign(t, claims)})
+	})
+
+	idp.server = httptest.NewServer(mux)
+	return idp
+}
+
+func (idp *stubIDP) sign(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test"})
+	payload, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signed))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+type testUser string
+
+func (u testUser) GetID() string     { return string(u) }
+func (u testUser) GetInactive() bool { return false }
+
+// startOIDCLogin Runs the login handler and plays the provider's part, returning
+// the callback request the provider would redirect to
+func startOIDCLogin(t *testing.T, a Auth, o *OIDC, idp *stubIDP) *http.Request {
+	w := httptest.NewRecorder()
+	a.OIDCLoginHandler(o)(w, httptest.NewRequest(http.MethodGet, "/login", nil))
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected redirect, but was %d", w.Code)
+	}
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := location.Query()
+	if q.Get("code_challenge_method") != "S256" || len(q.Get("code_challenge")) == 0 {
+		t.Fatalf("Expected PKCE challenge in %s", location)
+	}
+
+	idp.code = "code-1"
+	idp.nonce = q.Get("nonce")
+	idp.challenge = q.Get("code_challenge")
+
+	r := httptest.NewRequest(http.MethodGet, "/callback?code=code-1&state="+url.QueryEscape(q.Get("state")), nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+
+	return r
+}
+
+func newOIDCTest(t *testing.T) (Auth, *OIDC, *stubIDP) {
+	idp := newStubIDP(t)
+
+	o, err := NewOIDC(context.Background(), idp.server.URL, "client", "secret", "http://app/callback", func(ctx context.Context, c Claims) (User, error) {
+		return testUser(c.Subject()), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := Auth{
+		CookieName: "session",
+		CreateSession: func(ctx context.Context, u User) (string, time.Time, error) {
+			return "session-" + u.GetID(), time.Now().Add(time.Hour), nil
+		},
+		GetSession: func(ctx context.Context, id string) (Session, error) {
+			return nil, fmt.Errorf("No session")
+		},
+	}
+
+	return a, o, idp
+}
+
+func TestOIDCLogin(t *testing.T) {
+	a, o, idp := newOIDCTest(t)
+	defer idp.server.Close()
+
+	w := httptest.NewRecorder()
+	a.OIDCCallbackHandler(o)(w, startOIDCLogin(t, a, o, idp))
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected redirect after login, but was %d: %s", w.Code, w.Body.String())
+	}
+
+	if session := sessionCookie(w); session != "session-42" {
+		t.Errorf("Expected session cookie for user 42, but was '%s'", session)
+	}
+}
+
+// sessionCookie Returns the session cookie set in the response
+func sessionCookie(w *httptest.ResponseRecorder) string {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "session" {
+			return c.Value
+		}
+	}
+
+	return ""
+}
+
+func TestOIDCLoginMFA(t *testing.T) {
+	a, o, idp := newOIDCTest(t)
+	defer idp.server.Close()
+
+	a.MFA = &MFA{
+		CreatePendingSession: func(ctx context.Context, u User) (string, time.Time, error) {
+			return "pending-" + u.GetID(), time.Now().Add(5 * time.Minute), nil
+		},
+		GetTOTPSecret: func(context.Context, User) (string, error) { return "JBSWY3DPEHPK3PXP", nil },
+		UseTOTPStep:   func(context.Context, User, uint64) error { return nil },
+	}
+	o.MFAStep = "/mfa"
+
+	var tests = []struct {
+		Name     string
+		Trust    bool
+		AMR      []string
+		MFAStep  string
+		Status   int
+		Location string
+		Session  string
+	}{
+		{"Enrolled", false, nil, "/mfa", http.StatusFound, "/mfa", "pending-42"},
+		{"Provider MFA not trusted", false, []string{"pwd", "mfa"}, "/mfa", http.StatusFound, "/mfa", "pending-42"},
+		{"Trusted without provider MFA", true, []string{"pwd"}, "/mfa", http.StatusFound, "/mfa", "pending-42"},
+		{"Trusted provider MFA", true, []string{"pwd", "mfa"}, "/mfa", http.StatusFound, "/", "session-42"},
+		{"No MFA step", false, nil, "", http.StatusInternalServerError, "", ""},
+	}
+
+	for _, test := range tests {
+		o.TrustProviderMFA = test.Trust
+		o.MFAStep = test.MFAStep
+		idp.amr = test.AMR
+
+		w := httptest.NewRecorder()
+		a.OIDCCallbackHandler(o)(w, startOIDCLogin(t, a, o, idp))
+
+		if w.Code != test.Status || w.Header().Get("Location") != test.Location {
+			t.Errorf("%s: Expected %d to '%s', but was %d to '%s'", test.Name, test.Status, test.Location, w.Code, w.Header().Get("Location"))
+		}
+
+		if session := sessionCookie(w); session != test.Session {
+			t.Errorf("%s: Expected session '%s', but was '%s'", test.Name, test.Session, session)
+		}
+	}
+}
+
+func TestOIDCLoginRejected(t *testing.T) {
+	a, o, idp := newOIDCTest(t)
+	defer idp.server.Close()
+
+	var tests = []struct {
+		Name   string
+		Modify func(r *http.Request)
+	}{
+		{Name: "State mismatch", Modify: func(r *http.Request) {
+			q := r.URL.Query()
+			q.Set("state", "wrong")
+			r.URL.RawQuery = q.Encode()
+		}},
+		{Name: "Wrong nonce", Modify: func(r *http.Request) {
+			idp.nonce = "wrong"
+		}},
+		{Name: "Wrong code", Modify: func(r *http.Request) {
+			idp.code = "code-2"
+		}},
+		{Name: "Missing state cookie", Modify: func(r *http.Request) {
+			r.Header.Del("Cookie")
+		}},
+	}
+
+	for _, test := range tests {
+		r := startOIDCLogin(t, a, o, idp)
+		test.Modify(r)
+
+		w := httptest.NewRecorder()
+		a.OIDCCallbackHandler(o)(w, r)
+
+		if w.Code == http.StatusFound {
+			t.Errorf("%s: Expected login to be rejected", test.Name)
+		}
+	}
+}
+
+func TestOIDCRefetchJWKS(t *testing.T) {
+	_, o, idp := newOIDCTest(t)
+	defer idp.server.Close()
+
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss": idp.server.URL,
+			"aud": "client",
+			"sub": "42",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range changes {
+			c[k] = v
+		}
+		return c
+	}
+
+	rotated, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unknown, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		Name    string
+		Key     *rsa.PrivateKey
+		Claims  map[string]interface{}
+		Err     error
+		Fetches int
+	}{
+		{"Wrong audience", nil, claims(map[string]interface{}{"aud": "other"}), ErrInvalidToken, 0},
+		{"Wrong issuer", nil, claims(map[string]interface{}{"iss": "https://evil.example.com"}), ErrInvalidToken, 0},
+		{"Expired", nil, claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}), ErrExpiredToken, 0},
+		{"Rotated key", rotated, claims(nil), nil, 1},
+		{"Unknown key within interval", unknown, claims(nil), ErrInvalidToken, 0},
+	}
+
+	for _, test := range tests {
+		if test.Key != nil {
+			idp.key = test.Key
+		}
+
+		fetches := idp.jwksFetches
+		_, err := o.validate(context.Background(), idp.sign(t, test.Claims))
+
+		if err != test.Err {
+			t.Errorf("%s: Expected error %v, but was %v", test.Name, test.Err, err)
+		}
+
+		if idp.jwksFetches-fetches != test.Fetches {
+			t.Errorf("%s: Expected %d fetches of the keys, but was %d", test.Name, test.Fetches, idp.jwksFetches-fetches)
+		}
+	}
+}
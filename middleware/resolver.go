@@ -2,10 +2,10 @@ package middleware
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"reflect"
 	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf8"
 
@@ -18,10 +18,11 @@ import (
 	otlog "github.com/opentracing/opentracing-go/log"
 	"github.com/sirupsen/logrus"
 	"github.com/vektah/gqlparser/gqlerror"
-	reflections "gopkg.in/oleiade/reflections.v1"
 )
 
-// DefaultPayloadFunc Called to fetch default payload
+// DefaultPayloadFunc Called to fetch default payload, with the object and
+// field names.  The field name is empty when the payload is for all fields of
+// the object, as it is for allowedFields policies
 type DefaultPayloadFunc func(context.Context, string, string, map[string]interface{}) error
 
 // RequestPayloadFunc Returns data specific to particular payloads
@@ -29,10 +30,7 @@ type RequestPayloadFunc func(context.Context, string, string, map[string]interfa
 
 // CheckAccess Used to determine a first-pass access to a query.  Can check basic things like, is this user logged in?
 func CheckAccess(ctx context.Context, prefix string, object string, input map[string]interface{}) (bool, error) {
-	user := ctx.Value("user")
-	if user != nil {
-		input["user"] = user
-	}
+	AddUserInput(ctx, input)
 	return opa.Allow(ctx, getAuthString(prefix, object, "access"), input)
 }
 
@@ -197,7 +195,8 @@ func ResolverMiddleware(
 }
 
 // runAllowCheck Returns reason, if given one, and error.  Error may contain
-// the reason as well.
+// the reason as well.  Arguments named user, actor or scopes take the place
+// of the current user's values in the input
 func runAllowCheck(
 	ctx context.Context,
 	requestPayload func(context.Context, string, string, map[string]interface{}) error,
@@ -206,6 +205,10 @@ func runAllowCheck(
 ) (string, interface{}, error) {
 	input := make(map[string]interface{})
 
+	// Added first, so that results and arguments with the same names aren't
+	// overwritten:
+	AddUserInput(ctx, input)
+
 	dataMap, ok := data.(map[string]interface{})
 	if ok {
 		mergeMap(input, dataMap)
@@ -249,125 +252,162 @@ func OpentracingResolverMiddleware() graphql.FieldMiddleware {
 	}
 }
 
-func getField(object interface{}, fieldName string) (field string, err error) {
-	defer func() {
-		if recover() != nil {
-			err = errors.New("Failed to get field on object")
+// EnableViewFieldFallback When true, objects without an allowedFields policy
+// fall back to the deprecated viewField policy, which is evaluated once per
+// field.  Only intended to help migrate existing policies, and will be removed
+var EnableViewFieldFallback = false
+
+// authorisedStrings Evaluates allowedFields policies.  Replaced in tests
+var authorisedStrings = opa.AuthorisedStrings
+
+// fieldDecision The fields of a single entity the user may view.  Evaluated
+// once, and shared by all the field resolvers for that entity
+type fieldDecision struct {
+	once      sync.Once
+	fields    map[string]bool
+	undefined bool // True if there is no allowedFields policy for the object
+	err       error
+}
+
+// entityID Returns the ID of the object as a string, looking for a field
+// named ID or <Object>ID (e.g., TodoID), of any type
+func entityID(objectName string, object interface{}) (string, bool) {
+	v := reflect.ValueOf(object)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", false
 		}
-	}()
+		v = v.Elem()
+	}
 
-	f, err := reflections.GetField(object, fieldName)
-	field = f.(string)
-	return field, err
-}
+	if v.Kind() != reflect.Struct {
+		return "", false
+	}
+
+	for _, name := range []string{"ID", objectName + "ID"} {
+		f := v.FieldByName(name)
+		if !f.IsValid() || !f.CanInterface() {
+			continue
+		}
 
-func arrayContains(list []string, v string) bool {
-	for _, f := range list {
-		if v == f {
-			return true
+		if reflect.DeepEqual(f.Interface(), reflect.Zero(f.Type()).Interface()) {
+			continue
 		}
+
+		return fmt.Sprint(f.Interface()), true
+	}
+
+	return "", false
+}
+
+// entityCacheKey Returns a key for the object whose field is being resolved,
+// unique within the request.  Objects with an ID share one key wherever they
+// appear at the same place in the tree.  Otherwise, the object's position in
+// the result is used, including any list indexes
+func entityCacheKey(rctx graphql.ResolverContext, parent interface{}, policy string) string {
+	id, hasID := entityID(rctx.Object, parent)
+
+	// Drop the field itself so that all fields of the object share the key:
+	fl := fullFieldList(rctx, !hasID)
+	if len(fl) > 0 {
+		fl = fl[:len(fl)-1]
+	}
+
+	if hasID {
+		return fmt.Sprintf("%s:%s:%s", strings.Join(fl, "."), id, policy)
 	}
 
-	return false
+	return fmt.Sprintf("%s:%s", strings.Join(fl, "."), policy)
 }
 
-// hasFieldAccess Verify access to the requested query field
+// hasFieldAccess Verify access to the requested query field.  The allowed
+// fields for each object are evaluated once with the allowedFields policy and
+// cached for the rest of the request
 func hasFieldAccess(ctx context.Context, object interface{}, defaultPayload func(context.Context, string, string, map[string]interface{}) error) (bool, error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "hasFieldAccess")
 	defer span.Finish()
 
-	var err error
 	rctx := graphql.GetResolverContext(ctx)
 	span.LogFields(
 		otlog.String("object", rctx.Object),
 		otlog.String("field", rctx.Field.Alias),
 	)
 
-	allowed := true
-	// panic("Is it safe to cache these unnamed values like I am?")
-
-	if rctx.Object != "Mutation" && !strings.HasPrefix(rctx.Object, "__") {
-		var parent interface{}
-		if rctx.Parent != nil {
-			parent = rctx.Parent.Result
-		}
-
-		field := rctx.Field.Alias
-		policy := fmt.Sprintf("data.api.entity.%s", lowerFirst(rctx.Object))
-		cacheName := policy
-
-		// We want to remember if this policy check was for the same part of the
-		// tree or somewhere very different.  We shorten fl by one so that, e.g.,
-		// suppliersConnection.edges.node.name becomes
-		// suppliersConnection.edges.node.  That way we can cache the field list
-		// for all of the node fields, rather than none being cached
-		fl := fullFieldList(*rctx, false)
-		if len(fl) > 0 {
-			fl = fl[:len(fl)-1]
-		}
-
-		id, err := getField(parent, "ID")
-
-		// TODO IMPORTANT: Eliminate the dependency on viewField.  All fields
-		// should be explicitly listed.  This will allow us to eliminate some
-		// extra code here that falls back to viewField policy
-		// For now, only objects with an ID field are being cached
-		if err == nil && len(id) > 0 {
-			cacheName = fmt.Sprintf("%s:%s:%s", strings.Join(fl, "."), id, cacheName)
-			// cacheName = fmt.Sprintf("%s:%s", id, cacheName)
-			// log.Printf("Cache search key: %s", cacheName)
-
-			v, err := store.ContextReadValue(ctx, vars.SharedData, cacheName)
-			if err != nil {
-				return false, err
-			}
+	// Ignore __ prefix, since this corresponds to queries about the schema
+	if rctx.Object == "Mutation" || strings.HasPrefix(rctx.Object, "__") {
+		return true, nil
+	}
 
-			vb, ok := v.([]string)
+	var parent interface{}
+	if rctx.Parent != nil {
+		parent = rctx.Parent.Result
+	}
 
-			// If len == 0, then this might be because the policy allows all fields
-			// and we need to fall bacak on the viewField policy
-			if ok && len(vb) > 0 {
-				// log.Printf("RETURNING CACHED VALUE object: %s, field: %s", rctx.Object, rctx.Field.Alias)
-				return arrayContains(vb, field), nil
-			}
-		}
-		// log.Printf("CAN'T USE CACHED VALUE FOR object: %s, field: %s", rctx.Object, rctx.Field.Alias)
+	field := rctx.Field.Alias
+	policy := fmt.Sprintf("data.api.entity.%s", EntityPolicyName(rctx.Object))
+	cacheName := entityCacheKey(*rctx, parent, policy)
 
-		//log.Printf("Object: %s, field: %s", rctx.Object, rctx.Field.Alias)
-		// Not found in cache, so let's check the policy:
-		allowed = false
+	decision := &fieldDecision{}
+	v, _, err := store.ContextLoadOrStore(ctx, vars.SharedData, cacheName, decision)
+	if err != nil {
+		// No store, so we can't share the decision, but can still make it:
+		log.WithField("error", err).Warning("Field decisions cannot be cached")
+	} else {
+		decision = v.(*fieldDecision)
+	}
 
+	decision.once.Do(func() {
 		input := make(map[string]interface{})
-		input["field"] = field
-
-		// Add some default data to the check
-		input["fieldValue"] = object
 		input["entity"] = parent
+		AddUserInput(ctx, input)
 
-		err = defaultPayload(ctx, rctx.Object, rctx.Field.Alias, input)
+		// The decision covers every field of the object, so no field is given:
+		err := defaultPayload(ctx, rctx.Object, "", input)
 		if err != nil {
 			log.Printf("WARNING: Could not add default payload: %s", err)
 		}
 
-		allFields, err := opa.AuthorisedStrings(ctx, fmt.Sprintf("%s.allowedFields", policy), input)
-		if err == nil && len(allFields) > 0 {
-			// Save in cache:
-			if len(cacheName) > 0 {
-				cErr := store.ContextAddValue(ctx, vars.SharedData, cacheName, allFields)
-				if cErr != nil {
-					log.Error(cErr)
-				}
+		allFields, err := authorisedStrings(ctx, fmt.Sprintf("%s.allowedFields", policy), input)
+		switch {
+		case err == opa.ErrNoPolicy:
+			decision.undefined = true
+		case err != nil:
+			decision.err = err
+		default:
+			decision.fields = make(map[string]bool, len(allFields))
+			for _, f := range allFields {
+				decision.fields[f] = true
 			}
-			return arrayContains(allFields, field), nil
 		}
+	})
 
-		// Failing finding the specific field, there might be a general policy
-		// that allows any field to be viewed:
-		log.Warningf("viewField will soon be deprecated.  If you are not already, please specify allowedFields permission to explicitly list all fields allowed.  Falling back to viewField for object: %s, field: %s", rctx.Object, field)
-		allowed, err = opa.Allow(ctx, policy+".viewField", input)
+	if decision.err != nil {
+		return false, decision.err
 	}
 
-	return allowed, err
+	if !decision.undefined {
+		return decision.fields[field], nil
+	}
+
+	if !EnableViewFieldFallback {
+		log.Warningf("No allowedFields policy for object: %s, so denying field: %s", rctx.Object, field)
+		return false, nil
+	}
+
+	log.Warningf("viewField will soon be deprecated.  If you are not already, please specify allowedFields permission to explicitly list all fields allowed.  Falling back to viewField for object: %s, field: %s", rctx.Object, field)
+
+	input := make(map[string]interface{})
+	input["field"] = field
+	input["fieldValue"] = object
+	input["entity"] = parent
+	AddUserInput(ctx, input)
+
+	err = defaultPayload(ctx, rctx.Object, field, input)
+	if err != nil {
+		log.Printf("WARNING: Could not add default payload: %s", err)
+	}
+
+	return opa.Allow(ctx, policy+".viewField", input)
 }
 
 // fullFieldList Returns a list of the fields/names in the query.  E.g., getting the username of a user for a client would return 'client user username' as the three elements in order.  Does not count array position counts
@@ -412,6 +452,12 @@ func getAuthString(prefix string, objectName string, value string) string {
 	return fmt.Sprintf("data.api.%s.%s.%s", prefix, objectName, value)
 }
 
+// EntityPolicyName Returns the name of the policy checked for fields of the
+// object type, under data.api.entity.  E.g., Todo is data.api.entity.todo
+func EntityPolicyName(objectName string) string {
+	return lowerFirst(objectName)
+}
+
 // https://groups.google.com/forum/#!topic/golang-nuts/WfpmVDQFecU
 func lowerFirst(s string) string {
 	if s == "" {
@@ -0,0 +1,198 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/episub/spawn/opa"
+	"github.com/episub/spawn/store"
+	"github.com/episub/spawn/vars"
+	"github.com/vektah/gqlparser/ast"
+)
+
+type testTodo struct {
+	TodoID int
+	Title  string
+}
+
+type testNode struct {
+	ID string
+}
+
+// fieldContext Returns the resolver context for a field of the object,
+// resolved within ctx
+func fieldContext(ctx context.Context, object string, field string) context.Context {
+	return graphql.WithResolverContext(ctx, &graphql.ResolverContext{
+		Object: object,
+		Field:  graphql.CollectedField{Field: &ast.Field{Name: field, Alias: field}},
+	})
+}
+
+// todoContexts Returns the context for resolving the field of each todo,
+// as resolved in a query for a list of todos
+func todoContexts(ctx context.Context, field string, todos ...interface{}) []context.Context {
+	list := fieldContext(ctx, "Query", "todos")
+	graphql.GetResolverContext(list).Result = todos
+
+	var contexts []context.Context
+	for i, todo := range todos {
+		index := i
+		item := graphql.WithResolverContext(list, &graphql.ResolverContext{Index: &index, Result: todo})
+		contexts = append(contexts, fieldContext(item, "Todo", field))
+	}
+
+	return contexts
+}
+
+func TestEntityID(t *testing.T) {
+	var nilTodo *testTodo
+
+	var tests = []struct {
+		Name   string
+		Object interface{}
+		ID     string
+		Found  bool
+	}{
+		{"ID", testNode{ID: "a"}, "a", true},
+		{"Object ID", testTodo{TodoID: 7}, "7", true},
+		{"Pointer", &testTodo{TodoID: 7}, "7", true},
+		{"Nil pointer", nilTodo, "", false},
+		{"Zero ID", testTodo{Title: "No ID"}, "", false},
+		{"Not a struct", "todo", "", false},
+		{"Nil", nil, "", false},
+	}
+
+	for _, test := range tests {
+		id, found := entityID("Todo", test.Object)
+		if id != test.ID || found != test.Found {
+			t.Errorf("%s: Expected '%s' and %t, but was '%s' and %t", test.Name, test.ID, test.Found, id, found)
+		}
+	}
+}
+
+func TestEntityCacheKey(t *testing.T) {
+	policy := "data.api.entity.todo"
+	key := func(ctx context.Context) string {
+		rctx := graphql.GetResolverContext(ctx)
+		return entityCacheKey(*rctx, rctx.Parent.Result, policy)
+	}
+
+	ctx := context.Background()
+	titles := todoContexts(ctx, "title", testTodo{TodoID: 1}, testTodo{TodoID: 2}, testTodo{TodoID: 1})
+	ids := todoContexts(ctx, "todoID", testTodo{TodoID: 1})
+	noIDs := todoContexts(ctx, "title", testTodo{Title: "a"}, testTodo{Title: "b"})
+	noIDFields := todoContexts(ctx, "todoID", testTodo{Title: "a"})
+
+	var tests = []struct {
+		Name string
+		A    string
+		B    string
+		Same bool
+	}{
+		{"Fields of an object", key(titles[0]), key(ids[0]), true},
+		{"Objects with the same ID", key(titles[0]), key(titles[2]), true},
+		{"Objects with different IDs", key(titles[0]), key(titles[1]), false},
+		{"Fields of an object without ID", key(noIDs[0]), key(noIDFields[0]), true},
+		{"Objects without ID", key(noIDs[0]), key(noIDs[1]), false},
+	}
+
+	for _, test := range tests {
+		if (test.A == test.B) != test.Same {
+			t.Errorf("%s: Expected same key %t, but had '%s' and '%s'", test.Name, test.Same, test.A, test.B)
+		}
+	}
+}
+
+func TestFieldDecision(t *testing.T) {
+	original := authorisedStrings
+	defer func() { authorisedStrings = original }()
+
+	var evaluated int
+	authorisedStrings = func(ctx context.Context, policy string, data map[string]interface{}) ([]string, error) {
+		evaluated++
+		if policy != "data.api.entity.todo.allowedFields" {
+			return nil, opa.ErrNoPolicy
+		}
+		return []string{"title"}, nil
+	}
+
+	var payloadFields []string
+	payload := func(ctx context.Context, object string, field string, input map[string]interface{}) error {
+		payloadFields = append(payloadFields, field)
+		return nil
+	}
+
+	ctx := context.WithValue(context.Background(), vars.SharedData, store.NewDataStore())
+
+	todos := []interface{}{testTodo{TodoID: 1}, testTodo{TodoID: 2}}
+	var resolved []context.Context
+	for _, field := range []string{"title", "todoID", "title"} {
+		resolved = append(resolved, todoContexts(ctx, field, todos...)...)
+	}
+
+	for _, fieldCtx := range resolved {
+		allowed, err := hasFieldAccess(fieldCtx, nil, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		field := graphql.GetResolverContext(fieldCtx).Field.Alias
+		if allowed != (field == "title") {
+			t.Errorf("Expected only title allowed, but %s was %t", field, allowed)
+		}
+	}
+
+	if evaluated != len(todos) {
+		t.Errorf("Expected allowedFields evaluated once for each of %d todos, but was %d times", len(todos), evaluated)
+	}
+
+	for _, f := range payloadFields {
+		if f != "" {
+			t.Errorf("Expected default payload for all fields, but was for '%s'", f)
+		}
+	}
+
+	// Objects without an allowedFields policy have every field denied:
+	parent := fieldContext(ctx, "Query", "user")
+	graphql.GetResolverContext(parent).Result = testNode{ID: "42"}
+
+	allowed, err := hasFieldAccess(fieldContext(parent, "User", "name"), nil, payload)
+	if err != nil || allowed {
+		t.Errorf("Expected field without a policy denied, but was %t with error %v", allowed, err)
+	}
+}
+
+func TestAllowCheckInput(t *testing.T) {
+	ctx := WithImpersonation(context.Background(), testUser("support"), testUser("42"))
+
+	var tests = []struct {
+		Name  string
+		Args  map[string]interface{}
+		User  interface{}
+		Actor interface{}
+	}{
+		{"Current user", map[string]interface{}{"id": "1"}, testUser("42"), testUser("support")},
+		{"Argument named user", map[string]interface{}{"user": "7"}, "7", testUser("support")},
+	}
+
+	for _, test := range tests {
+		rctx := &graphql.ResolverContext{
+			Object: "Mutation",
+			Args:   test.Args,
+			Field:  graphql.CollectedField{Field: &ast.Field{Name: "updateUser", Alias: "updateUser"}},
+		}
+
+		var input map[string]interface{}
+		payload := func(ctx context.Context, prefix string, object string, i map[string]interface{}) error {
+			input = i
+			return nil
+		}
+
+		runAllowCheck(ctx, payload, rctx, nil)
+
+		if input["user"] != test.User || input["actor"] != test.Actor {
+			t.Errorf("%s: Expected user %v and actor %v, but was %v and %v", test.Name, test.User, test.Actor, input["user"], input["actor"])
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AttemptStore Records failed login attempts and lockouts.  Keys identify
+// either a username or a client IP
+type AttemptStore interface {
+	// Increment Atomically adds a failure for key at the given time,
+	// returning the number of failures including this one, and the time of
+	// the previous failure.  The count starts again from one if there has
+	// been no failure within window
+	Increment(ctx context.Context, key string, at time.Time, window time.Duration) (int, time.Time, error)
+	// Decrement Removes a failure added by Increment, e.g., when the attempt
+	// succeeds
+	Decrement(ctx context.Context, key string) error
+	// Lock Prevents any attempts for key until the given time
+	Lock(ctx context.Context, key string, until time.Time) error
+	// LockedUntil Returns the time key is locked until, or zero if not locked
+	LockedUntil(ctx context.Context, key string) (time.Time, error)
+	// Reset Removes all failures and any lock for key
+	Reset(ctx context.Context, key string) error
+}
+
+// Throttle Limits login attempts by username and by client IP.  Each attempt
+// is counted as a failure before the credentials are checked, so concurrent
+// attempts can't all pass before any is recorded.  Once more than
+// FreeAttempts failures have been made, each further attempt must wait twice
+// as long as the last, starting at BaseDelay.  After LockoutAttempts failures
+// the key is locked for LockoutDuration.  Failures are forgotten once none
+// have been made within Window
+type Throttle struct {
+	Store           AttemptStore
+	Window          time.Duration
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutAttempts int
+	LockoutDuration time.Duration
+
+	// ClientIP Returns the IP address to throttle by.  Defaults to the host of
+	// r.RemoteAddr, so use chi's RealIP middleware if behind a proxy
+	ClientIP func(r *http.Request) string
+	// OnFailure Called after each failed attempt, with the number of failures
+	// for the username
+	OnFailure func(ctx context.Context, username string, ip string, failures int)
+	// OnLockout Called when a username or IP is locked out
+	OnLockout func(ctx context.Context, username string, ip string, until time.Time)
+}
+
+// LoginAttempt An attempt counted by Throttle.Attempt.  Once the credentials
+// are checked, call Failed or Succeeded
+type LoginAttempt struct {
+	throttle *Throttle
+	username string
+	ip       string
+	// failures Count for each key, including this attempt
+	failures map[string]int
+}
+
+// ThrottledError Returned when an attempt is made too soon after previous
+// failures
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e ThrottledError) Error() string {
+	return fmt.Sprintf("Too many login attempts, try again in %d seconds", retrySeconds(e.RetryAfter))
+}
+
+// NewThrottle Returns a throttle using store, with defaults of 5 free
+// attempts per 15 minutes, delays from 1 second up to 1 minute, and a 15
+// minute lockout after 10 failures
+func NewThrottle(store AttemptStore) *Throttle {
+	return &Throttle{
+		Store:           store,
+		Window:          15 * time.Minute,
+		FreeAttempts:    5,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutAttempts: 10,
+		LockoutDuration: 15 * time.Minute,
+	}
+}
+
+func userKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// clientIP Returns the IP for the request
+func (t *Throttle) clientIP(r *http.Request) string {
+	if t.ClientIP != nil {
+		return t.ClientIP(r)
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// Attempt Counts an attempt to log in as username from ip, to be made
+// before checking the credentials.  Returns a ThrottledError if the username
+// or IP is locked, or if the attempt is too soon after the last failure, in
+// which case the attempt still counts as a failure
+func (t *Throttle) Attempt(ctx context.Context, username string, ip string) (*LoginAttempt, error) {
+	now := time.Now()
+	keys := []string{userKey(username), ipKey(ip)}
+	var wait time.Duration
+
+	for _, key := range keys {
+		until, err := t.Store.LockedUntil(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if until.After(now) && until.Sub(now) > wait {
+			wait = until.Sub(now)
+		}
+	}
+
+	if wait > 0 {
+		return nil, ThrottledError{RetryAfter: wait}
+	}
+
+	attempt := &LoginAttempt{
+		throttle: t,
+		username: username,
+		ip:       ip,
+		failures: make(map[string]int),
+	}
+
+	for _, key := range keys {
+		count, last, err := t.Store.Increment(ctx, key, now, t.Window)
+		if err != nil {
+			return nil, err
+		}
+		attempt.failures[key] = count
+
+		if next := last.Add(t.delay(count - 1)); next.After(now) && next.Sub(now) > wait {
+			wait = next.Sub(now)
+		}
+	}
+
+	if wait > 0 {
+		return attempt, ThrottledError{RetryAfter: wait}
+	}
+
+	return attempt, nil
+}
+
+// delay Returns how long to wait after the given number of failures
+func (t *Throttle) delay(failures int) time.Duration {
+	if failures <= t.FreeAttempts {
+		return 0
+	}
+
+	d := t.BaseDelay
+	for i := t.FreeAttempts + 1; i < failures && d < t.MaxDelay; i++ {
+		d *= 2
+	}
+
+	if t.MaxDelay > 0 && d > t.MaxDelay {
+		d = t.MaxDelay
+	}
+
+	return d
+}
+
+// Failed Keeps the attempt's failure against both the username and IP,
+// locking either out if they have reached LockoutAttempts
+func (a *LoginAttempt) Failed(ctx context.Context) error {
+	t := a.throttle
+	now := time.Now()
+
+	for _, key := range []string{userKey(a.username), ipKey(a.ip)} {
+		count := a.failures[key]
+
+		if key == userKey(a.username) && t.OnFailure != nil {
+			t.OnFailure(ctx, a.username, a.ip, count)
+		}
+
+		if t.LockoutAttempts > 0 && count >= t.LockoutAttempts {
+			until := now.Add(t.LockoutDuration)
+			err := t.Store.Lock(ctx, key, until)
+			if err != nil {
+				return err
+			}
+
+			log.WithFields(logrus.Fields{"key": key, "until": until}).Warning("Login locked out")
+			if t.OnLockout != nil {
+				t.OnLockout(ctx, a.username, a.ip, until)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Succeeded Clears failures for the username, and removes the attempt from
+// the IP's failures.  Earlier failures for the IP are kept, so that one valid
+// account can't be used to reset the count while guessing others
+func (a *LoginAttempt) Succeeded(ctx context.Context) error {
+	err := a.throttle.Store.Reset(ctx, userKey(a.username))
+	if err != nil {
+		return err
+	}
+
+	return a.throttle.Store.Decrement(ctx, ipKey(a.ip))
+}
+
+// retrySeconds Rounds up to whole seconds, as used by Retry-After
+func retrySeconds(d time.Duration) int {
+	s := int(d / time.Second)
+	if d%time.Second > 0 {
+		s++
+	}
+
+	return s
+}
+
+// MemoryAttemptStore Keeps attempts in memory, so is only suitable when
+// running a single instance
+type MemoryAttemptStore struct {
+	retention time.Duration
+	failures  map[string]*attemptCount
+	locks     map[string]time.Time
+	writes    int
+	mutex     *sync.Mutex
+}
+
+type attemptCount struct {
+	count int
+	last  time.Time
+}
+
+// NewMemoryAttemptStore Returns an empty store, which forgets failures older
+// than retention.  Retention should be at least the throttle's Window
+func NewMemoryAttemptStore(retention time.Duration) *MemoryAttemptStore {
+	return &MemoryAttemptStore{
+		retention: retention,
+		failures:  make(map[string]*attemptCount),
+		locks:     make(map[string]time.Time),
+		mutex:     &sync.Mutex{},
+	}
+}
+
+// Increment Adds a failure for key
+func (m *MemoryAttemptStore) Increment(ctx context.Context, key string, at time.Time, window time.Duration) (int, time.Time, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	c, ok := m.failures[key]
+	if !ok {
+		c = &attemptCount{}
+		m.failures[key] = c
+	}
+
+	last := c.last
+	if last.Before(at.Add(-window)) {
+		c.count = 0
+	}
+	c.count++
+	c.last = at
+
+	// Every so often drop keys that have nothing recent, so memory doesn't
+	// grow with every IP and username ever tried:
+	m.writes++
+	if m.writes%1000 == 0 {
+		m.sweep(at)
+	}
+
+	return c.count, last, nil
+}
+
+func (m *MemoryAttemptStore) sweep(now time.Time) {
+	for k, c := range m.failures {
+		if c.last.Before(now.Add(-m.retention)) {
+			delete(m.failures, k)
+		}
+	}
+
+	for k, until := range m.locks {
+		if until.Before(now) {
+			delete(m.locks, k)
+		}
+	}
+}
+
+// Decrement Removes a failure for key
+func (m *MemoryAttemptStore) Decrement(ctx context.Context, key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if c, ok := m.failures[key]; ok && c.count > 0 {
+		c.count--
+	}
+
+	return nil
+}
+
+// Lock Locks key until the given time
+func (m *MemoryAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	m.mutex.Lock()
+	m.locks[key] = until
+	m.mutex.Unlock()
+
+	return nil
+}
+
+// LockedUntil Returns the time key is locked until
+func (m *MemoryAttemptStore) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.locks[key], nil
+}
+
+// Reset Clears failures and lock for key
+func (m *MemoryAttemptStore) Reset(ctx context.Context, key string) error {
+	m.mutex.Lock()
+	delete(m.failures, key)
+	delete(m.locks, key)
+	m.mutex.Unlock()
+
+	return nil
+}
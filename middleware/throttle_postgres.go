@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx"
+)
+
+// PostgresAttemptStore Keeps attempts in PostgreSQL, so that limits apply
+// across all instances.  Expects the following table:
+//
+//	CREATE TABLE login_attempt (
+//	  attempt_key text PRIMARY KEY,
+//	  failures integer NOT NULL DEFAULT 0,
+//	  last_failed_at timestamptz,
+//	  locked_until timestamptz
+//	);
+//	CREATE INDEX ON login_attempt (last_failed_at);
+type PostgresAttemptStore struct {
+	pool      *pgx.ConnPool
+	table     string
+	retention time.Duration
+}
+
+// NewPostgresAttemptStore Returns a store using the given table, e.g.,
+// 'login_attempt' or 'auth.login_attempt'.  Keys with no failures within
+// retention, and no lock, are deleted as new failures are recorded
+func NewPostgresAttemptStore(pool *pgx.ConnPool, table string, retention time.Duration) *PostgresAttemptStore {
+	return &PostgresAttemptStore{
+		pool:      pool,
+		table:     table,
+		retention: retention,
+	}
+}
+
+// Increment Adds a failure for key.  The row is locked while it's updated,
+// so concurrent attempts each see a different count
+func (p *PostgresAttemptStore) Increment(ctx context.Context, key string, at time.Time, window time.Duration) (int, time.Time, error) {
+	_, err := p.pool.ExecEx(ctx, fmt.Sprintf("INSERT INTO %s (attempt_key) VALUES ($1) ON CONFLICT (attempt_key) DO NOTHING", p.table), nil, key)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	var count int
+	var last *time.Time
+
+	// The subquery locks the row and returns the previous failure time, which
+	// RETURNING alone can't:
+	err = p.pool.QueryRowEx(
+		ctx,
+		fmt.Sprintf(`UPDATE %[1]s a SET
+			failures = CASE WHEN old.last_failed_at IS NULL OR old.last_failed_at < $3 THEN 1 ELSE old.failures + 1 END,
+			last_failed_at = $2
+		FROM (SELECT attempt_key, failures, last_failed_at FROM %[1]s WHERE attempt_key = $1 FOR UPDATE) old
+		WHERE a.attempt_key = old.attempt_key
+		RETURNING a.failures, old.last_failed_at`, p.table),
+		nil,
+		key, at, at.Add(-window),
+	).Scan(&count, &last)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	_, err = p.pool.ExecEx(
+		ctx,
+		fmt.Sprintf("DELETE FROM %s WHERE last_failed_at < $1 AND (locked_until IS NULL OR locked_until < $2)", p.table),
+		nil,
+		at.Add(-p.retention), at,
+	)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	if last == nil {
+		return count, time.Time{}, nil
+	}
+
+	return count, *last, nil
+}
+
+// Decrement Removes a failure for key
+func (p *PostgresAttemptStore) Decrement(ctx context.Context, key string) error {
+	_, err := p.pool.ExecEx(ctx, fmt.Sprintf("UPDATE %s SET failures = greatest(failures - 1, 0) WHERE attempt_key = $1", p.table), nil, key)
+	return err
+}
+
+// Lock Locks key until the given time
+func (p *PostgresAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := p.pool.ExecEx(
+		ctx,
+		fmt.Sprintf("INSERT INTO %s (attempt_key, locked_until) VALUES ($1, $2) ON CONFLICT (attempt_key) DO UPDATE SET locked_until = EXCLUDED.locked_until", p.table),
+		nil,
+		key, until,
+	)
+
+	return err
+}
+
+// LockedUntil Returns the time key is locked until
+func (p *PostgresAttemptStore) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	var until *time.Time
+
+	err := p.pool.QueryRowEx(ctx, fmt.Sprintf("SELECT locked_until FROM %s WHERE attempt_key = $1", p.table), nil, key).Scan(&until)
+	if err == pgx.ErrNoRows || (err == nil && until == nil) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return *until, nil
+}
+
+// Reset Clears failures and lock for key
+func (p *PostgresAttemptStore) Reset(ctx context.Context, key string) error {
+	_, err := p.pool.ExecEx(ctx, fmt.Sprintf("DELETE FROM %s WHERE attempt_key = $1", p.table), nil, key)
+	return err
+}
@@ -0,0 +1,231 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestThrottle() *Throttle {
+	t := NewThrottle(NewMemoryAttemptStore(time.Hour))
+	t.FreeAttempts = 2
+	t.BaseDelay = time.Minute
+	t.MaxDelay = 4 * time.Minute
+	t.LockoutAttempts = 0
+
+	return t
+}
+
+// failAttempts Makes n failed attempts, which must not be throttled
+func failAttempts(t *testing.T, throttle *Throttle, username string, ip string, n int) {
+	for i := 0; i < n; i++ {
+		attempt, err := throttle.Attempt(context.Background(), username, ip)
+		if err != nil {
+			t.Fatalf("Attempt %d: %s", i+1, err)
+		}
+
+		if err := attempt.Failed(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestThrottleDelay(t *testing.T) {
+	throttle := newTestThrottle()
+
+	var tests = []struct {
+		Failures int
+		Delay    time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{8, 4 * time.Minute},
+	}
+
+	for _, test := range tests {
+		if d := throttle.delay(test.Failures); d != test.Delay {
+			t.Errorf("%d failures: Expected delay %s, but was %s", test.Failures, test.Delay, d)
+		}
+	}
+
+	failAttempts(t, throttle, "alice", "10.0.0.1", 3)
+
+	_, err := throttle.Attempt(context.Background(), "alice", "10.0.0.2")
+	terr, ok := err.(ThrottledError)
+	if !ok {
+		t.Fatalf("Expected attempt after 3 failures to be throttled, but was %v", err)
+	}
+
+	if terr.RetryAfter <= 0 || terr.RetryAfter > time.Minute {
+		t.Errorf("Expected to retry within a minute, but was %s", terr.RetryAfter)
+	}
+
+	// The IP is throttled for other usernames too:
+	if _, err := throttle.Attempt(context.Background(), "bob", "10.0.0.1"); err == nil {
+		t.Errorf("Expected attempt from the same IP to be throttled")
+	}
+}
+
+func TestThrottleLockout(t *testing.T) {
+	throttle := newTestThrottle()
+	throttle.FreeAttempts = 10
+	throttle.LockoutAttempts = 3
+	throttle.LockoutDuration = time.Hour
+
+	var locked []string
+	throttle.OnLockout = func(ctx context.Context, username string, ip string, until time.Time) {
+		locked = append(locked, username)
+	}
+
+	failAttempts(t, throttle, "alice", "10.0.0.1", 3)
+
+	if len(locked) == 0 {
+		t.Errorf("Expected OnLockout to be called")
+	}
+
+	_, err := throttle.Attempt(context.Background(), "alice", "10.0.0.2")
+	terr, ok := err.(ThrottledError)
+	if !ok {
+		t.Fatalf("Expected locked out attempt to be throttled, but was %v", err)
+	}
+
+	if terr.RetryAfter < 59*time.Minute {
+		t.Errorf("Expected to retry after the lockout, but was %s", terr.RetryAfter)
+	}
+}
+
+func TestThrottleSucceeded(t *testing.T) {
+	throttle := newTestThrottle()
+	ctx := context.Background()
+
+	failAttempts(t, throttle, "alice", "10.0.0.1", 2)
+
+	attempt, err := throttle.Attempt(ctx, "alice", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := attempt.Succeeded(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The username starts again, but the IP keeps its earlier failures:
+	attempt, err = throttle.Attempt(ctx, "alice", "10.0.0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := attempt.failures[userKey("alice")]; n != 1 {
+		t.Errorf("Expected username failures reset, but had %d", n)
+	}
+
+	attempt, err = throttle.Attempt(ctx, "bob", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := attempt.failures[ipKey("10.0.0.1")]; n != 3 {
+		t.Errorf("Expected successful attempt removed from IP failures, but had %d", n)
+	}
+}
+
+func TestThrottleConcurrent(t *testing.T) {
+	throttle := newTestThrottle()
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var allowed int
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			_, err := throttle.Attempt(context.Background(), "alice", fmt.Sprintf("10.0.0.%d", i))
+			if err == nil {
+				mutex.Lock()
+				allowed++
+				mutex.Unlock()
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if allowed != throttle.FreeAttempts+1 {
+		t.Errorf("Expected %d concurrent attempts allowed, but was %d", throttle.FreeAttempts+1, allowed)
+	}
+}
+
+func TestMemoryAttemptStore(t *testing.T) {
+	m := NewMemoryAttemptStore(time.Hour)
+	ctx := context.Background()
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		Name      string
+		Decrement bool
+		At        time.Duration
+		Count     int
+		Last      time.Duration
+	}{
+		{Name: "First", At: 0, Count: 1, Last: -1},
+		{Name: "Within window", At: 30 * time.Second, Count: 2, Last: 0},
+		{Name: "After window", At: 2 * time.Minute, Count: 1, Last: 30 * time.Second},
+		{Name: "Decremented", Decrement: true, At: 150 * time.Second, Count: 1, Last: 2 * time.Minute},
+	}
+
+	for _, test := range tests {
+		if test.Decrement {
+			if err := m.Decrement(ctx, "key"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		count, last, err := m.Increment(ctx, "key", start.Add(test.At), time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expectLast := start.Add(test.Last)
+		if test.Last < 0 {
+			expectLast = time.Time{}
+		}
+
+		if count != test.Count || !last.Equal(expectLast) {
+			t.Errorf("%s: Expected %d failures, last at %s, but was %d, last at %s", test.Name, test.Count, expectLast, count, last)
+		}
+	}
+
+	until := start.Add(time.Hour)
+	if err := m.Lock(ctx, "key", until); err != nil {
+		t.Fatal(err)
+	}
+
+	if locked, _ := m.LockedUntil(ctx, "key"); !locked.Equal(until) {
+		t.Errorf("Expected locked until %s, but was %s", until, locked)
+	}
+
+	if err := m.Reset(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+
+	if locked, _ := m.LockedUntil(ctx, "key"); !locked.IsZero() {
+		t.Errorf("Expected lock removed by reset")
+	}
+
+	if count, _, _ := m.Increment(ctx, "key", start.Add(time.Hour), time.Minute); count != 1 {
+		t.Errorf("Expected failures removed by reset, but had %d", count)
+	}
+
+	// Keys with nothing recent are swept:
+	m.sweep(start.Add(3 * time.Hour))
+	if len(m.failures) != 0 || len(m.locks) != 0 {
+		t.Errorf("Expected old keys swept, but had %d failures and %d locks", len(m.failures), len(m.locks))
+	}
+}
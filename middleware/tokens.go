@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/episub/spawn/security"
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// TokenPurpose What a single-use token was issued for.  A token can only be
+// redeemed for the purpose it was issued for
+type TokenPurpose string
+
+const (
+	// TokenPasswordReset Token sent in password reset emails
+	TokenPasswordReset TokenPurpose = "passwordReset"
+	// TokenEmailVerification Token sent to confirm a user owns their email
+	// address
+	TokenEmailVerification TokenPurpose = "emailVerification"
+)
+
+const (
+	defaultResetTokenLifetime = time.Hour
+	defaultTokenLifetime      = 24 * time.Hour
+)
+
+// ErrInvalidAccountToken Token is unknown, already used, expired or was
+// issued for another purpose
+var ErrInvalidAccountToken = SafeError("Invalid or expired token")
+
+// Tokens Issues single-use, expiring tokens, e.g., for password reset links.
+// Only the hash of each token is stored, so a leaked table can't be used to
+// reset passwords
+type Tokens struct {
+	// Lifetimes How long tokens for each purpose are valid.  Defaults to an
+	// hour for password resets, and a day otherwise
+	Lifetimes map[TokenPurpose]time.Duration
+	// SaveToken Stores the hash of a new token
+	SaveToken func(ctx context.Context, user User, purpose TokenPurpose, hash string, expiry time.Time) error
+	// ConsumeToken Deletes the token with the given purpose and hash,
+	// returning its user and expiry.  Must delete atomically, e.g., with
+	// DELETE ... RETURNING, so that each token can only be redeemed once.
+	// Returns an error if there is no such token
+	ConsumeToken func(ctx context.Context, purpose TokenPurpose, hash string) (User, time.Time, error)
+	// DeleteTokens Deletes all of the user's tokens with the given purpose,
+	// e.g., so that other reset links stop working once a password is reset
+	DeleteTokens func(ctx context.Context, user User, purpose TokenPurpose) error
+}
+
+// lifetime Returns how long tokens for the purpose are valid
+func (t *Tokens) lifetime(purpose TokenPurpose) time.Duration {
+	if d, ok := t.Lifetimes[purpose]; ok && d > 0 {
+		return d
+	}
+
+	if purpose == TokenPasswordReset {
+		return defaultResetTokenLifetime
+	}
+
+	return defaultTokenLifetime
+}
+
+// Issue Creates a token for the user, returning the token to send them
+func (t *Tokens) Issue(ctx context.Context, user User, purpose TokenPurpose) (string, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "issueToken")
+	defer span.Finish()
+
+	if t.SaveToken == nil {
+		return "", fmt.Errorf("Tokens.SaveToken must be set to issue tokens")
+	}
+
+	token, err := security.NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = t.SaveToken(ctx, user, purpose, security.HashToken(token), time.Now().Add(t.lifetime(purpose)))
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// RevokeAll Deletes all of the user's tokens for the purpose
+func (t *Tokens) RevokeAll(ctx context.Context, user User, purpose TokenPurpose) error {
+	if t.DeleteTokens == nil {
+		return fmt.Errorf("Tokens.DeleteTokens must be set to revoke tokens")
+	}
+
+	return t.DeleteTokens(ctx, user, purpose)
+}
+
+// Redeem Consumes the token, returning the user it was issued to.  Returns
+// ErrInvalidAccountToken if the token has expired
+func (t *Tokens) Redeem(ctx context.Context, purpose TokenPurpose, token string) (User, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "redeemToken")
+	defer span.Finish()
+
+	if len(token) == 0 {
+		return nil, ErrInvalidAccountToken
+	}
+
+	user, expiry, err := t.ConsumeToken(ctx, purpose, security.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(expiry) {
+		return nil, ErrInvalidAccountToken
+	}
+
+	return user, nil
+}
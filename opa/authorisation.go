@@ -25,7 +25,8 @@ type Permission struct {
 // ErrNoPolicy Returns when no such policy
 var ErrNoPolicy = fmt.Errorf("No such policy found")
 
-// AuthorisedStrings Returns a string list of strings that are authorised by the policy.  Expects to get from policy an array of strings
+// AuthorisedStrings Returns a string list of strings that are authorised by the policy.  Expects to get from policy an array of strings.  If the policy
+// does not exist, it returns ErrNoPolicy
 func AuthorisedStrings(ctx context.Context, policy string, data map[string]interface{}) ([]string, error) {
 	//func AuthorisedStrings(ctx context.Context, policy string, store *store.DataStore, data map[string]interface{}) ([]string, error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "AuthorisedStrings")
@@ -43,7 +44,7 @@ func AuthorisedStrings(ctx context.Context, policy string, data map[string]inter
 
 	// Explicitly convert to array of interfaces, and all of those interfaces should be strings though we cannot cast directly to []string
 	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
-		return []string{}, fmt.Errorf("No results")
+		return []string{}, ErrNoPolicy
 	}
 	allowedInterface, ok := rs[0].Expressions[0].Value.([]interface{})
 
@@ -207,6 +208,14 @@ func runRego(ctx context.Context, query string, input map[string]interface{}) (r
 		fmt.Println(string(jsonString))
 	}
 
+	key, generation, cacheable := decisionKey(query, input)
+	if cacheable {
+		if rs, ok := getDecision(key); ok {
+			span.SetTag("cached", true)
+			return rs, nil
+		}
+	}
+
 	m := metrics.New()
 
 	prepared, err := getPreparedRego(ctx, query)
@@ -218,6 +227,18 @@ func runRego(ctx context.Context, query string, input map[string]interface{}) (r
 	if debug {
 		fmt.Println("Dumping rego.Eval metrics:", m.All())
 	}
+
+	if cacheable && err == nil {
+		storeDecision(key, generation, query, rs)
+	}
+
+	// Record the request so it can be replayed by 'spawn policy test'
+	if folder := os.Getenv("RECORD_OPA"); len(folder) > 0 && err == nil {
+		if rErr := recordFixture(folder, query, input, rs); rErr != nil {
+			log.Printf("Could not record fixture for %s: %s", query, rErr)
+		}
+	}
+
 	return rs, err
 }
 
@@ -243,6 +264,7 @@ func getPreparedRego(ctx context.Context, query string) (rego.PreparedEvalQuery,
 		rego.ParsedQuery(compiled),
 		rego.Compiler(compiler),
 		rego.Store(store),
+		loadFunction(),
 	)
 
 	pq, err := r.PrepareForEval(ctx)
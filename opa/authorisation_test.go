@@ -34,7 +34,7 @@ func TestAuthorised(t *testing.T) {
 	// We test example policies, and their expected boolean reply
 
 	for _, c := range authorisedCases {
-		allow, err := Authorised(context.Background(), c.Policy, map[string]interface{}{})
+		allow, _, _, err := Authorised(context.Background(), c.Policy, map[string]interface{}{})
 
 		if err != nil {
 			t.Error(err)
@@ -0,0 +1,219 @@
+package opa
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// CachePolicy Describes a policy whose decisions may be reused across
+// requests.  The decision must depend only on the listed input fields, since
+// these are all that's used to tell requests apart
+type CachePolicy struct {
+	// Query Full path of the policy, e.g., data.api.query.todos.access
+	Query string
+	// TTL How long a decision is kept for.  Zero keeps it until it's evicted
+	// or the bundle is reloaded
+	TTL time.Duration
+	// InputFields Dotted paths of the input values the decision depends on,
+	// e.g., user.role
+	InputFields []string
+}
+
+// decisionCache Least recently used cache of policy decisions
+type decisionCache struct {
+	policies   map[string]CachePolicy
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List // Most recently used at the front
+}
+
+type cachedDecision struct {
+	key     string
+	expires time.Time // Zero if the decision doesn't expire
+	rs      rego.ResultSet
+}
+
+var decisions *decisionCache
+var decisionMutex = &sync.Mutex{}
+
+// decisionGeneration Incremented whenever cached decisions are dropped, so
+// that a decision evaluated before then isn't stored afterwards
+var decisionGeneration uint64
+
+// EnableDecisionCache Turns on caching of decisions for the given policies,
+// keeping at most maxEntries decisions.  Calling again replaces the previous
+// configuration and empties the cache.  Cached decisions are dropped whenever
+// the bundle is reloaded
+func EnableDecisionCache(maxEntries int, policies ...CachePolicy) {
+	c := &decisionCache{
+		policies:   make(map[string]CachePolicy),
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+
+	for _, p := range policies {
+		c.policies[p.Query] = p
+	}
+
+	decisionMutex.Lock()
+	decisions = c
+	decisionGeneration++
+	decisionMutex.Unlock()
+}
+
+// DisableDecisionCache Turns off decision caching
+func DisableDecisionCache() {
+	decisionMutex.Lock()
+	decisions = nil
+	decisionGeneration++
+	decisionMutex.Unlock()
+}
+
+// purgeDecisions Empties the cache, keeping its configuration
+func purgeDecisions() {
+	decisionMutex.Lock()
+	defer decisionMutex.Unlock()
+
+	decisionGeneration++
+
+	if decisions == nil {
+		return
+	}
+
+	decisions.entries = make(map[string]*list.Element)
+	decisions.order.Init()
+}
+
+// decisionKey Returns the cache key for this request and the cache's current
+// generation, to be passed to storeDecision, and false if the query is not
+// cached
+func decisionKey(query string, input map[string]interface{}) (string, uint64, bool) {
+	decisionMutex.Lock()
+	if decisions == nil {
+		decisionMutex.Unlock()
+		return "", 0, false
+	}
+	p, ok := decisions.policies[query]
+	generation := decisionGeneration
+	decisionMutex.Unlock()
+
+	if !ok {
+		return "", 0, false
+	}
+
+	h := sha256.New()
+	for _, f := range p.InputFields {
+		b, err := json.Marshal(inputValue(input, f))
+		if err != nil {
+			log.Printf("Not caching %s, could not encode input %s: %s", query, f, err)
+			return "", 0, false
+		}
+		fmt.Fprintf(h, "%s=%s;", f, b)
+	}
+
+	return query + ":" + hex.EncodeToString(h.Sum(nil)), generation, true
+}
+
+// inputValue Returns the value at the dotted path in input, or nil if there
+// is none.  Values are round tripped through JSON so that structs can be
+// walked in the same way the policy would see them
+func inputValue(input map[string]interface{}, path string) interface{} {
+	parts := strings.Split(path, ".")
+
+	v, ok := input[parts[0]]
+	if !ok || len(parts) == 1 {
+		return v
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+
+	var generic interface{}
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return nil
+	}
+
+	for _, p := range parts[1:] {
+		m, ok := generic.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		generic = m[p]
+	}
+
+	return generic
+}
+
+// getDecision Returns the cached decision if present and not expired
+func getDecision(key string) (rego.ResultSet, bool) {
+	decisionMutex.Lock()
+	defer decisionMutex.Unlock()
+
+	if decisions == nil {
+		return nil, false
+	}
+
+	e, ok := decisions.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	d := e.Value.(*cachedDecision)
+	if !d.expires.IsZero() && time.Now().After(d.expires) {
+		decisions.order.Remove(e)
+		delete(decisions.entries, key)
+		return nil, false
+	}
+
+	decisions.order.MoveToFront(e)
+	return d.rs, true
+}
+
+// storeDecision Adds the decision to the cache, evicting the least recently
+// used decisions if over the size limit.  The decision is not stored if the
+// cache was emptied or replaced since generation was returned by decisionKey,
+// e.g., by a bundle reload while the decision was being evaluated
+func storeDecision(key string, generation uint64, query string, rs rego.ResultSet) {
+	decisionMutex.Lock()
+	defer decisionMutex.Unlock()
+
+	if decisions == nil || generation != decisionGeneration {
+		return
+	}
+
+	p, ok := decisions.policies[query]
+	if !ok {
+		return
+	}
+
+	d := &cachedDecision{key: key, rs: rs}
+	if p.TTL > 0 {
+		d.expires = time.Now().Add(p.TTL)
+	}
+
+	if e, ok := decisions.entries[key]; ok {
+		e.Value = d
+		decisions.order.MoveToFront(e)
+		return
+	}
+
+	decisions.entries[key] = decisions.order.PushFront(d)
+
+	for decisions.maxEntries > 0 && decisions.order.Len() > decisions.maxEntries {
+		oldest := decisions.order.Back()
+		decisions.order.Remove(oldest)
+		delete(decisions.entries, oldest.Value.(*cachedDecision).key)
+	}
+}
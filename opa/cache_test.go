@@ -0,0 +1,133 @@
+package opa
+
+import (
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// decisionOf Returns a result set with the single value v
+func decisionOf(v interface{}) rego.ResultSet {
+	return rego.ResultSet{{Expressions: []*rego.ExpressionValue{{Value: v}}}}
+}
+
+// cacheRole Stores a decision for a user with the role, returning its key
+func cacheRole(t *testing.T, query string, role string) string {
+	input := map[string]interface{}{"user": map[string]interface{}{"role": role}}
+
+	key, generation, ok := decisionKey(query, input)
+	if !ok {
+		t.Fatalf("Expected %s to be cached", query)
+	}
+
+	storeDecision(key, generation, query, decisionOf(role))
+	return key
+}
+
+func TestDecisionCacheKey(t *testing.T) {
+	EnableDecisionCache(10, CachePolicy{Query: "data.test.allow", InputFields: []string{"user.role"}})
+	defer DisableDecisionCache()
+
+	admin, _, _ := decisionKey("data.test.allow", map[string]interface{}{"user": map[string]interface{}{"id": "1", "role": "admin"}})
+	otherAdmin, _, _ := decisionKey("data.test.allow", map[string]interface{}{"user": map[string]interface{}{"id": "2", "role": "admin"}})
+	staff, _, _ := decisionKey("data.test.allow", map[string]interface{}{"user": map[string]interface{}{"id": "1", "role": "staff"}})
+
+	if admin != otherAdmin {
+		t.Errorf("Expected users with the same role to share a decision")
+	}
+
+	if admin == staff {
+		t.Errorf("Expected users with different roles to have different decisions")
+	}
+
+	if _, _, ok := decisionKey("data.test.other", nil); ok {
+		t.Errorf("Expected query without a cache policy not to be cached")
+	}
+}
+
+func TestDecisionCacheEviction(t *testing.T) {
+	query := "data.test.allow"
+	EnableDecisionCache(2, CachePolicy{Query: query, TTL: time.Minute, InputFields: []string{"user.role"}})
+	defer DisableDecisionCache()
+
+	a := cacheRole(t, query, "a")
+	b := cacheRole(t, query, "b")
+
+	// Use a, so that b is the least recently used:
+	if _, ok := getDecision(a); !ok {
+		t.Fatalf("Expected decision for a")
+	}
+
+	c := cacheRole(t, query, "c")
+
+	var tests = []struct {
+		Name   string
+		Key    string
+		Cached bool
+	}{
+		{"Recently used", a, true},
+		{"Least recently used", b, false},
+		{"Newest", c, true},
+	}
+
+	for _, test := range tests {
+		rs, ok := getDecision(test.Key)
+		if ok != test.Cached {
+			t.Errorf("%s: Expected cached %t, but was %t", test.Name, test.Cached, ok)
+			continue
+		}
+
+		if ok && len(rs) != 1 {
+			t.Errorf("%s: Expected the stored decision, but was %v", test.Name, rs)
+		}
+	}
+}
+
+func TestDecisionCacheTTL(t *testing.T) {
+	EnableDecisionCache(10,
+		CachePolicy{Query: "data.test.short", TTL: time.Millisecond, InputFields: []string{"user.role"}},
+		CachePolicy{Query: "data.test.forever", InputFields: []string{"user.role"}},
+	)
+	defer DisableDecisionCache()
+
+	short := cacheRole(t, "data.test.short", "admin")
+	forever := cacheRole(t, "data.test.forever", "admin")
+
+	time.Sleep(10 * time.Millisecond)
+
+	if _, ok := getDecision(short); ok {
+		t.Errorf("Expected decision to expire")
+	}
+
+	if _, ok := getDecision(forever); !ok {
+		t.Errorf("Expected decision with a TTL of zero not to expire")
+	}
+}
+
+func TestDecisionCacheReload(t *testing.T) {
+	query := "data.test.allow"
+	EnableDecisionCache(10, CachePolicy{Query: query, TTL: time.Minute, InputFields: []string{"user.role"}})
+	defer DisableDecisionCache()
+
+	stored := cacheRole(t, query, "admin")
+
+	// A decision evaluated against the old bundle, but stored after reload:
+	input := map[string]interface{}{"user": map[string]interface{}{"role": "staff"}}
+	stale, generation, _ := decisionKey(query, input)
+
+	purgeDecisions()
+	storeDecision(stale, generation, query, decisionOf("staff"))
+
+	if _, ok := getDecision(stored); ok {
+		t.Errorf("Expected decisions dropped on reload")
+	}
+
+	if _, ok := getDecision(stale); ok {
+		t.Errorf("Expected decision evaluated before reload not to be stored")
+	}
+
+	if _, ok := getDecision(cacheRole(t, query, "admin")); !ok {
+		t.Errorf("Expected decisions stored after reload to be cached")
+	}
+}
@@ -17,7 +17,7 @@ import (
 	"github.com/radovskyb/watcher"
 )
 
-var unsafeCompiler = ast.NewCompiler()
+var unsafeCompiler = newCompiler()
 var unsafeDocuments = map[string]interface{}{}
 var unsafeStore storage.Store
 var unsafeQueries map[string]ast.Body
@@ -117,7 +117,7 @@ func LoadBundle(path string) error {
 
 func loadCompiler(path string) error {
 	log.Printf("Loading path %s", path)
-	newCompiler := ast.NewCompiler()
+	compiler := newCompiler()
 
 	pwd, err := os.Getwd()
 	if err != nil {
@@ -144,13 +144,13 @@ func loadCompiler(path string) error {
 	}
 
 	// Compile the loaded modules:
-	newCompiler.Compile(modules)
+	compiler.Compile(modules)
 
-	if newCompiler.Failed() {
-		return newCompiler.Errors
+	if compiler.Failed() {
+		return compiler.Errors
 	}
 
-	setCompiler(newCompiler, result.Documents)
+	setCompiler(compiler, result.Documents)
 
 	return nil
 }
@@ -188,4 +188,5 @@ func setCompiler(compiler *ast.Compiler, documents map[string]interface{}) {
 	unsafeQueries = make(map[string]ast.Body)
 	unsafePrepared = make(map[string]rego.PreparedEvalQuery)
 	queryMutex.Unlock()
+	purgeDecisions()
 }
@@ -0,0 +1,120 @@
+package opa
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/episub/spawn/store"
+	"github.com/episub/spawn/vars"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/types"
+	opentracing "github.com/opentracing/opentracing-go"
+)
+
+// DataProvider Loads records on behalf of policies, through the spawn.load
+// built-in.  E.g., spawn.load("user", input.entity.userID)
+type DataProvider interface {
+	Load(ctx context.Context, id interface{}) (interface{}, error)
+}
+
+// DataProviderFunc Allows an ordinary function to be used as a DataProvider
+type DataProviderFunc func(ctx context.Context, id interface{}) (interface{}, error)
+
+// Load Calls f(ctx, id)
+func (f DataProviderFunc) Load(ctx context.Context, id interface{}) (interface{}, error) {
+	return f(ctx, id)
+}
+
+var providers = map[string]DataProvider{}
+var providerMutex = &sync.RWMutex{}
+
+// loadBuiltin Declaration for spawn.load(kind, id)
+var loadBuiltin = &ast.Builtin{
+	Name: "spawn.load",
+	Decl: types.NewFunction(types.Args(types.S, types.A), types.A),
+}
+
+// RegisterDataProvider Makes the provider available to policies as
+// spawn.load(kind, id).  Registering the same kind again replaces the
+// previous provider
+func RegisterDataProvider(kind string, provider DataProvider) {
+	providerMutex.Lock()
+	providers[kind] = provider
+	providerMutex.Unlock()
+}
+
+func getDataProvider(kind string) (DataProvider, bool) {
+	providerMutex.RLock()
+	p, ok := providers[kind]
+	providerMutex.RUnlock()
+
+	return p, ok
+}
+
+// newCompiler Returns a compiler aware of spawn's custom built-ins, so that
+// policies using them will compile
+func newCompiler() *ast.Compiler {
+	return ast.NewCompiler().WithBuiltins(map[string]*ast.Builtin{
+		loadBuiltin.Name: loadBuiltin,
+	})
+}
+
+// loadFunction Rego option providing the spawn.load implementation
+func loadFunction() func(*rego.Rego) {
+	return rego.Function2(
+		&rego.Function{Name: loadBuiltin.Name, Decl: loadBuiltin.Decl},
+		spawnLoad,
+	)
+}
+
+// spawnLoad Fetches the record from the provider registered for kind.
+// Results are remembered in the request's shared data store, so each record
+// is only loaded once per request however many policies ask for it.  A nil
+// record is treated as undefined
+func spawnLoad(bctx rego.BuiltinContext, kindTerm *ast.Term, idTerm *ast.Term) (*ast.Term, error) {
+	span, ctx := opentracing.StartSpanFromContext(bctx.Context, "spawnLoad")
+	defer span.Finish()
+
+	kind, ok := kindTerm.Value.(ast.String)
+	if !ok {
+		return nil, fmt.Errorf("%s: kind must be a string", loadBuiltin.Name)
+	}
+
+	id, err := ast.JSON(idTerm.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, ok := getDataProvider(string(kind))
+	if !ok {
+		return nil, fmt.Errorf("%s: no data provider registered for '%s'", loadBuiltin.Name, kind)
+	}
+
+	// The term's canonical form keeps ids such as "1" and 1 apart:
+	cacheName := fmt.Sprintf("%s:%s:%s", loadBuiltin.Name, kind, idTerm)
+	if v, err := store.ContextReadValue(ctx, vars.SharedData, cacheName); err == nil && v != nil {
+		return v.(*ast.Term), nil
+	}
+
+	record, err := provider.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if record == nil {
+		return nil, nil
+	}
+
+	value, err := ast.InterfaceToValue(record)
+	if err != nil {
+		return nil, err
+	}
+
+	term := ast.NewTerm(value)
+	// Without a store in context we simply don't memoise:
+	_ = store.ContextAddValue(ctx, vars.SharedData, cacheName, term)
+
+	return term, nil
+}
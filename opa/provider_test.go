@@ -0,0 +1,97 @@
+package opa
+
+import (
+	"context"
+	"testing"
+
+	"github.com/episub/spawn/store"
+	"github.com/episub/spawn/vars"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// countingProvider Counts how many records are loaded.  Loading 'missing'
+// returns no record
+type countingProvider struct {
+	loads int
+}
+
+func (p *countingProvider) Load(ctx context.Context, id interface{}) (interface{}, error) {
+	p.loads++
+	if id == "missing" {
+		return nil, nil
+	}
+
+	return map[string]interface{}{"id": id, "name": "Alice"}, nil
+}
+
+func TestSpawnLoadMemoised(t *testing.T) {
+	provider := &countingProvider{}
+	RegisterDataProvider("testUser", provider)
+
+	request := context.WithValue(context.Background(), vars.SharedData, store.NewDataStore())
+	other := context.WithValue(context.Background(), vars.SharedData, store.NewDataStore())
+
+	var tests = []struct {
+		Name  string
+		Ctx   context.Context
+		ID    *ast.Term
+		Loads int
+	}{
+		{"First load", request, ast.StringTerm("1"), 1},
+		{"Same record", request, ast.StringTerm("1"), 1},
+		{"Other record", request, ast.StringTerm("2"), 2},
+		{"Number with the same text", request, ast.IntNumberTerm(1), 3},
+		{"Same number", request, ast.IntNumberTerm(1), 3},
+		{"Other request", other, ast.StringTerm("1"), 4},
+		{"Without store", context.Background(), ast.StringTerm("1"), 5},
+		{"Without store again", context.Background(), ast.StringTerm("1"), 6},
+	}
+
+	for _, test := range tests {
+		term, err := spawnLoad(rego.BuiltinContext{Context: test.Ctx}, ast.StringTerm("testUser"), test.ID)
+		if err != nil {
+			t.Fatalf("%s: %s", test.Name, err)
+		}
+
+		if term == nil {
+			t.Errorf("%s: Expected a record", test.Name)
+		}
+
+		if provider.loads != test.Loads {
+			t.Errorf("%s: Expected %d loads, but was %d", test.Name, test.Loads, provider.loads)
+		}
+	}
+
+	term, err := spawnLoad(rego.BuiltinContext{Context: request}, ast.StringTerm("testUser"), ast.StringTerm("missing"))
+	if err != nil || term != nil {
+		t.Errorf("Expected a nil record to be undefined, but was %v with error %v", term, err)
+	}
+
+	if _, err := spawnLoad(rego.BuiltinContext{Context: request}, ast.StringTerm("unknown"), ast.StringTerm("1")); err == nil {
+		t.Errorf("Expected error loading a kind without a provider")
+	}
+}
+
+func TestSpawnLoadInPolicy(t *testing.T) {
+	provider := &countingProvider{}
+	RegisterDataProvider("testUser", provider)
+
+	ctx := context.WithValue(context.Background(), vars.SharedData, store.NewDataStore())
+
+	rs, err := rego.New(
+		rego.Query(`spawn.load("testUser", "1").name == spawn.load("testUser", "1").name`),
+		loadFunction(),
+	).Eval(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rs) == 0 || rs[0].Expressions[0].Value != true {
+		t.Errorf("Expected the record to be loaded, but had %v", rs)
+	}
+
+	if provider.loads != 1 {
+		t.Errorf("Expected the record loaded once, but was %d times", provider.loads)
+	}
+}
@@ -0,0 +1,6 @@
+package api.query.report
+
+# Not evaluated by any test or fixture:
+allow {
+	input.user.role == "auditor"
+}
@@ -0,0 +1,18 @@
+package api.query.todo
+
+default allow = false
+
+allow {
+	input.user.role == "admin"
+}
+
+limit = 5
+
+test_admin_allowed {
+	allow with input as {"user": {"role": "admin"}}
+}
+
+# Fails, since staff are not allowed:
+test_staff_allowed {
+	allow with input as {"user": {"role": "staff"}}
+}
@@ -0,0 +1,344 @@
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/cover"
+	"github.com/open-policy-agent/opa/loader"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/inmem"
+)
+
+// testPrefix Rules starting with this prefix are treated as tests
+const testPrefix = "test_"
+
+// coveragePrefix Only rules under this path are reported on for coverage,
+// since these are the ones called by ResolverMiddleware
+const coveragePrefix = "data.api."
+
+// Fixture A recorded policy request, which can be replayed against the
+// bundle to check that the decision has not changed.  Input uses the same
+// shape as sent by ResolverMiddleware (arguments, entity, user, fieldValue)
+type Fixture struct {
+	Name     string                 `json:"name"`
+	Query    string                 `json:"query"`
+	Input    map[string]interface{} `json:"input"`
+	Expected interface{}            `json:"expected"`
+}
+
+// TestResult Outcome of a single rego test or fixture replay
+type TestResult struct {
+	Name     string
+	Passed   bool
+	Error    error
+	Duration time.Duration
+}
+
+// RuleCoverage Coverage of a single data.api rule, as a percentage
+type RuleCoverage struct {
+	Rule     string
+	Coverage float64
+}
+
+// TestReport Results of running policy tests and fixtures against a bundle
+type TestReport struct {
+	Results  []TestResult
+	Coverage []RuleCoverage
+}
+
+// Failed Returns the number of tests that did not pass
+func (t TestReport) Failed() int {
+	var failed int
+	for _, r := range t.Results {
+		if !r.Passed {
+			failed++
+		}
+	}
+
+	return failed
+}
+
+// RunTests Runs all rego rules prefixed with 'test_' found in the bundle at
+// bundlePath, then replays each fixture found in fixturesPath (if not empty).
+// Coverage is reported for each rule under data.api
+func RunTests(ctx context.Context, bundlePath string, fixturesPath string) (TestReport, error) {
+	var report TestReport
+
+	result, err := loader.Filtered([]string{bundlePath}, nil)
+	if err != nil {
+		return report, fmt.Errorf("Error loading bundle: %s", err)
+	}
+
+	modules := make(map[string]*ast.Module)
+	for k, v := range result.Modules {
+		modules[k] = v.Parsed
+	}
+
+	compiler := newCompiler()
+	compiler.Compile(modules)
+	if compiler.Failed() {
+		return report, compiler.Errors
+	}
+
+	store := inmem.NewFromObject(result.Documents)
+	cov := cover.New()
+
+	for _, name := range testRules(modules) {
+		report.Results = append(report.Results, runTest(ctx, compiler, store, cov, name))
+	}
+
+	if len(fixturesPath) > 0 {
+		fixtures, err := LoadFixtures(fixturesPath)
+		if err != nil {
+			return report, err
+		}
+
+		for _, f := range fixtures {
+			report.Results = append(report.Results, runFixture(ctx, compiler, store, cov, f))
+		}
+	}
+
+	report.Coverage = ruleCoverage(modules, cov.Report(modules))
+
+	return report, nil
+}
+
+// testRules Returns the full path of each test rule, sorted and without
+// duplicates
+func testRules(modules map[string]*ast.Module) []string {
+	seen := make(map[string]bool)
+	var names []string
+
+	for _, m := range modules {
+		for _, r := range m.Rules {
+			if !strings.HasPrefix(string(r.Head.Name), testPrefix) {
+				continue
+			}
+
+			name := fmt.Sprintf("%s.%s", m.Package.Path, r.Head.Name)
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func runTest(ctx context.Context, compiler *ast.Compiler, store storage.Store, cov *cover.Cover, name string) TestResult {
+	result := TestResult{Name: name}
+	start := time.Now()
+
+	value, err := evalQuery(ctx, compiler, store, cov, name, nil)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+
+	result.Passed = value == true
+	if !result.Passed {
+		result.Error = fmt.Errorf("Expected true, but was %v", value)
+	}
+
+	return result
+}
+
+func runFixture(ctx context.Context, compiler *ast.Compiler, store storage.Store, cov *cover.Cover, f Fixture) TestResult {
+	result := TestResult{Name: f.Name}
+	if len(result.Name) == 0 {
+		result.Name = f.Query
+	}
+	start := time.Now()
+
+	value, err := evalQuery(ctx, compiler, store, cov, f.Query, f.Input)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+
+	result.Passed = reflect.DeepEqual(value, f.Expected)
+	if !result.Passed {
+		result.Error = fmt.Errorf("Expected %v, but was %v", f.Expected, value)
+	}
+
+	return result
+}
+
+// evalQuery Evaluates the query, returning the value of the first expression,
+// or nil if undefined
+func evalQuery(
+	ctx context.Context,
+	compiler *ast.Compiler,
+	store storage.Store,
+	cov *cover.Cover,
+	query string,
+	input map[string]interface{},
+) (interface{}, error) {
+	options := []func(*rego.Rego){
+		rego.Query(query),
+		rego.Compiler(compiler),
+		rego.Store(store),
+		rego.Tracer(cov),
+		loadFunction(),
+	}
+	if input != nil {
+		options = append(options, rego.Input(input))
+	}
+
+	rs, err := rego.New(options...).Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
+		return nil, nil
+	}
+
+	return rs[0].Expressions[0].Value, nil
+}
+
+// ruleCoverage Works out what fraction of each data.api rule's lines were
+// evaluated
+func ruleCoverage(modules map[string]*ast.Module, report cover.Report) []RuleCoverage {
+	covered := make(map[string]int)
+	total := make(map[string]int)
+
+	for file, m := range modules {
+		// Files that no test evaluated have no report, but their rules are
+		// still listed, with no coverage:
+		var coveredRows, notCoveredRows []cover.Range
+		if fr, ok := report.Files[file]; ok {
+			coveredRows, notCoveredRows = fr.Covered, fr.NotCovered
+		}
+
+		for _, r := range m.Rules {
+			name := fmt.Sprintf("%s.%s", m.Package.Path, r.Head.Name)
+			if !strings.HasPrefix(name, coveragePrefix) || strings.HasPrefix(string(r.Head.Name), testPrefix) || r.Location == nil {
+				continue
+			}
+
+			start := r.Location.Row
+			end := start + strings.Count(string(r.Location.Text), "\n")
+
+			covered[name] += rowsInRange(coveredRows, start, end)
+			total[name] += rowsInRange(coveredRows, start, end) + rowsInRange(notCoveredRows, start, end)
+		}
+	}
+
+	var rules []RuleCoverage
+	for name, t := range total {
+		c := RuleCoverage{Rule: name}
+		if t > 0 {
+			c.Coverage = 100 * float64(covered[name]) / float64(t)
+		}
+		rules = append(rules, c)
+	}
+
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Rule < rules[j].Rule })
+
+	return rules
+}
+
+// rowsInRange Counts how many rows from the ranges fall between start and end
+// inclusive
+func rowsInRange(ranges []cover.Range, start int, end int) int {
+	var count int
+	for _, r := range ranges {
+		for row := r.Start.Row; row <= r.End.Row; row++ {
+			if row >= start && row <= end {
+				count++
+			}
+		}
+	}
+
+	return count
+}
+
+// LoadFixtures Loads all fixtures from .json files in the given folder.  Each
+// file may hold a single fixture or an array of fixtures
+func LoadFixtures(path string) ([]Fixture, error) {
+	var fixtures []Fixture
+
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || filepath.Ext(p) != ".json" {
+			return nil
+		}
+
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		f, err := decodeFixtures(b)
+		if err != nil {
+			return fmt.Errorf("Error reading fixture %s: %s", p, err)
+		}
+
+		fixtures = append(fixtures, f...)
+		return nil
+	})
+
+	return fixtures, err
+}
+
+// decodeFixtures Decodes one or many fixtures.  Numbers are kept as
+// json.Number so they compare equal to values returned by rego
+func decodeFixtures(b []byte) ([]Fixture, error) {
+	var fixtures []Fixture
+
+	trimmed := strings.TrimSpace(string(b))
+	d := json.NewDecoder(strings.NewReader(trimmed))
+	d.UseNumber()
+
+	if strings.HasPrefix(trimmed, "[") {
+		err := d.Decode(&fixtures)
+		return fixtures, err
+	}
+
+	var f Fixture
+	err := d.Decode(&f)
+	return append(fixtures, f), err
+}
+
+// recordFixture Writes the request and its result to folder as a fixture, so
+// that it can later be replayed with RunTests
+func recordFixture(folder string, query string, input map[string]interface{}, rs rego.ResultSet) error {
+	f := Fixture{
+		Name:  query,
+		Query: query,
+		Input: input,
+	}
+
+	if len(rs) > 0 && len(rs[0].Expressions) > 0 {
+		f.Expected = rs[0].Expressions[0].Value
+	}
+
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.json", time.Now().UnixNano(), strings.Replace(query, ".", "_", -1))
+
+	return ioutil.WriteFile(filepath.Join(folder, name), b, 0644)
+}
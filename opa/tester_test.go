@@ -0,0 +1,119 @@
+package opa
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/cover"
+)
+
+const testerBundle = "testdata/tester/bundle"
+const testerFixtures = "testdata/tester/fixtures"
+
+func TestLoadFixtures(t *testing.T) {
+	fixtures, err := LoadFixtures(testerFixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One from a single fixture file, and three from a list:
+	if len(fixtures) != 4 {
+		t.Fatalf("Expected 4 fixtures, but had %d", len(fixtures))
+	}
+
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "bad.json"), []byte(`{"name": `), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadFixtures(dir); err == nil {
+		t.Errorf("Expected error loading invalid fixture")
+	}
+}
+
+func TestRunTests(t *testing.T) {
+	report, err := RunTests(context.Background(), testerBundle, testerFixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		Name   string
+		Passed bool
+	}{
+		{"data.api.query.todo.test_admin_allowed", true},
+		{"data.api.query.todo.test_staff_allowed", false},
+		{"admin", true},
+		{"staff", true},
+		{"wrong", false},
+		{"limit", true},
+	}
+
+	results := make(map[string]TestResult)
+	for _, r := range report.Results {
+		results[r.Name] = r
+	}
+
+	for _, test := range tests {
+		r, ok := results[test.Name]
+		if !ok {
+			t.Errorf("%s: Expected a result", test.Name)
+			continue
+		}
+
+		if r.Passed != test.Passed {
+			t.Errorf("%s: Expected passed %t, but was %t with error %v", test.Name, test.Passed, r.Passed, r.Error)
+		}
+	}
+
+	if len(report.Results) != len(tests) || report.Failed() != 2 {
+		t.Errorf("Expected %d results with 2 failed, but had %d with %d failed", len(tests), len(report.Results), report.Failed())
+	}
+}
+
+func TestRunTestsCoverage(t *testing.T) {
+	report, err := RunTests(context.Background(), testerBundle, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	coverage := make(map[string]float64)
+	for _, c := range report.Coverage {
+		coverage[c.Rule] = c.Coverage
+	}
+
+	if coverage["data.api.query.todo.allow"] <= 0 {
+		t.Errorf("Expected allow covered by tests, but was %.0f%%", coverage["data.api.query.todo.allow"])
+	}
+
+	if c, ok := coverage["data.api.query.report.allow"]; !ok || c != 0 {
+		t.Errorf("Expected rule without tests listed with no coverage, but was %.0f%% and listed %t", c, ok)
+	}
+
+	for rule := range coverage {
+		if rule == "data.api.query.todo.test_admin_allowed" || rule == "data.api.query.todo.test_staff_allowed" {
+			t.Errorf("Expected test rules left out of coverage, but had %s", rule)
+		}
+	}
+}
+
+func TestRuleCoverageWithoutReport(t *testing.T) {
+	modules := map[string]*ast.Module{
+		"report.rego": ast.MustParseModule("package api.query.report\n\nallow {\n\tinput.user.admin\n}\n"),
+	}
+
+	rules := ruleCoverage(modules, cover.Report{})
+	if len(rules) != 1 || rules[0].Rule != "data.api.query.report.allow" || rules[0].Coverage != 0 {
+		t.Errorf("Expected rule in a file without a report listed with no coverage, but had %+v", rules)
+	}
+}
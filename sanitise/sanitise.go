@@ -0,0 +1,167 @@
+// Package sanitise Normalises input values before they are validated and
+// stored, e.g., so that usernames differing only in case or Unicode form are
+// treated as the same
+package sanitise
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Rule Transforms a value
+type Rule func(string) string
+
+// Fields Rules for each field of a model, keyed by the field's name in the
+// input, e.g., "username"
+type Fields map[string][]Rule
+
+var (
+	modelsMu sync.RWMutex
+	models   = map[string]Fields{}
+)
+
+// Register Sets the rules for the fields of a model, by its model name,
+// e.g., "User".  Call at start up
+func Register(model string, fields Fields) {
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+
+	models[model] = fields
+}
+
+// Input Applies the model's rules to the string values in input, replacing
+// them.  Used by the generated create and update functions before any
+// values are set
+func Input(model string, input map[string]interface{}) {
+	modelsMu.RLock()
+	fields := models[model]
+	modelsMu.RUnlock()
+
+	for k, rules := range fields {
+		switch v := input[k].(type) {
+		case string:
+			input[k] = Apply(v, rules...)
+		case *string:
+			if v != nil {
+				s := Apply(*v, rules...)
+				input[k] = &s
+			}
+		}
+	}
+}
+
+// Field Applies the rules for a model's field to v, e.g., to look up a user
+// by a username entered at login in the same form it was stored
+func Field(model string, field string, v string) string {
+	modelsMu.RLock()
+	rules := models[model][field]
+	modelsMu.RUnlock()
+
+	return Apply(v, rules...)
+}
+
+// Apply Applies the rules to v in order
+func Apply(v string, rules ...Rule) string {
+	for _, r := range rules {
+		v = r(v)
+	}
+
+	return v
+}
+
+// NFC Normalises v to Unicode Normalization Form C, so that characters which
+// can be written more than one way, such as é as one character or as e and
+// an accent, are written the same
+func NFC(v string) string {
+	return norm.NFC.String(v)
+}
+
+// NFKC Normalises v to Unicode Normalization Form KC, which also replaces
+// compatibility characters with their plain equivalents, e.g., ﬁ with fi
+// and full width letters with ASCII.  Suits identifiers such as usernames,
+// but loses formatting in other text
+func NFKC(v string) string {
+	return norm.NFKC.String(v)
+}
+
+// Trim Removes leading and trailing white space
+func Trim(v string) string {
+	return strings.TrimSpace(v)
+}
+
+// CollapseSpace Trims v, and replaces each run of white space within it,
+// including new lines, with a single space
+func CollapseSpace(v string) string {
+	return strings.Join(strings.Fields(v), " ")
+}
+
+// FoldCase Folds v to a form in which case is ignored, which is lower case
+// for most text, but handles letters whose upper and lower case differ in
+// length, e.g., ß and SS.  Normalise to NFC first
+func FoldCase(v string) string {
+	return norm.NFC.String(cases.Fold().String(v))
+}
+
+// Lower Converts v to lower case
+func Lower(v string) string {
+	return strings.ToLower(v)
+}
+
+var (
+	// scriptRx Elements whose content isn't text
+	scriptRx  = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)\s*>`)
+	commentRx = regexp.MustCompile(`(?s)<!--.*?-->`)
+	tagRx     = regexp.MustCompile(`(?s)</?[a-zA-Z][^>]*>`)
+)
+
+// StripHTML Removes HTML tags, comments, and scripts and styles including
+// their content, then replaces entities such as &amp; with their characters.
+// Tags written with entities, e.g., &lt;script&gt;, are removed too.  The
+// result is plain text, which must still be escaped to be shown as HTML
+func StripHTML(v string) string {
+	v = stripTags(v)
+
+	// Replacing entities may produce new tags, so strip those as well:
+	return stripTags(html.UnescapeString(v))
+}
+
+// stripTags Removes tags, comments, and scripts and styles with their content
+func stripTags(v string) string {
+	v = scriptRx.ReplaceAllString(v, "")
+	v = commentRx.ReplaceAllString(v, "")
+
+	return tagRx.ReplaceAllString(v, "")
+}
+
+// StripControl Removes control characters, other than tabs and new lines,
+// and invisible formatting characters such as zero width spaces and
+// direction overrides
+func StripControl(v string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			return r
+		case unicode.IsControl(r) || unicode.Is(unicode.Cf, r):
+			return -1
+		}
+		return r
+	}, v)
+}
+
+// Identifier Rules for values that identify something, such as usernames
+// and email addresses, so that values differing only in case, Unicode form,
+// spacing or invisible characters are the same
+var Identifier = []Rule{StripControl, NFKC, Trim, FoldCase}
+
+// Text Rules for single line text, such as names
+var Text = []Rule{StripControl, NFC, CollapseSpace}
+
+// MultilineText Rules for text that may have several lines, such as
+// descriptions
+var MultilineText = []Rule{StripControl, NFC, Trim}
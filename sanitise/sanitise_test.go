@@ -0,0 +1,69 @@
+package sanitise
+
+import "testing"
+
+func TestRules(t *testing.T) {
+	var tests = []struct {
+		Name     string
+		Rules    []Rule
+		Value    string
+		Expected string
+	}{
+		{"NFC", []Rule{NFC}, "José", "José"},
+		{"NFKC", []Rule{NFKC}, "ｃｏｏｌﬁsh", "coolfish"},
+		{"Trim", []Rule{Trim}, "  cool cat \n", "cool cat"},
+		{"CollapseSpace", []Rule{CollapseSpace}, "  Jane \t\n  Doe ", "Jane Doe"},
+		{"FoldCase", []Rule{FoldCase}, "CoolCat STRASSE straße", "coolcat strasse strasse"},
+		{"Lower", []Rule{Lower}, "CoolCat", "coolcat"},
+		{"StripHTML", []Rule{StripHTML}, `<p class="x">Fish &amp; <b>chips</b></p><script>alert("hi")</script><!-- note -->`, "Fish & chips"},
+		{"StripHTML comparisons", []Rule{StripHTML}, "1 < 2 and 3 > 2", "1 < 2 and 3 > 2"},
+		{"StripHTML escaped tags", []Rule{StripHTML}, "Hi &lt;script&gt;alert(1)&lt;/script&gt;&lt;img src=x onerror=alert(1)&gt;", "Hi "},
+		{"StripHTML escaped comparisons", []Rule{StripHTML}, "1 &lt; 2", "1 < 2"},
+		{"StripControl", []Rule{StripControl}, "cool\x00cat\u200b\u202e\x1b\tok\n", "coolcat\tok\n"},
+		{"Identifier", Identifier, " Cool\u200bＣat ", "coolcat"},
+		{"Text", Text, "José \n Smith\x07", "José Smith"},
+	}
+
+	for _, test := range tests {
+		if res := Apply(test.Value, test.Rules...); res != test.Expected {
+			t.Errorf("%s: Expected '%q', but was '%q'", test.Name, test.Expected, res)
+		}
+	}
+}
+
+func TestInput(t *testing.T) {
+	Register("User", Fields{
+		"username": Identifier,
+		"name":     Text,
+	})
+
+	name := " Jane   Doe "
+	input := map[string]interface{}{
+		"username": "CoolCat",
+		"name":     &name,
+		"password": " Pass\u200bword ",
+		"age":      30,
+	}
+
+	Input("User", input)
+
+	if input["username"] != "coolcat" {
+		t.Errorf("Expected username normalised, but was '%v'", input["username"])
+	}
+
+	if n := input["name"].(*string); *n != "Jane Doe" || name != " Jane   Doe " {
+		t.Errorf("Expected name normalised without changing original, but was '%s' and '%s'", *n, name)
+	}
+
+	if input["password"] != " Pass\u200bword " || input["age"] != 30 {
+		t.Errorf("Expected fields without rules unchanged")
+	}
+
+	if u := Field("User", "username", "COOLCAT"); u != "coolcat" {
+		t.Errorf("Expected field normalised, but was '%s'", u)
+	}
+
+	if v := Field("Todo", "text", " As is "); v != " As is " {
+		t.Errorf("Expected unregistered model unchanged, but was '%s'", v)
+	}
+}
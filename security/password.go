@@ -0,0 +1,219 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithms supported by Hash
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+// bcryptMaxLength bcrypt ignores anything in the password beyond this many
+// bytes
+const bcryptMaxLength = 72
+
+// Limits on the argon2id parameters of stored hashes, well above
+// DefaultHashParams.  The parameters come from the stored hash, so without
+// these a corrupt or tampered hash could use all the memory or CPU
+const (
+	// argon2MaxMemory 1 GiB, in KiB
+	argon2MaxMemory      = 1024 * 1024
+	argon2MaxIterations  = 64
+	argon2MaxParallelism = 64
+	argon2MaxKeyLength   = 1024
+)
+
+var (
+	// ErrUnknownHashFormat Stored hash isn't in a format we recognise
+	ErrUnknownHashFormat = errors.New("Unknown password hash format")
+	// ErrPasswordTooLong Password is longer than bcrypt can hash without
+	// truncating it
+	ErrPasswordTooLong = fmt.Errorf("Password must be no longer than %d bytes when hashed with bcrypt", bcryptMaxLength)
+)
+
+// HashParams Algorithm and parameters used to hash new passwords.  Memory,
+// Iterations, Parallelism, SaltLength and KeyLength apply to argon2id, and
+// Cost to bcrypt
+type HashParams struct {
+	Algorithm string
+	// Memory In KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+	Cost        int
+}
+
+// DefaultHashParams Used by Hash, and by AuthenticatePassword to decide
+// whether a stored hash should be upgraded.  Projects can change these at
+// start up, and existing passwords are rehashed as users log in.  Defaults
+// follow the OWASP recommendation for argon2id
+var DefaultHashParams = HashParams{
+	Algorithm:   Argon2id,
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+	Cost:        bcryptCost,
+}
+
+// Hash Returns the hash of password using DefaultHashParams.  Argon2id hashes
+// are returned as PHC strings, e.g., $argon2id$v=19$m=65536,t=3,p=2$salt$key,
+// and bcrypt hashes in bcrypt's own $2a$ format.  Both include their salt and
+// parameters, so no separate salt needs storing
+func Hash(password []byte) ([]byte, error) {
+	return HashWithParams(password, DefaultHashParams)
+}
+
+// HashWithParams Returns the hash of password using params
+func HashWithParams(password []byte, params HashParams) ([]byte, error) {
+	switch params.Algorithm {
+	case Argon2id:
+		salt := make([]byte, params.SaltLength)
+		_, err := io.ReadFull(rand.Reader, salt)
+		if err != nil {
+			return nil, err
+		}
+
+		key := argon2.IDKey(password, salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+		return []byte(fmt.Sprintf(
+			"$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			Argon2id,
+			argon2.Version,
+			params.Memory,
+			params.Iterations,
+			params.Parallelism,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key),
+		)), nil
+	case Bcrypt:
+		// Refuse rather than silently ignoring the end of the password:
+		if len(password) > bcryptMaxLength {
+			return nil, ErrPasswordTooLong
+		}
+
+		return bcrypt.GenerateFromPassword(password, params.Cost)
+	default:
+		return nil, fmt.Errorf("Unsupported hash algorithm '%s'", params.Algorithm)
+	}
+}
+
+// AuthenticatePassword Returns nil if providedPassword matches the stored
+// hash, along with whether the hash should be replaced with one from Hash.
+// That is the case for hashes made with HashPassword, which used a separate
+// salt, and for hashes whose algorithm or parameters differ from
+// DefaultHashParams.  salt is only used for HashPassword hashes, and should
+// be empty otherwise
+func AuthenticatePassword(ctx context.Context, salt []byte, hashedPassword []byte, providedPassword []byte) (bool, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "AuthenticatePassword")
+	defer span.Finish()
+
+	switch {
+	case bytes.HasPrefix(hashedPassword, []byte("$"+Argon2id+"$")):
+		return verifyArgon2id(hashedPassword, providedPassword)
+	case bytes.HasPrefix(hashedPassword, []byte("$2")):
+		return verifyBcrypt(salt, hashedPassword, providedPassword)
+	default:
+		return false, ErrUnknownHashFormat
+	}
+}
+
+// verifyArgon2id Checks password against a PHC encoded argon2id hash
+func verifyArgon2id(hashedPassword []byte, password []byte) (bool, error) {
+	// "", "argon2id", "v=19", "m=65536,t=3,p=2", salt, key:
+	parts := strings.Split(string(hashedPassword), "$")
+	if len(parts) != 6 {
+		return false, ErrUnknownHashFormat
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return false, ErrUnknownHashFormat
+	}
+
+	var params HashParams
+	params.Algorithm = Argon2id
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return false, ErrUnknownHashFormat
+	}
+
+	// argon2 panics without at least one iteration and thread:
+	if params.Iterations < 1 || params.Iterations > argon2MaxIterations ||
+		params.Parallelism < 1 || params.Parallelism > argon2MaxParallelism ||
+		params.Memory < 8*uint32(params.Parallelism) || params.Memory > argon2MaxMemory {
+		return false, ErrUnknownHashFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrUnknownHashFormat
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 || len(key) > argon2MaxKeyLength {
+		return false, ErrUnknownHashFormat
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	provided := argon2.IDKey(password, salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, provided) != 1 {
+		return false, ErrMismatchedHashAndPassword
+	}
+
+	d := DefaultHashParams
+	needsRehash := d.Algorithm != Argon2id ||
+		params.Memory != d.Memory ||
+		params.Iterations != d.Iterations ||
+		params.Parallelism != d.Parallelism ||
+		params.SaltLength < d.SaltLength ||
+		params.KeyLength < d.KeyLength
+
+	return needsRehash, nil
+}
+
+// verifyBcrypt Checks password against a bcrypt hash, made either by Hash or
+// by HashPassword with a separate salt
+func verifyBcrypt(salt []byte, hashedPassword []byte, password []byte) (bool, error) {
+	err := bcrypt.CompareHashAndPassword(hashedPassword, combinePasswordAndSalt(password, salt))
+
+	// Use our own customised error so that we are not bound to bcrypt for statements about password validity
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, ErrMismatchedHashAndPassword
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Hashes with a separate salt may have been truncated, so are always
+	// upgraded:
+	if len(salt) > 0 {
+		return true, nil
+	}
+
+	cost, err := bcrypt.Cost(hashedPassword)
+	if err != nil {
+		return false, err
+	}
+
+	return DefaultHashParams.Algorithm != Bcrypt || cost != DefaultHashParams.Cost, nil
+}
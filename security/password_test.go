@@ -0,0 +1,177 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testHashParams Cheap argon2id parameters so that tests run quickly
+var testHashParams = HashParams{
+	Algorithm:   Argon2id,
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+	Cost:        4,
+}
+
+// withDefaultHashParams Runs f with DefaultHashParams set to params
+func withDefaultHashParams(params HashParams, f func()) {
+	previous := DefaultHashParams
+	DefaultHashParams = params
+	defer func() { DefaultHashParams = previous }()
+
+	f()
+}
+
+func TestHash(t *testing.T) {
+	bcryptParams := testHashParams
+	bcryptParams.Algorithm = Bcrypt
+
+	for _, params := range []HashParams{testHashParams, bcryptParams} {
+		withDefaultHashParams(params, func() {
+			hash, err := Hash([]byte("correct horse"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rehash, err := AuthenticatePassword(context.Background(), nil, hash, []byte("correct horse"))
+			if err != nil {
+				t.Errorf("%s: Expected password to match %s, but got %s", params.Algorithm, hash, err)
+			}
+			if rehash {
+				t.Errorf("%s: Expected no rehash for hash made with current parameters", params.Algorithm)
+			}
+
+			_, err = AuthenticatePassword(context.Background(), nil, hash, []byte("wrong horse"))
+			if err != ErrMismatchedHashAndPassword {
+				t.Errorf("%s: Expected ErrMismatchedHashAndPassword, but got %v", params.Algorithm, err)
+			}
+		})
+	}
+}
+
+func TestHashPHCFormat(t *testing.T) {
+	hash, err := HashWithParams([]byte("password"), testHashParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(hash, []byte("$argon2id$v=19$m=1024,t=1,p=1$")) {
+		t.Errorf("Unexpected hash format: %s", hash)
+	}
+
+	if n := strings.Count(string(hash), "$"); n != 5 {
+		t.Errorf("Expected 5 separators, but was %d: %s", n, hash)
+	}
+}
+
+func TestAuthenticatePasswordNeedsRehash(t *testing.T) {
+	salt := []byte("salt")
+	legacy, err := HashPassword([]byte("password"), salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	weaker := testHashParams
+	weaker.Memory = 512
+	weak, err := HashWithParams([]byte("password"), weaker)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bcryptParams := testHashParams
+	bcryptParams.Algorithm = Bcrypt
+	bcryptHash, err := HashWithParams([]byte("password"), bcryptParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		Name string
+		Salt []byte
+		Hash []byte
+	}{
+		{Name: "Legacy salted bcrypt", Salt: salt, Hash: legacy},
+		{Name: "Weaker argon2id", Hash: weak},
+		{Name: "Bcrypt when argon2id preferred", Hash: bcryptHash},
+	}
+
+	withDefaultHashParams(testHashParams, func() {
+		for _, test := range tests {
+			rehash, err := AuthenticatePassword(context.Background(), test.Salt, test.Hash, []byte("password"))
+			if err != nil {
+				t.Errorf("%s: Expected password to match, but got %s", test.Name, err)
+			}
+			if !rehash {
+				t.Errorf("%s: Expected rehash", test.Name)
+			}
+		}
+	})
+}
+
+func TestHashBcryptTooLong(t *testing.T) {
+	params := testHashParams
+	params.Algorithm = Bcrypt
+
+	_, err := HashWithParams(bytes.Repeat([]byte("a"), bcryptMaxLength+1), params)
+	if err != ErrPasswordTooLong {
+		t.Errorf("Expected ErrPasswordTooLong, but got %v", err)
+	}
+
+	// argon2id has no such limit, and must not ignore the end of the password:
+	long := bytes.Repeat([]byte("a"), 100)
+	hash, err := HashWithParams(long, testHashParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withDefaultHashParams(testHashParams, func() {
+		_, err = AuthenticatePassword(context.Background(), nil, hash, append(long[:99:99], 'b'))
+		if err != ErrMismatchedHashAndPassword {
+			t.Errorf("Expected mismatch for password differing after 72 bytes, but got %v", err)
+		}
+	})
+}
+
+func TestAuthenticatePasswordUnknownFormat(t *testing.T) {
+	for _, hash := range []string{"", "plain", "$argon2id$v=19$m=1024$abc$def", "$argon2id$v=18$m=1024,t=1,p=1$YWJj$ZGVm"} {
+		_, err := AuthenticatePassword(context.Background(), nil, []byte(hash), []byte("password"))
+		if err == nil {
+			t.Errorf("Expected error for hash '%s'", hash)
+		}
+	}
+}
+
+func TestAuthenticatePasswordOutOfRangeParams(t *testing.T) {
+	key := base64.RawStdEncoding.EncodeToString(make([]byte, 32))
+	long := base64.RawStdEncoding.EncodeToString(make([]byte, 2048))
+
+	var tests = []struct {
+		Name   string
+		Params string
+		Key    string
+	}{
+		{"No iterations", "m=65536,t=0,p=2", key},
+		{"No threads", "m=65536,t=3,p=0", key},
+		{"Too many iterations", "m=65536,t=1000000,p=2", key},
+		{"Too many threads", "m=65536,t=3,p=255", key},
+		{"Too much memory", "m=4294967295,t=3,p=2", key},
+		{"Too little memory", "m=8,t=3,p=2", key},
+		{"Key too long", "m=65536,t=3,p=2", long},
+	}
+
+	for _, test := range tests {
+		hash := fmt.Sprintf("$argon2id$v=19$%s$c2FsdHNhbHRzYWx0c2FsdA$%s", test.Params, test.Key)
+
+		_, err := AuthenticatePassword(context.Background(), nil, []byte(hash), []byte("password"))
+		if err != ErrUnknownHashFormat {
+			t.Errorf("%s: Expected %s, but was %v", test.Name, ErrUnknownHashFormat, err)
+		}
+	}
+}
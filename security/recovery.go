@@ -0,0 +1,66 @@
+package security
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"io"
+	"strings"
+)
+
+const recoveryCodeBytes = 10
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewRecoveryCodes Returns n random single-use recovery codes, formatted for
+// display as xxxx-xxxx-xxxx-xxxx
+func NewRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+
+	for i := range codes {
+		b := make([]byte, recoveryCodeBytes)
+		_, err := io.ReadFull(rand.Reader, b)
+		if err != nil {
+			return nil, err
+		}
+
+		s := strings.ToLower(recoveryEncoding.EncodeToString(b))
+		codes[i] = s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16]
+	}
+
+	return codes, nil
+}
+
+// normaliseRecoveryCode Ignores case, spaces and dashes, since codes are
+// often typed by hand
+func normaliseRecoveryCode(code string) []byte {
+	code = strings.ToLower(code)
+	code = strings.Replace(code, "-", "", -1)
+	code = strings.Replace(code, " ", "", -1)
+
+	return []byte(code)
+}
+
+// HashRecoveryCode Returns the hash of code for storage.  Codes are random
+// with 80 bits of entropy, so like other tokens a fast SHA-256 hash is safe,
+// and checking every unused code on each attempt stays cheap
+func HashRecoveryCode(code string) ([]byte, error) {
+	return []byte(HashToken(string(normaliseRecoveryCode(code)))), nil
+}
+
+// MatchRecoveryCode Returns the index of the hash matching code, or -1 if
+// none match.  Every hash is compared, in constant time, so the time taken
+// doesn't reveal which code matched
+func MatchRecoveryCode(ctx context.Context, hashes [][]byte, code string) int {
+	hash := []byte(HashToken(string(normaliseRecoveryCode(code))))
+	match := -1
+
+	for i, h := range hashes {
+		if subtle.ConstantTimeCompare(h, hash) == 1 && match < 0 {
+			match = i
+		}
+	}
+
+	return match
+}
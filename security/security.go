@@ -6,8 +6,6 @@ import (
 	"errors"
 	"io"
 
-	opentracing "github.com/opentracing/opentracing-go"
-
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -30,7 +28,13 @@ func NewSalt() ([]byte, error) {
 	return salt, nil
 }
 
-// HashPassword Returns password hash given password and salt
+// HashPassword Returns password hash given password and salt.  bcrypt only
+// uses the first 72 bytes of its input, which includes the salt, so long
+// passwords are truncated.
+//
+// Deprecated: Use Hash, which stores the salt in the hash.  Existing hashes
+// are still accepted by AuthenticatePassword, which reports that they need
+// rehashing
 func HashPassword(password []byte, salt []byte) ([]byte, error) {
 	return bcrypt.GenerateFromPassword(combinePasswordAndSalt(password, salt), bcryptCost)
 }
@@ -39,19 +43,9 @@ func combinePasswordAndSalt(password []byte, salt []byte) []byte {
 	return []byte(append(salt, password...))
 }
 
-// AuthenticateUser Returns nil if user has provided password, otherwise error
+// AuthenticateUser Returns nil if user has provided password, otherwise error.
+// Use AuthenticatePassword to also find out if the hash should be upgraded
 func AuthenticateUser(ctx context.Context, salt []byte, hashedPassword []byte, providedPassword []byte) error {
-	span, _ := opentracing.StartSpanFromContext(ctx, "AuthenticateUser")
-	defer span.Finish()
-
-	pwd := combinePasswordAndSalt(providedPassword, salt)
-
-	err := bcrypt.CompareHashAndPassword(hashedPassword, pwd)
-
-	// Use our own customised error so that we are not bound to bcrypt for statements about password validity
-	if err == bcrypt.ErrMismatchedHashAndPassword {
-		return ErrMismatchedHashAndPassword
-	}
-
+	_, err := AuthenticatePassword(ctx, salt, hashedPassword, providedPassword)
 	return err
 }
@@ -0,0 +1,41 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+)
+
+const tokenBytes = 32
+
+// NewToken Returns a random, URL safe token, e.g., for API keys or password
+// reset links
+func NewToken() (string, error) {
+	return randomToken(tokenBytes)
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := io.ReadFull(rand.Reader, b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken Returns the hex encoded SHA-256 hash of the token for storage.
+// Unlike passwords, tokens are random and long enough that a fast hash is
+// safe, which keeps checking them on every request cheap
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// MatchToken Returns true if token has the given hash
+func MatchToken(hash string, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(HashToken(token))) == 1
+}
@@ -0,0 +1,29 @@
+package security
+
+import "testing"
+
+func TestHashToken(t *testing.T) {
+	// SHA-256 of "abc":
+	if h := HashToken("abc"); h != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("Unexpected hash %s", h)
+	}
+}
+
+func TestMatchToken(t *testing.T) {
+	token, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(token) != 43 {
+		t.Errorf("Expected 43 character token, but was %d", len(token))
+	}
+
+	if !MatchToken(HashToken(token), token) {
+		t.Errorf("Expected token to match its hash")
+	}
+
+	if MatchToken(HashToken(token), token+"x") {
+		t.Errorf("Expected different token not to match")
+	}
+}
@@ -0,0 +1,111 @@
+package security
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Vectors SHA1 test vectors from RFC 6238, appendix B
+var rfc6238Vectors = []struct {
+	Time int64
+	Code string
+}{
+	{Time: 59, Code: "94287082"},
+	{Time: 1111111109, Code: "07081804"},
+	{Time: 1111111111, Code: "14050471"},
+	{Time: 1234567890, Code: "89005924"},
+	{Time: 2000000000, Code: "69279037"},
+	{Time: 20000000000, Code: "65353130"},
+}
+
+func TestHOTP(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	for i, v := range rfc6238Vectors {
+		code := hotp(key, totpStep(time.Unix(v.Time, 0)), 8)
+		if code != v.Code {
+			t.Errorf("%d: Expected %s, but was %s", i, v.Code, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	// Base32 of 12345678901234567890:
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	now := time.Unix(1111111109, 0)
+
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "081804" {
+		t.Errorf("Expected 081804, but was %s", code)
+	}
+
+	var tests = []struct {
+		At      time.Time
+		Code    string
+		Success bool
+	}{
+		{At: now, Code: code, Success: true},
+		{At: now.Add(30 * time.Second), Code: code, Success: true},
+		{At: now.Add(-30 * time.Second), Code: code, Success: true},
+		{At: now.Add(90 * time.Second), Code: code, Success: false},
+		{At: now, Code: "000000", Success: false},
+		{At: now, Code: "81804", Success: false},
+	}
+
+	for i, test := range tests {
+		_, err := ValidateTOTP(secret, test.Code, test.At)
+		if (err == nil) != test.Success {
+			t.Errorf("%d: Expected success: %t.  Error: %v", i, test.Success, err)
+		}
+	}
+}
+
+func TestNewTOTPSecret(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := TOTPCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ValidateTOTP(secret, code, time.Now()); err != nil {
+		t.Errorf("Expected generated code to validate: %s", err)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hashes [][]byte
+	for _, c := range codes {
+		h, err := HashRecoveryCode(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, h)
+	}
+
+	if i := MatchRecoveryCode(context.Background(), hashes, codes[1]); i != 1 {
+		t.Errorf("Expected match at 1, but was %d", i)
+	}
+
+	// Case and dashes are ignored:
+	if i := MatchRecoveryCode(context.Background(), hashes, "  "+strings.ToUpper(codes[2][0:4]+codes[2][5:])+" "); i != 2 {
+		t.Errorf("Expected match at 2, but was %d", i)
+	}
+
+	if i := MatchRecoveryCode(context.Background(), hashes, "aaaa-bbbb-cccc-dddd"); i != -1 {
+		t.Errorf("Expected no match, but was %d", i)
+	}
+}
@@ -26,16 +26,43 @@ func (d *DataStore) AddValue(name string, value interface{}) {
 }
 
 // ContextAddValue Convenience function to add value to a store contained in context
-func ContextAddValue(ctx context.Context, store string, name string, value interface{}) error {
+func ContextAddValue(ctx context.Context, store interface{}, name string, value interface{}) error {
 	d, ok := ctx.Value(store).(DataStore)
 	if !ok {
-		return fmt.Errorf("Store '%s' not found in context", store)
+		return fmt.Errorf("Store '%v' not found in context", store)
 	}
 
 	d.AddValue(name, value)
 	return nil
 }
 
+// LoadOrStore Returns the existing value for name if present.  Otherwise, it
+// stores and returns the given value.  loaded is true if the value was
+// already present
+func (d *DataStore) LoadOrStore(name string, value interface{}) (actual interface{}, loaded bool) {
+	d.s.Lock()
+	defer d.s.Unlock()
+
+	if v, ok := d.data[name]; ok {
+		return v, true
+	}
+
+	d.data[name] = value
+	return value, false
+}
+
+// ContextLoadOrStore Convenience function to call LoadOrStore on a store
+// contained in context
+func ContextLoadOrStore(ctx context.Context, store interface{}, name string, value interface{}) (interface{}, bool, error) {
+	d, ok := ctx.Value(store).(DataStore)
+	if !ok {
+		return nil, false, fmt.Errorf("Store '%v' not found in context", store)
+	}
+
+	v, loaded := d.LoadOrStore(name, value)
+	return v, loaded, nil
+}
+
 // ReadValue Reads value from the store
 func (d *DataStore) ReadValue(name string) interface{} {
 	var v interface{}
@@ -47,10 +74,10 @@ func (d *DataStore) ReadValue(name string) interface{} {
 }
 
 // ContextReadValue Convenience function to retrieve value stored in a store stored in context
-func ContextReadValue(ctx context.Context, store string, name string) (interface{}, error) {
+func ContextReadValue(ctx context.Context, store interface{}, name string) (interface{}, error) {
 	d, ok := ctx.Value(store).(DataStore)
 	if !ok {
-		return nil, fmt.Errorf("Store '%s' not found in context", store)
+		return nil, fmt.Errorf("Store '%v' not found in context", store)
 	}
 
 	return d.ReadValue(name), nil
@@ -0,0 +1,70 @@
+package validate
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// breachPrefixLength Number of hex characters of the hash used to name each
+// file in a breach list
+const breachPrefixLength = 5
+
+// BreachList Passwords known from data breaches, stored locally so that
+// passwords never leave the server.  Passwords are stored as upper case hex
+// SHA-1 hashes, split into files named by the first five characters of the
+// hash, e.g., 5BAA6.  Each line of a file holds the remaining 35 characters,
+// optionally followed by :count.  This is the format served by the Pwned
+// Passwords range API, so its responses can be saved as is
+type BreachList struct {
+	Dir string
+}
+
+// NewBreachList Returns the breach list in dir, checking that it exists
+func NewBreachList(dir string) (*BreachList, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("Breach list '%s' is not a directory", dir)
+	}
+
+	return &BreachList{Dir: dir}, nil
+}
+
+// Contains Returns true if the password is in the list
+func (b BreachList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:breachPrefixLength], hash[breachPrefixLength:]
+
+	f, err := os.Open(filepath.Join(b.Dir, prefix))
+	if os.IsNotExist(err) {
+		// No breached passwords share this prefix:
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			line = line[:i]
+		}
+
+		if strings.EqualFold(line, suffix) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
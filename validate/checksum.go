@@ -0,0 +1,318 @@
+package validate
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ibanLengths IBAN lengths by country, from the SWIFT IBAN registry
+var ibanLengths = map[string]int{
+	"AD": 24, "AE": 23, "AL": 28, "AT": 20, "AZ": 28, "BA": 20, "BE": 16,
+	"BG": 22, "BH": 22, "BR": 29, "CH": 21, "CR": 22, "CY": 28, "CZ": 24,
+	"DE": 22, "DK": 18, "DO": 28, "EE": 20, "ES": 24, "FI": 18, "FO": 18,
+	"FR": 27, "GB": 22, "GE": 22, "GI": 23, "GL": 18, "GR": 27, "GT": 28,
+	"HR": 21, "HU": 28, "IE": 22, "IL": 23, "IS": 26, "IT": 27, "JO": 30,
+	"KW": 30, "KZ": 20, "LB": 28, "LI": 21, "LT": 20, "LU": 20, "LV": 21,
+	"MC": 27, "MD": 24, "ME": 22, "MK": 19, "MR": 27, "MT": 31, "MU": 30,
+	"NL": 18, "NO": 15, "PK": 24, "PL": 28, "PS": 29, "PT": 25, "QA": 29,
+	"RO": 24, "RS": 22, "SA": 24, "SE": 24, "SI": 19, "SK": 24, "SM": 27,
+	"TN": 24, "TR": 26, "UA": 29, "VG": 24, "XK": 20,
+}
+
+var ibanRx = regexp.MustCompile(`^[A-Z]{2}\d{2}[A-Z0-9]+$`)
+
+// vatFormats Formats of VAT numbers after the country prefix, which is EL
+// for Greece, and XI for Northern Ireland
+var vatFormats = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^U\d{8}$`),
+	"BE": regexp.MustCompile(`^[01]\d{9}$`),
+	"BG": regexp.MustCompile(`^\d{9,10}$`),
+	"CY": regexp.MustCompile(`^\d{8}[A-Z]$`),
+	"CZ": regexp.MustCompile(`^\d{8,10}$`),
+	"DE": regexp.MustCompile(`^\d{9}$`),
+	"DK": regexp.MustCompile(`^\d{8}$`),
+	"EE": regexp.MustCompile(`^\d{9}$`),
+	"EL": regexp.MustCompile(`^\d{9}$`),
+	"ES": regexp.MustCompile(`^[A-Z0-9]\d{7}[A-Z0-9]$`),
+	"FI": regexp.MustCompile(`^\d{8}$`),
+	"FR": regexp.MustCompile(`^[0-9A-HJ-NP-Z]{2}\d{9}$`),
+	"GB": regexp.MustCompile(`^(\d{9}|\d{12}|GD[0-4]\d{2}|HA[5-9]\d{2})$`),
+	"HR": regexp.MustCompile(`^\d{11}$`),
+	"HU": regexp.MustCompile(`^\d{8}$`),
+	"IE": regexp.MustCompile(`^(\d{7}[A-W][A-IW]?|\d[A-Z+*]\d{5}[A-W])$`),
+	"IT": regexp.MustCompile(`^\d{11}$`),
+	"LT": regexp.MustCompile(`^(\d{9}|\d{12})$`),
+	"LU": regexp.MustCompile(`^\d{8}$`),
+	"LV": regexp.MustCompile(`^\d{11}$`),
+	"MT": regexp.MustCompile(`^\d{8}$`),
+	"NL": regexp.MustCompile(`^\d{9}B\d{2}$`),
+	"PL": regexp.MustCompile(`^\d{10}$`),
+	"PT": regexp.MustCompile(`^\d{9}$`),
+	"RO": regexp.MustCompile(`^[1-9]\d{1,9}$`),
+	"SE": regexp.MustCompile(`^\d{10}01$`),
+	"SI": regexp.MustCompile(`^[1-9]\d{7}$`),
+	"SK": regexp.MustCompile(`^\d{10}$`),
+	"XI": regexp.MustCompile(`^(\d{9}|\d{12}|GD[0-4]\d{2}|HA[5-9]\d{2})$`),
+}
+
+// vatChecksums Check digit algorithms for VAT numbers, where known.  Other
+// countries' numbers are only checked against their format
+var vatChecksums = map[string]func(string) bool{
+	"AT": vatAT,
+	"BE": func(n string) bool { return 97-atoi(n[:8])%97 == atoi(n[8:]) },
+	"DE": func(n string) bool { return mod11x10(n[:8]) == digit(n, 8) },
+	"DK": func(n string) bool { return weightedSum(n, 2, 7, 6, 5, 4, 3, 2, 1)%11 == 0 },
+	"FI": vatFI,
+	"FR": vatFR,
+	"GB": vatGB,
+	"HR": func(n string) bool { return mod11x10(n[:10]) == digit(n, 10) },
+	"IT": luhn,
+	"LU": func(n string) bool { return atoi(n[:6])%89 == atoi(n[6:]) },
+	"NL": vatNL,
+	"PL": func(n string) bool { return weightedSum(n, 6, 5, 7, 2, 3, 4, 5, 6, 7)%11 == digit(n, 9) },
+	"PT": func(n string) bool { return mod11Check(weightedSum(n, 9, 8, 7, 6, 5, 4, 3, 2)) == digit(n, 8) },
+	"SE": func(n string) bool { return luhn(n[:10]) },
+	"SI": vatSI,
+	"SK": func(n string) bool { return atoi(n)%11 == 0 },
+	"XI": vatGB,
+}
+
+// compact Upper cases v, removing spaces and other separators
+func compact(v string) string {
+	return strings.ToUpper(phoneFormattingRx.ReplaceAllString(v, ""))
+}
+
+// ValidIBAN Returns true if v is an IBAN with a valid length for its
+// country and a valid check digit.  Spaces are ignored
+func ValidIBAN(v string) bool {
+	v = compact(v)
+	if !ibanRx.MatchString(v) {
+		return false
+	}
+
+	if n, ok := ibanLengths[v[:2]]; !ok || len(v) != n {
+		return false
+	}
+
+	return mod97(v[4:]+v[:4]) == 1
+}
+
+// IBAN Checks that v is a valid IBAN
+func IBAN(ctx context.Context, field string, v string) bool {
+	if !ValidIBAN(v) {
+		AddCodedError(ctx, field, CodeIBAN, nil)
+		return false
+	}
+
+	return true
+}
+
+// ValidABN Returns true if v is an Australian Business Number with a valid
+// check digit.  Spaces are ignored
+func ValidABN(v string) bool {
+	v = compact(v)
+	if len(v) != 11 || !digitsRx.MatchString(v) || v[0] == '0' {
+		return false
+	}
+
+	// Subtract one from the first digit, then the weighted sum must be
+	// divisible by 89:
+	sum := (digit(v, 0) - 1) * 10
+	sum += weightedSum(v[1:], 1, 3, 5, 7, 9, 11, 13, 15, 17, 19)
+
+	return sum%89 == 0
+}
+
+// ABN Checks that v is a valid Australian Business Number
+func ABN(ctx context.Context, field string, v string) bool {
+	if !ValidABN(v) {
+		AddCodedError(ctx, field, CodeABN, nil)
+		return false
+	}
+
+	return true
+}
+
+// ValidVAT Returns true if v is a VAT number for an EU country or the UK,
+// with its country prefix, e.g., DE136695976.  Check digits are verified for
+// AT, BE, DE, DK, FI, FR, GB, HR, IT, LU, NL, PL, PT, SE, SI and SK, and
+// other countries' numbers are checked against their format.  Spaces, dots
+// and dashes are ignored
+func ValidVAT(v string) bool {
+	v = compact(v)
+	if len(v) < 4 {
+		return false
+	}
+
+	country, n := v[:2], v[2:]
+	if country == "GR" {
+		country = "EL"
+	}
+
+	rx, ok := vatFormats[country]
+	if !ok || !rx.MatchString(n) {
+		return false
+	}
+
+	if check, ok := vatChecksums[country]; ok {
+		return check(n)
+	}
+
+	return true
+}
+
+// VAT Checks that v is a valid VAT number, with its country prefix
+func VAT(ctx context.Context, field string, v string) bool {
+	if !ValidVAT(v) {
+		AddCodedError(ctx, field, CodeVAT, nil)
+		return false
+	}
+
+	return true
+}
+
+func vatAT(n string) bool {
+	sum := 0
+	for i := 1; i < 8; i++ {
+		d := digit(n, i)
+		if i%2 == 0 {
+			d = d*2/10 + d*2%10
+		}
+		sum += d
+	}
+
+	return (10-(sum+4)%10)%10 == digit(n, 8)
+}
+
+// vatFI Numbers with a remainder of 1 are never issued
+func vatFI(n string) bool {
+	sum := weightedSum(n, 7, 9, 10, 5, 8, 4, 2)
+	if sum%11 == 1 {
+		return false
+	}
+
+	return mod11Check(sum) == digit(n, 7)
+}
+
+// vatFR Checks the key against the SIREN number, when the key is numeric
+func vatFR(n string) bool {
+	if !digitsRx.MatchString(n[:2]) {
+		return true
+	}
+
+	return (12+3*(atoi(n[2:])%97))%97 == atoi(n[:2])
+}
+
+// vatGB Checks the first nine digits, using either the original or newer
+// check digit scheme.  Government department and health authority numbers
+// have no check digits
+func vatGB(n string) bool {
+	if strings.HasPrefix(n, "GD") || strings.HasPrefix(n, "HA") {
+		return true
+	}
+
+	sum := weightedSum(n, 8, 7, 6, 5, 4, 3, 2) + atoi(n[7:9])
+
+	return sum%97 == 0 || (sum+55)%97 == 0
+}
+
+// vatNL Checks the check digit of older numbers, or the mod 97 check of
+// numbers issued to sole traders since 2020
+func vatNL(n string) bool {
+	if weightedSum(n, 9, 8, 7, 6, 5, 4, 3, 2)%11 == digit(n, 8) {
+		return true
+	}
+
+	return mod97("NL"+n) == 1
+}
+
+func vatSI(n string) bool {
+	r := 11 - weightedSum(n, 8, 7, 6, 5, 4, 3, 2)%11
+	if r == 11 {
+		return false
+	}
+
+	return r%10 == digit(n, 7)
+}
+
+// mod97 Returns the remainder of v divided by 97, where letters count as 10
+// to 35, as in ISO 7064
+func mod97(v string) int {
+	r := 0
+	for _, c := range v {
+		switch {
+		case c >= '0' && c <= '9':
+			r = (r*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			r = (r*100 + int(c-'A') + 10) % 97
+		default:
+			return -1
+		}
+	}
+
+	return r
+}
+
+// mod11x10 Returns the ISO 7064 MOD 11,10 check digit for the digits
+func mod11x10(v string) int {
+	p := 10
+	for i := range v {
+		s := (digit(v, i) + p) % 10
+		if s == 0 {
+			s = 10
+		}
+		p = s * 2 % 11
+	}
+
+	return (11 - p) % 10
+}
+
+// mod11Check Returns 11 less the sum modulo 11, or 0 if that would be more
+// than 9
+func mod11Check(sum int) int {
+	r := 11 - sum%11
+	if r > 9 {
+		return 0
+	}
+
+	return r
+}
+
+// luhn Returns true if the digits pass the Luhn check
+func luhn(v string) bool {
+	sum := 0
+	for i := range v {
+		d := digit(v, len(v)-1-i)
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+
+	return sum%10 == 0
+}
+
+// weightedSum Returns the sum of the leading digits of v multiplied by the
+// weights
+func weightedSum(v string, weights ...int) int {
+	sum := 0
+	for i, w := range weights {
+		sum += digit(v, i) * w
+	}
+
+	return sum
+}
+
+func digit(v string, i int) int {
+	return int(v[i] - '0')
+}
+
+func atoi(v string) int {
+	n, _ := strconv.Atoi(v)
+	return n
+}
@@ -0,0 +1,68 @@
+package validate
+
+import "testing"
+
+func TestChecksums(t *testing.T) {
+	var tests = []struct {
+		Name   string
+		Valid  func(string) bool
+		Value  string
+		Accept bool
+	}{
+		{"IBAN", ValidIBAN, "GB82 WEST 1234 5698 7654 32", true},
+		{"IBAN", ValidIBAN, "DE89370400440532013000", true},
+		{"IBAN", ValidIBAN, "nl91abna0417164300", true},
+		{"IBAN", ValidIBAN, "FR14 2004 1010 0505 0001 3M02 606", true},
+		{"IBAN", ValidIBAN, "GB82WEST12345698765433", false},
+		{"IBAN", ValidIBAN, "GB82WEST1234569876543", false},
+		{"IBAN", ValidIBAN, "AU82WEST12345698765432", false},
+		{"ABN", ValidABN, "51 824 753 556", true},
+		{"ABN", ValidABN, "53004085616", true},
+		{"ABN", ValidABN, "51824753557", false},
+		{"ABN", ValidABN, "5182475355", false},
+		{"VAT", ValidVAT, "ATU13585627", true},
+		{"VAT", ValidVAT, "ATU13585626", false},
+		{"VAT", ValidVAT, "BE0428759497", true},
+		{"VAT", ValidVAT, "BE0428759498", false},
+		{"VAT", ValidVAT, "DE136695976", true},
+		{"VAT", ValidVAT, "DE136695978", false},
+		{"VAT", ValidVAT, "DK13585628", true},
+		{"VAT", ValidVAT, "DK13585627", false},
+		{"VAT", ValidVAT, "FI20774740", true},
+		{"VAT", ValidVAT, "FI20774741", false},
+		{"VAT", ValidVAT, "FR 40 303 265 045", true},
+		{"VAT", ValidVAT, "FR41303265045", false},
+		{"VAT", ValidVAT, "GB 980 7806 84", true},
+		{"VAT", ValidVAT, "GB802311781", false},
+		{"VAT", ValidVAT, "GBGD001", true},
+		{"VAT", ValidVAT, "HR33392005961", true},
+		{"VAT", ValidVAT, "HR33392005962", false},
+		{"VAT", ValidVAT, "IT00743110157", true},
+		{"VAT", ValidVAT, "IT00743110158", false},
+		{"VAT", ValidVAT, "LU15027442", true},
+		{"VAT", ValidVAT, "LU15027443", false},
+		{"VAT", ValidVAT, "NL004495445B01", true},
+		{"VAT", ValidVAT, "NL004495446B01", false},
+		{"VAT", ValidVAT, "PL8567346215", true},
+		{"VAT", ValidVAT, "PL8567346216", false},
+		{"VAT", ValidVAT, "PT501964843", true},
+		{"VAT", ValidVAT, "PT501964842", false},
+		{"VAT", ValidVAT, "SE123456789701", true},
+		{"VAT", ValidVAT, "SE123456789801", false},
+		{"VAT", ValidVAT, "SI50223054", true},
+		{"VAT", ValidVAT, "SI50223055", false},
+		{"VAT", ValidVAT, "SK2022749619", true},
+		{"VAT", ValidVAT, "SK2022749618", false},
+		{"VAT", ValidVAT, "EL094259216", true},
+		{"VAT", ValidVAT, "ESB58378431", true},
+		{"VAT", ValidVAT, "ES B5837843", false},
+		{"VAT", ValidVAT, "US123456789", false},
+		{"VAT", ValidVAT, "DE", false},
+	}
+
+	for _, test := range tests {
+		if res := test.Valid(test.Value); res != test.Accept {
+			t.Errorf("%s: Expected '%s' accepted %t, but was %t", test.Name, test.Value, test.Accept, res)
+		}
+	}
+}
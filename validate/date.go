@@ -0,0 +1,295 @@
+package validate
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/episub/pqt"
+	"github.com/episub/spawn/vars"
+)
+
+// DefaultTimezone Timezone used for today's date when the request doesn't
+// set one
+var DefaultTimezone = time.Local
+
+// now Returns the current time.  Replaced in tests
+var now = time.Now
+
+var timezones sync.Map
+
+// LoadTimezone Returns the IANA timezone with the name, e.g.,
+// Australia/Sydney, caching it for later calls
+func LoadTimezone(name string) (*time.Location, error) {
+	if loc, ok := timezones.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+
+	timezones.Store(name, loc)
+	return loc, nil
+}
+
+// WithTimezone Returns a copy of ctx with the user's timezone, used to find
+// their today's date
+func WithTimezone(ctx context.Context, loc *time.Location) context.Context {
+	return context.WithValue(ctx, vars.TimezoneKey, loc)
+}
+
+// TimezoneFromContext Returns the user's timezone, or DefaultTimezone if
+// none is set
+func TimezoneFromContext(ctx context.Context) *time.Location {
+	if loc, ok := ctx.Value(vars.TimezoneKey).(*time.Location); ok && loc != nil {
+		return loc
+	}
+
+	return DefaultTimezone
+}
+
+// Today Returns today's date in the user's timezone
+func Today(ctx context.Context) civil.Date {
+	return civil.DateOf(now().In(TimezoneFromContext(ctx)))
+}
+
+// Age Returns the age in whole years on the date of someone born on dob.
+// Those born on 29 February turn a year older on 1 March in other years
+func Age(dob civil.Date, on civil.Date) int {
+	age := on.Year - dob.Year
+	if on.Month < dob.Month || on.Month == dob.Month && on.Day < dob.Day {
+		age--
+	}
+
+	return age
+}
+
+// AgeAtLeast Checks that someone born on dob is at least years old today
+func AgeAtLeast(ctx context.Context, field string, dob civil.Date, years int) bool {
+	if !dob.IsValid() {
+		AddCodedError(ctx, field, CodeDateInvalid, nil)
+		return false
+	}
+
+	if Age(dob, Today(ctx)) < years {
+		AddCodedError(ctx, field, CodeAgeMin, Params{"age": years})
+		return false
+	}
+
+	return true
+}
+
+// AgeAtMost Checks that someone born on dob is no more than years old
+// today, and was born no later than today
+func AgeAtMost(ctx context.Context, field string, dob civil.Date, years int) bool {
+	if !dob.IsValid() {
+		AddCodedError(ctx, field, CodeDateInvalid, nil)
+		return false
+	}
+
+	today := Today(ctx)
+	if !NotAfter(ctx, field, dob, today) {
+		return false
+	}
+
+	if Age(dob, today) > years {
+		AddCodedError(ctx, field, CodeAgeMax, Params{"age": years})
+		return false
+	}
+
+	return true
+}
+
+// DOB Checks that a date of birth is at least 18 years ago
+//
+// Deprecated: Use AgeAtLeast
+func DOB(ctx context.Context, field string, v civil.Date) bool {
+	return AgeAtLeast(ctx, field, v, 18)
+}
+
+// After Checks that a date value is after given date value to be compared with
+func After(ctx context.Context, field string, v civil.Date, dateToCompareWith civil.Date) bool {
+	if !v.After(dateToCompareWith) {
+		AddCodedError(ctx, field, CodeDateAfter, Params{"date": dateToCompareWith.String()})
+		return false
+	}
+
+	return true
+}
+
+// Before Checks that a date is before the other date
+func Before(ctx context.Context, field string, v civil.Date, other civil.Date) bool {
+	if !v.Before(other) {
+		AddCodedError(ctx, field, CodeDateBefore, Params{"date": other.String()})
+		return false
+	}
+
+	return true
+}
+
+// NotBefore Checks that a date is on or after the other date
+func NotBefore(ctx context.Context, field string, v civil.Date, other civil.Date) bool {
+	if v.Before(other) {
+		AddCodedError(ctx, field, CodeDateNotBefore, Params{"date": other.String()})
+		return false
+	}
+
+	return true
+}
+
+// NotAfter Checks that a date is on or before the other date
+func NotAfter(ctx context.Context, field string, v civil.Date, other civil.Date) bool {
+	if v.After(other) {
+		AddCodedError(ctx, field, CodeDateNotAfter, Params{"date": other.String()})
+		return false
+	}
+
+	return true
+}
+
+// Between Checks that a date is between min and max inclusive
+func Between(ctx context.Context, field string, v civil.Date, min civil.Date, max civil.Date) bool {
+	if v.Before(min) || v.After(max) {
+		AddCodedError(ctx, field, CodeDateBetween, Params{"min": min.String(), "max": max.String()})
+		return false
+	}
+
+	return true
+}
+
+// AfterNow Checks that a date is today or later, in the user's timezone
+func AfterNow(ctx context.Context, field string, v civil.Date) bool {
+	return NotBefore(ctx, field, v, Today(ctx))
+}
+
+// AfterPQT Checks that a date is after the other date
+func AfterPQT(ctx context.Context, field string, v pqt.Date, other civil.Date) bool {
+	return After(ctx, field, v.Date, other)
+}
+
+// BeforePQT Checks that a date is before the other date
+func BeforePQT(ctx context.Context, field string, v pqt.Date, other civil.Date) bool {
+	return Before(ctx, field, v.Date, other)
+}
+
+// BetweenPQT Checks that a date is between min and max inclusive
+func BetweenPQT(ctx context.Context, field string, v pqt.Date, min civil.Date, max civil.Date) bool {
+	return Between(ctx, field, v.Date, min, max)
+}
+
+// AfterNullDate Checks that a date is after the other date.  Null dates are
+// accepted, so use with a required check if needed
+func AfterNullDate(ctx context.Context, field string, v pqt.NullDate, other civil.Date) bool {
+	return !v.Valid || After(ctx, field, v.Date, other)
+}
+
+// BeforeNullDate Checks that a date is before the other date.  Null dates
+// are accepted
+func BeforeNullDate(ctx context.Context, field string, v pqt.NullDate, other civil.Date) bool {
+	return !v.Valid || Before(ctx, field, v.Date, other)
+}
+
+// BetweenNullDate Checks that a date is between min and max inclusive.  Null
+// dates are accepted
+func BetweenNullDate(ctx context.Context, field string, v pqt.NullDate, min civil.Date, max civil.Date) bool {
+	return !v.Valid || Between(ctx, field, v.Date, min, max)
+}
+
+// formatTime Formats t for messages, in the user's timezone
+func formatTime(ctx context.Context, t time.Time) string {
+	return t.In(TimezoneFromContext(ctx)).Format(time.RFC3339)
+}
+
+// TimeAfter Checks that a time is after the other time
+func TimeAfter(ctx context.Context, field string, v time.Time, other time.Time) bool {
+	if !v.After(other) {
+		AddCodedError(ctx, field, CodeDateAfter, Params{"date": formatTime(ctx, other)})
+		return false
+	}
+
+	return true
+}
+
+// TimeBefore Checks that a time is before the other time
+func TimeBefore(ctx context.Context, field string, v time.Time, other time.Time) bool {
+	if !v.Before(other) {
+		AddCodedError(ctx, field, CodeDateBefore, Params{"date": formatTime(ctx, other)})
+		return false
+	}
+
+	return true
+}
+
+// TimeBetween Checks that a time is between min and max inclusive
+func TimeBetween(ctx context.Context, field string, v time.Time, min time.Time, max time.Time) bool {
+	if v.Before(min) || v.After(max) {
+		AddCodedError(ctx, field, CodeDateBetween, Params{"min": formatTime(ctx, min), "max": formatTime(ctx, max)})
+		return false
+	}
+
+	return true
+}
+
+// IsBusinessDay Returns true if the date is a weekday, and not one of the
+// holidays
+func IsBusinessDay(d civil.Date, holidays ...civil.Date) bool {
+	switch d.In(time.UTC).Weekday() {
+	case time.Saturday, time.Sunday:
+		return false
+	}
+
+	for _, h := range holidays {
+		if d == h {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AddBusinessDays Returns the date n business days after d, skipping
+// weekends and holidays.  n may be negative
+func AddBusinessDays(d civil.Date, n int, holidays ...civil.Date) civil.Date {
+	step := 1
+	if n < 0 {
+		step, n = -1, -n
+	}
+
+	for n > 0 {
+		d = d.AddDays(step)
+		if IsBusinessDay(d, holidays...) {
+			n--
+		}
+	}
+
+	return d
+}
+
+// BusinessDay Checks that a date is a business day
+func BusinessDay(ctx context.Context, field string, v civil.Date, holidays ...civil.Date) bool {
+	if !IsBusinessDay(v, holidays...) {
+		AddCodedError(ctx, field, CodeBusinessDay, nil)
+		return false
+	}
+
+	return true
+}
+
+// BusinessDaysAhead Checks that a date is a business day at least n
+// business days after today, in the user's timezone, e.g., to allow time to
+// prepare a delivery
+func BusinessDaysAhead(ctx context.Context, field string, v civil.Date, n int, holidays ...civil.Date) bool {
+	if !BusinessDay(ctx, field, v, holidays...) {
+		return false
+	}
+
+	if v.Before(AddBusinessDays(Today(ctx), n, holidays...)) {
+		AddCodedError(ctx, field, CodeBusinessDaysAhead, Params{"days": n})
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,195 @@
+package validate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/episub/pqt"
+)
+
+// setNow Fixes the current time for a test, returning a function restoring
+// it
+func setNow(t time.Time) func() {
+	now = func() time.Time { return t }
+	return func() { now = time.Now }
+}
+
+func date(s string) civil.Date {
+	d, err := civil.ParseDate(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestToday(t *testing.T) {
+	defer setNow(time.Date(2019, 6, 30, 20, 0, 0, 0, time.UTC))()
+
+	sydney, err := LoadTimezone("Australia/Sydney")
+	if err != nil {
+		t.Skip("Timezone data not available")
+	}
+
+	ctx := context.Background()
+	DefaultTimezone = time.UTC
+	defer func() { DefaultTimezone = time.Local }()
+
+	if d := Today(ctx); d != date("2019-06-30") {
+		t.Errorf("Expected today in UTC, but was %s", d)
+	}
+
+	if d := Today(WithTimezone(ctx, sydney)); d != date("2019-07-01") {
+		t.Errorf("Expected today in Sydney, but was %s", d)
+	}
+
+	if _, err := LoadTimezone("Not/AZone"); err == nil {
+		t.Errorf("Expected error for unknown timezone")
+	}
+}
+
+func TestAge(t *testing.T) {
+	var tests = []struct {
+		DOB string
+		On  string
+		Age int
+	}{
+		{"2000-06-15", "2018-06-14", 17},
+		{"2000-06-15", "2018-06-15", 18},
+		{"2000-06-15", "2018-12-01", 18},
+		{"2000-02-29", "2018-02-28", 17},
+		{"2000-02-29", "2018-03-01", 18},
+		{"2000-02-29", "2020-02-29", 20},
+	}
+
+	for _, test := range tests {
+		if age := Age(date(test.DOB), date(test.On)); age != test.Age {
+			t.Errorf("Born %s: Expected age %d on %s, but was %d", test.DOB, test.Age, test.On, age)
+		}
+	}
+}
+
+func TestAgeLimits(t *testing.T) {
+	defer setNow(time.Date(2019, 6, 15, 12, 0, 0, 0, time.Local))()
+
+	var tests = []struct {
+		Name   string
+		Valid  func(context.Context, string, civil.Date, int) bool
+		DOB    civil.Date
+		Years  int
+		Accept bool
+		Code   string
+	}{
+		{"At least", AgeAtLeast, date("2001-06-15"), 18, true, ""},
+		{"At least", AgeAtLeast, date("2001-06-16"), 18, false, CodeAgeMin},
+		{"At least", AgeAtLeast, date("1950-01-01"), 18, true, ""},
+		{"At least invalid", AgeAtLeast, civil.Date{Year: 2001, Month: 2, Day: 30}, 18, false, CodeDateInvalid},
+		{"At most", AgeAtMost, date("1919-06-16"), 99, true, ""},
+		{"At most", AgeAtMost, date("1919-06-15"), 99, false, CodeAgeMax},
+		{"At most future", AgeAtMost, date("2019-06-16"), 99, false, CodeDateNotAfter},
+		{"DOB", func(ctx context.Context, field string, dob civil.Date, years int) bool { return DOB(ctx, field, dob) }, date("2010-01-01"), 0, false, CodeAgeMin},
+	}
+
+	for _, test := range tests {
+		ctx := SetContext(context.Background())
+
+		if res := test.Valid(ctx, "dob", test.DOB, test.Years); res != test.Accept {
+			t.Errorf("%s: Expected %s accepted %t, but was %t", test.Name, test.DOB, test.Accept, res)
+		}
+
+		errs := ListErrors(ctx)
+		if len(test.Code) > 0 && (len(errs) != 1 || errs[0].Code != test.Code) {
+			t.Errorf("%s: Expected %s for %s, but had: %+v", test.Name, test.Code, test.DOB, errs)
+		}
+	}
+}
+
+func TestDateRanges(t *testing.T) {
+	defer setNow(time.Date(2019, 6, 15, 12, 0, 0, 0, time.Local))()
+
+	min, max := date("2019-01-01"), date("2019-12-31")
+	valid := pqt.Date{Date: date("2019-03-01")}
+	early := pqt.NullDate{Date: date("2018-03-01"), Valid: true}
+	t1 := time.Date(2019, 6, 15, 9, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Minute)
+
+	var tests = []struct {
+		Name   string
+		Valid  func(context.Context) bool
+		Accept bool
+	}{
+		{"After", func(ctx context.Context) bool { return After(ctx, "d", max, min) }, true},
+		{"After same", func(ctx context.Context) bool { return After(ctx, "d", min, min) }, false},
+		{"Before", func(ctx context.Context) bool { return Before(ctx, "d", min, max) }, true},
+		{"Before same", func(ctx context.Context) bool { return Before(ctx, "d", max, max) }, false},
+		{"Between", func(ctx context.Context) bool { return Between(ctx, "d", min, min, max) }, true},
+		{"Between", func(ctx context.Context) bool { return Between(ctx, "d", date("2020-01-01"), min, max) }, false},
+		{"AfterNow today", func(ctx context.Context) bool { return AfterNow(ctx, "d", date("2019-06-15")) }, true},
+		{"AfterNow yesterday", func(ctx context.Context) bool { return AfterNow(ctx, "d", date("2019-06-14")) }, false},
+		{"AfterPQT", func(ctx context.Context) bool { return AfterPQT(ctx, "d", valid, min) }, true},
+		{"BeforePQT", func(ctx context.Context) bool { return BeforePQT(ctx, "d", valid, min) }, false},
+		{"BetweenPQT", func(ctx context.Context) bool { return BetweenPQT(ctx, "d", valid, min, max) }, true},
+		{"AfterNullDate", func(ctx context.Context) bool { return AfterNullDate(ctx, "d", early, min) }, false},
+		{"BeforeNullDate", func(ctx context.Context) bool { return BeforeNullDate(ctx, "d", early, min) }, true},
+		{"BetweenNullDate", func(ctx context.Context) bool { return BetweenNullDate(ctx, "d", early, min, max) }, false},
+		{"BetweenNullDate null", func(ctx context.Context) bool { return BetweenNullDate(ctx, "d", pqt.NullDate{}, min, max) }, true},
+		{"TimeAfter", func(ctx context.Context) bool { return TimeAfter(ctx, "t", t2, t1) }, true},
+		{"TimeBefore", func(ctx context.Context) bool { return TimeBefore(ctx, "t", t2, t1) }, false},
+		{"TimeBetween", func(ctx context.Context) bool { return TimeBetween(ctx, "t", t2, t1, t2) }, true},
+		{"TimeBetween", func(ctx context.Context) bool { return TimeBetween(ctx, "t", t1.Add(-time.Second), t1, t2) }, false},
+	}
+
+	for _, test := range tests {
+		ctx := SetContext(context.Background())
+
+		if res := test.Valid(ctx); res != test.Accept {
+			t.Errorf("%s: Expected accepted %t, but was %t", test.Name, test.Accept, res)
+		}
+
+		if HasErrors(ctx) == test.Accept {
+			t.Errorf("%s: Expected errors only when rejected: %s", test.Name, ErrorsString(ctx))
+		}
+	}
+}
+
+func TestBusinessDays(t *testing.T) {
+	// Saturday 15 June 2019:
+	defer setNow(time.Date(2019, 6, 15, 12, 0, 0, 0, time.Local))()
+
+	// Queen's Birthday holiday:
+	holiday := date("2019-06-10")
+
+	var tests = []struct {
+		Date     string
+		Business bool
+	}{
+		{"2019-06-14", true},
+		{"2019-06-15", false},
+		{"2019-06-16", false},
+		{"2019-06-10", false},
+		{"2019-06-11", true},
+	}
+
+	for _, test := range tests {
+		if res := IsBusinessDay(date(test.Date), holiday); res != test.Business {
+			t.Errorf("Expected %s business day %t, but was %t", test.Date, test.Business, res)
+		}
+	}
+
+	if d := AddBusinessDays(date("2019-06-07"), 1, holiday); d != date("2019-06-11") {
+		t.Errorf("Expected next business day 2019-06-11, but was %s", d)
+	}
+
+	if d := AddBusinessDays(date("2019-06-11"), -2, holiday); d != date("2019-06-06") {
+		t.Errorf("Expected 2019-06-06, but was %s", d)
+	}
+
+	ctx := SetContext(context.Background())
+	if BusinessDaysAhead(ctx, "delivery", date("2019-06-18"), 3) {
+		t.Errorf("Expected Tuesday rejected as less than 3 business days ahead")
+	}
+	if !BusinessDaysAhead(ctx, "delivery", date("2019-06-19"), 3) {
+		t.Errorf("Expected Wednesday accepted as 3 business days ahead: %s", ErrorsString(ctx))
+	}
+}
@@ -7,6 +7,8 @@ import (
 
 	"github.com/99designs/gqlgen/graphql"
 	"github.com/episub/pqt"
+	"github.com/episub/spawn/vars"
+	"github.com/sirupsen/logrus"
 	"github.com/vektah/gqlparser/gqlerror"
 )
 
@@ -14,70 +16,153 @@ import (
 type Error struct {
 	Field   string
 	Message string
+	// Code Stable identifier for the kind of error, e.g., LENGTH_RANGE
+	Code string
+	// Params Values used in the message, e.g., {"min": 3, "max": 64}
+	Params Params
 }
 
-const validationValue = "validationErrors"
+const validationValue = vars.ValidationErrors
 
-// AddError Adds a validation error to the context, including adding a graphql
+// AddError Adds a validation error to the context with a message of the
+// caller's own, including adding a graphql error.  The error has the code
+// CUSTOM.  Use AddCodedError for messages from the catalogue
 func AddError(ctx context.Context, field string, message string) {
-	ve := GetErrorsFromContext(ctx)
-	(*ve) = append(*ve, Error{Field: field, Message: message})
+	addError(ctx, Error{Field: field, Message: message, Code: CodeCustom})
+}
+
+// AddCodedError Adds a validation error to the context with the code's
+// message in the request's locale
+func AddCodedError(ctx context.Context, field string, code string, params Params) {
+	addError(ctx, Error{Field: field, Message: Message(ctx, code, params), Code: code, Params: params})
+}
 
-	// Add this as a graphQL error as well:
+// addError Adds a validation error to the context, including adding a
+// graphql error with the field, code and params as extensions.  Without
+// SetContext, the error is logged and only the graphql error is added
+func addError(ctx context.Context, e Error) {
+	ve, ok := ErrorsFromContext(ctx)
+	if ok {
+		ve.Add(e)
+	} else {
+		logrus.WithFields(logrus.Fields{"field": e.Field, "code": e.Code}).Error("Validation error added without a collector; use validate.SetContext")
+	}
+
+	// Add this as a graphQL error as well, unless in an isolated scope:
 	rctx := graphql.GetResolverContext(ctx)
-	if rctx != nil {
+	if rctx != nil && ve.reporting() {
 		graphql.AddError(ctx, &gqlerror.Error{
-			Message: message,
-			Extensions: map[string]interface{}{
-				"field": field,
-			},
+			Message:    e.Message,
+			Extensions: e.Extensions(),
 		})
 	}
 }
 
+// Extensions Returns the field, code and params for a gqlerror's
+// extensions
+func (e Error) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{
+		"field": e.Field,
+		"code":  e.Code,
+	}
+
+	if len(e.Params) > 0 {
+		ext["params"] = e.Params
+	}
+
+	return ext
+}
+
 // DateError Checks a date value and its error, returning nil as the error and adding as a validation error if appropriate
 func DateError(ctx context.Context, field string, d pqt.Date, err error) (pqt.Date, error) {
 	switch {
 	case (strings.Contains(err.Error(), "parsing time") && strings.Contains(err.Error(), "cannot parse")):
-		AddError(ctx, field, "Invalid value for date")
+		AddCodedError(ctx, field, CodeDateInvalid, nil)
 		return d, nil
 	default:
 		return d, err
 	}
 }
 
-// SetContext Adds an array pointer to the context which we use for adding validation errors to
+// SetContext Adds a collector to the context, which validation errors are
+// added to
 func SetContext(ctx context.Context) context.Context {
-	ve := []Error{}
-	return context.WithValue(ctx, validationValue, &ve)
+	return context.WithValue(ctx, validationValue, NewErrors())
 }
 
-// GetErrorsFromContext Returns any validation errors stored in context
+// Scope Returns a copy of ctx with a new scope for validation errors, nested
+// in the current one.  Errors added in the scope are also seen by the
+// scopes it's nested in, but HasErrors and GetErrorsFromContext with the
+// returned context only see errors added in the scope or those nested in
+// it.  E.g., a nested create can check only its own errors.  If ctx has no collector, the scope
+// is a new collector
+func Scope(ctx context.Context) context.Context {
+	parent, _ := ErrorsFromContext(ctx)
+
+	return context.WithValue(ctx, validationValue, parent.scope(false))
+}
+
+// ErrorsFromContext Returns the collector for the context's current scope,
+// and false if SetContext wasn't called
+func ErrorsFromContext(ctx context.Context) (*Errors, bool) {
+	ve, ok := ctx.Value(validationValue).(*Errors)
+	return ve, ok
+}
+
+// ListErrors Returns the validation errors added in the context's current
+// scope, in the order they were added.  Returns none if SetContext wasn't
+// called
+func ListErrors(ctx context.Context) []Error {
+	ve, _ := ErrorsFromContext(ctx)
+	return ve.List()
+}
+
+// GetErrorsFromContext Returns a copy of the validation errors added in the
+// context's current scope.  Errors appended to the copy aren't added to the
+// context; use AddError instead.  Panics if SetContext wasn't called
+//
+// Deprecated: Use ListErrors, which returns none rather than panicking
+// without a collector
 func GetErrorsFromContext(ctx context.Context) *[]Error {
-	ve, ok := ctx.Value(validationValue).(*[]Error)
+	ve, ok := ErrorsFromContext(ctx)
 	if !ok {
 		panic("No validation errors found in context.  Use SetContext function first to create value in context")
 	}
-	return ve
+
+	errs := ve.List()
+	return &errs
+}
+
+// ClearErrors Removes the validation errors added in the context's current
+// scope, including from the scopes it's nested in.  Errors already added to
+// the graphql response are not removed
+func ClearErrors(ctx context.Context) {
+	ve, _ := ErrorsFromContext(ctx)
+	ve.Clear()
 }
 
 // ErrorsString Prints a string concatenating all the validation errors.
 func ErrorsString(ctx context.Context) string {
-	ve := GetErrorsFromContext(ctx)
 	var str []string
 
-	for _, e := range *ve {
+	for _, e := range ListErrors(ctx) {
 		str = append(str, fmt.Sprintf("Field '%s': %s", e.Field, e.Message))
 	}
 
 	return strings.Join(str, ". ")
 }
 
-// HasErrors Returns true if there are any validation erros
+// HasErrors Returns true if there are any validation erros.  Without
+// SetContext, errors can't have been collected, and validators that found
+// invalid input will have only logged it.  Callers use HasErrors to decide
+// whether to go ahead with an action, so it logs an error and returns true
+// rather than letting that input through
 func HasErrors(ctx context.Context) bool {
-	ve := GetErrorsFromContext(ctx)
-	if len(*ve) > 0 {
+	ve, ok := ErrorsFromContext(ctx)
+	if !ok {
+		logrus.Error("Validation errors checked without a collector; use validate.SetContext")
 		return true
 	}
-	return false
+
+	return ve.Len() > 0
 }
@@ -0,0 +1,151 @@
+package validate
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// errorSeq Orders errors added to different scopes
+var errorSeq uint64
+
+// Errors Collects validation errors, and is safe for concurrent use, since
+// gqlgen resolves fields concurrently.  A scope's errors are also seen by
+// the scopes it's nested in.  The methods may be called on a nil *Errors,
+// which has no errors
+type Errors struct {
+	mu       sync.Mutex
+	parent   *Errors
+	isolated bool
+	errors   []sequencedError
+	children []*Errors
+}
+
+type sequencedError struct {
+	seq uint64
+	err Error
+}
+
+// NewErrors Returns an empty collector
+func NewErrors() *Errors {
+	return &Errors{}
+}
+
+// scope Returns a new scope nested in e, or a new collector if e is nil
+func (e *Errors) scope(isolated bool) *Errors {
+	s := &Errors{parent: e, isolated: isolated}
+	if e == nil || isolated {
+		return s
+	}
+
+	e.mu.Lock()
+	e.children = append(e.children, s)
+	e.mu.Unlock()
+
+	return s
+}
+
+// Add Adds an error to the scope
+func (e *Errors) Add(err Error) {
+	se := sequencedError{seq: atomic.AddUint64(&errorSeq, 1), err: err}
+
+	e.mu.Lock()
+	e.errors = append(e.errors, se)
+	e.mu.Unlock()
+}
+
+// List Returns the errors added to the scope and those nested in it, in the
+// order they were added
+func (e *Errors) List() []Error {
+	all := e.sequenced()
+	sort.Slice(all, func(i, j int) bool { return all[i].seq < all[j].seq })
+
+	errs := make([]Error, len(all))
+	for i, se := range all {
+		errs[i] = se.err
+	}
+
+	return errs
+}
+
+func (e *Errors) sequenced() []sequencedError {
+	if e == nil {
+		return nil
+	}
+
+	e.mu.Lock()
+	all := append([]sequencedError{}, e.errors...)
+	children := append([]*Errors{}, e.children...)
+	e.mu.Unlock()
+
+	for _, c := range children {
+		all = append(all, c.sequenced()...)
+	}
+
+	return all
+}
+
+// Len Returns the number of errors in the scope and those nested in it
+func (e *Errors) Len() int {
+	if e == nil {
+		return 0
+	}
+
+	e.mu.Lock()
+	n := len(e.errors)
+	children := append([]*Errors{}, e.children...)
+	e.mu.Unlock()
+
+	for _, c := range children {
+		n += c.Len()
+	}
+
+	return n
+}
+
+// Clear Removes the errors in the scope and those nested in it
+func (e *Errors) Clear() {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	e.errors = nil
+	children := append([]*Errors{}, e.children...)
+	e.mu.Unlock()
+
+	for _, c := range children {
+		c.Clear()
+	}
+}
+
+// reporting Returns false if the scope or one it's nested in is isolated,
+// in which case errors aren't added to the graphql response until merged
+func (e *Errors) reporting() bool {
+	for s := e; s != nil; s = s.parent {
+		if s.isolated {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsolatedScope Returns a copy of ctx with a new scope for validation errors
+// that isn't seen by the scopes it's nested in, or added to the graphql
+// response, until merged with MergeErrors.  Use to check something that may
+// not be needed, e.g., one of several alternatives
+func IsolatedScope(ctx context.Context) context.Context {
+	parent, _ := ErrorsFromContext(ctx)
+
+	return context.WithValue(ctx, validationValue, parent.scope(true))
+}
+
+// MergeErrors Adds the errors from another collector, such as an isolated
+// scope, to the context's current scope and the graphql response
+func MergeErrors(ctx context.Context, from *Errors) {
+	for _, e := range from.List() {
+		addError(ctx, e)
+	}
+}
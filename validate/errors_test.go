@@ -0,0 +1,144 @@
+package validate
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentErrors(t *testing.T) {
+	ctx := SetContext(context.Background())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			sctx := Scope(ctx)
+			for j := 0; j < 20; j++ {
+				AddError(sctx, fmt.Sprintf("field%d", i), "Invalid")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := len(ListErrors(ctx)); n != 1000 {
+		t.Errorf("Expected 1000 errors, but had %d", n)
+	}
+}
+
+func TestErrorScopes(t *testing.T) {
+	ctx := SetContext(context.Background())
+	AddError(ctx, "top", "Top")
+
+	client := Scope(ctx)
+	AddError(client, "client.name", "Name")
+
+	address := Scope(client)
+	AddError(address, "client.address.postcode", "Postcode")
+
+	sibling := Scope(ctx)
+	if HasErrors(sibling) {
+		t.Errorf("Expected no errors in new scope")
+	}
+
+	var tests = []struct {
+		Name   string
+		Ctx    context.Context
+		Fields []string
+	}{
+		{"Top", ctx, []string{"top", "client.name", "client.address.postcode"}},
+		{"Client", client, []string{"client.name", "client.address.postcode"}},
+		{"Address", address, []string{"client.address.postcode"}},
+	}
+
+	for _, test := range tests {
+		errs := ListErrors(test.Ctx)
+		if len(errs) != len(test.Fields) {
+			t.Errorf("%s: Expected %d errors, but had: %s", test.Name, len(test.Fields), ErrorsString(test.Ctx))
+			continue
+		}
+
+		for i, e := range errs {
+			if e.Field != test.Fields[i] {
+				t.Errorf("%s: Expected error on '%s', but was '%s'", test.Name, test.Fields[i], e.Field)
+			}
+		}
+	}
+
+	ClearErrors(client)
+	if HasErrors(address) || HasErrors(client) {
+		t.Errorf("Expected client and nested scopes cleared")
+	}
+
+	if errs := ListErrors(ctx); len(errs) != 1 || errs[0].Field != "top" {
+		t.Errorf("Expected only top error to remain, but had: %s", ErrorsString(ctx))
+	}
+}
+
+func TestIsolatedScope(t *testing.T) {
+	ctx := SetContext(context.Background())
+
+	isolated := IsolatedScope(ctx)
+	AddError(Scope(isolated), "name", "Name")
+
+	if HasErrors(ctx) {
+		t.Errorf("Expected isolated errors not seen by parent")
+	}
+
+	ve, _ := ErrorsFromContext(isolated)
+	MergeErrors(ctx, ve)
+
+	if errs := ListErrors(ctx); len(errs) != 1 || errs[0].Field != "name" {
+		t.Errorf("Expected merged error, but had: %s", ErrorsString(ctx))
+	}
+}
+
+func TestErrorsWithoutContext(t *testing.T) {
+	ctx := context.Background()
+
+	if _, ok := ErrorsFromContext(ctx); ok {
+		t.Errorf("Expected no collector")
+	}
+
+	AddError(ctx, "name", "Name")
+	ClearErrors(ctx)
+
+	if len(ListErrors(ctx)) != 0 {
+		t.Errorf("Expected no errors without a collector")
+	}
+
+	if !HasErrors(ctx) {
+		t.Errorf("Expected HasErrors to fail closed without a collector")
+	}
+
+	sctx := Scope(ctx)
+	AddError(sctx, "name", "Name")
+	if !HasErrors(sctx) {
+		t.Errorf("Expected scope without a collector to collect errors")
+	}
+}
+
+func TestGetErrorsFromContext(t *testing.T) {
+	ctx := SetContext(context.Background())
+	AddError(ctx, "name", "Name")
+
+	errs := GetErrorsFromContext(ctx)
+	if len(*errs) != 1 || (*errs)[0].Field != "name" {
+		t.Fatalf("Expected the error for name, but had %v", *errs)
+	}
+
+	*errs = append(*errs, Error{Field: "other"})
+	if n := len(ListErrors(ctx)); n != 1 {
+		t.Errorf("Expected the context's errors unchanged by the copy, but had %d", n)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected panic without a collector")
+		}
+	}()
+	GetErrorsFromContext(context.Background())
+}
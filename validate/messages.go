@@ -0,0 +1,323 @@
+package validate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/episub/spawn/vars"
+)
+
+// Error codes, which are stable so that clients can rely on them instead of
+// the message text.  Each has a message in the catalogue, filled in with the
+// params listed
+const (
+	// CodeCustom Message was provided by the caller
+	CodeCustom  = "CUSTOM"
+	CodeInvalid = "INVALID"
+	// CodePattern Value doesn't match a regular expression
+	CodePattern = "PATTERN"
+	// CodeEmail Params: value
+	CodeEmail = "EMAIL"
+	// CodeLengthExact Params: length
+	CodeLengthExact = "LENGTH_EXACT"
+	// CodeLengthRange Params: min, max
+	CodeLengthRange = "LENGTH_RANGE"
+	// CodeLengthMin Params: min
+	CodeLengthMin = "LENGTH_MIN"
+	// CodeLengthMax Params: max
+	CodeLengthMax = "LENGTH_MAX"
+	// CodeNotEqual Values must differ
+	CodeNotEqual = "NOT_EQUAL"
+	// CodeEqual Values must match
+	CodeEqual                = "EQUAL"
+	CodeUUID                 = "UUID"
+	CodeNumber               = "NUMBER"
+	CodePositive             = "POSITIVE"
+	CodeUsername             = "USERNAME"
+	CodeLettersSpaces        = "LETTERS_SPACES"
+	CodeLettersNumbers       = "LETTERS_NUMBERS"
+	CodeLettersSpacesNumbers = "LETTERS_SPACES_NUMBERS"
+	CodeURL                  = "URL"
+	CodeTrue                 = "TRUE"
+	CodeDateInvalid          = "DATE_INVALID"
+	// CodeDateAfter Params: date
+	CodeDateAfter = "DATE_AFTER"
+	// CodeDateBefore Params: date
+	CodeDateBefore = "DATE_BEFORE"
+	// CodeDateNotBefore Params: date
+	CodeDateNotBefore = "DATE_NOT_BEFORE"
+	// CodeDateNotAfter Params: date
+	CodeDateNotAfter = "DATE_NOT_AFTER"
+	// CodeDateBetween Params: min, max
+	CodeDateBetween = "DATE_BETWEEN"
+	// CodeAgeMin Params: age
+	CodeAgeMin = "AGE_MIN"
+	// CodeAgeMax Params: age
+	CodeAgeMax      = "AGE_MAX"
+	CodeBusinessDay = "BUSINESS_DAY"
+	// CodeBusinessDaysAhead Params: days
+	CodeBusinessDaysAhead = "BUSINESS_DAYS_AHEAD"
+	// CodeNotAllowed Value isn't one of the allowed values
+	CodeNotAllowed = "NOT_ALLOWED"
+	CodeRequired   = "REQUIRED"
+	// CodeMin Params: min
+	CodeMin = "MIN"
+	// CodeMax Params: max
+	CodeMax = "MAX"
+	// CodeRequiredWith Params: other, the field that is set
+	CodeRequiredWith = "REQUIRED_WITH"
+	// CodeLess Params: other, the field compared with
+	CodeLess = "LESS"
+	// CodeLessOrEqual Params: other
+	CodeLessOrEqual = "LESS_OR_EQUAL"
+	// CodeGreater Params: other
+	CodeGreater = "GREATER"
+	// CodeGreaterOrEqual Params: other
+	CodeGreaterOrEqual = "GREATER_OR_EQUAL"
+	// CodeUnique Value is already used, e.g., by another user
+	CodeUnique = "UNIQUE"
+	// CodePhone Params: region
+	CodePhone = "PHONE"
+	// CodePostcode Params: country
+	CodePostcode = "POSTCODE"
+	CodeIBAN     = "IBAN"
+	CodeABN      = "ABN"
+	CodeVAT      = "VAT"
+	// CodePasswordUpperLowerNumber Params: minLength
+	CodePasswordUpperLowerNumber = "PASSWORD_UPPER_LOWER_NUMBER"
+	// CodePasswordWeak Params: score, minScore, tips
+	CodePasswordWeak       = "PASSWORD_WEAK"
+	CodePasswordUserInputs = "PASSWORD_USER_INPUTS"
+	CodePasswordRepetitive = "PASSWORD_REPETITIVE"
+	CodePasswordBreached   = "PASSWORD_BREACHED"
+)
+
+// Tips included in CodePasswordWeak messages
+const (
+	CodePasswordTipUserInputs   = "PASSWORD_TIP_USER_INPUTS"
+	CodePasswordTipSubstitution = "PASSWORD_TIP_SUBSTITUTION"
+	CodePasswordTipCommon       = "PASSWORD_TIP_COMMON"
+	CodePasswordTipKeyboard     = "PASSWORD_TIP_KEYBOARD"
+	CodePasswordTipRepeat       = "PASSWORD_TIP_REPEAT"
+	CodePasswordTipSequence     = "PASSWORD_TIP_SEQUENCE"
+	CodePasswordTipDate         = "PASSWORD_TIP_DATE"
+	CodePasswordTipMoreWords    = "PASSWORD_TIP_MORE_WORDS"
+)
+
+// DefaultLocale Locale used when the request doesn't ask for one in the
+// catalogue, or a message is missing from the requested locale
+var DefaultLocale = "en"
+
+// Params Values used in an error's message, e.g., {"min": 3, "max": 64}
+type Params map[string]interface{}
+
+// MessageCodes A param holding codes of other messages, which are looked up
+// and joined when the message is built
+type MessageCodes []string
+
+var (
+	catalogueMu sync.RWMutex
+	catalogue   = map[string]map[string]string{
+		"en": {
+			CodeInvalid:                  "Invalid value",
+			CodePattern:                  "Invalid value",
+			CodeEmail:                    "Email address '{value}' is invalid",
+			CodeLengthExact:              "Must be exactly {length} characters long",
+			CodeLengthRange:              "Must be between {min} and {max} characters long",
+			CodeLengthMin:                "Must be at least {min} characters long",
+			CodeLengthMax:                "Must be no more than {max} characters long",
+			CodeNotEqual:                 "Values must be different",
+			CodeEqual:                    "Values must match",
+			CodeUUID:                     "Must be a valid ID",
+			CodeNumber:                   "Must be a number",
+			CodePositive:                 "Must be positive",
+			CodeUsername:                 "Usernames can only contain letters, numbers, underscores and hyphens, and must not begin or end with an underscore or hyphen",
+			CodeLettersSpaces:            "Must only contain letters and spaces",
+			CodeLettersNumbers:           "Must only contain letters and numbers",
+			CodeLettersSpacesNumbers:     "Must only contain letters, spaces and numbers",
+			CodeURL:                      "Website URL is invalid",
+			CodeTrue:                     "Must be true",
+			CodeDateInvalid:              "Invalid value for date",
+			CodeDateAfter:                "Date should be after {date}",
+			CodeDateBefore:               "Date should be before {date}",
+			CodeDateNotBefore:            "Date should be on or after {date}",
+			CodeDateNotAfter:             "Date should be on or before {date}",
+			CodeDateBetween:              "Date should be between {min} and {max}",
+			CodeAgeMin:                   "Must be at least {age} years old",
+			CodeAgeMax:                   "Must be no more than {age} years old",
+			CodeBusinessDay:              "Must be a business day",
+			CodeBusinessDaysAhead:        "Must be at least {days} business days from today",
+			CodeNotAllowed:               "Value not allowed",
+			CodeRequired:                 "Required",
+			CodeMin:                      "Must be at least {min}",
+			CodeMax:                      "Must be no more than {max}",
+			CodeRequiredWith:             "Required when {other} is set",
+			CodeLess:                     "Must be less than {other}",
+			CodeLessOrEqual:              "Must not be more than {other}",
+			CodeGreater:                  "Must be greater than {other}",
+			CodeGreaterOrEqual:           "Must not be less than {other}",
+			CodeUnique:                   "Already in use",
+			CodePhone:                    "Must be a valid phone number",
+			CodePostcode:                 "Must be a valid postcode",
+			CodeIBAN:                     "Must be a valid IBAN",
+			CodeABN:                      "Must be a valid ABN",
+			CodeVAT:                      "Must be a valid VAT number, including the country code",
+			CodePasswordUpperLowerNumber: "Password must contain at least one upper case character, one lower, and one number, with a minimum length of {minLength}",
+			CodePasswordWeak:             "Password is too easy to guess.  {tips}",
+			CodePasswordUserInputs:       "Must not contain your name, username or email address",
+			CodePasswordRepetitive:       "Must not be a repeated or sequential pattern like 'aaaaaa' or '123456'",
+			CodePasswordBreached:         "This password has appeared in a data breach, so can't be used.  Please choose another",
+			CodePasswordTipUserInputs:    "Avoid your name, username or email address.",
+			CodePasswordTipSubstitution:  "Swapping letters for similar looking symbols, like '@' for 'a', doesn't make words much harder to guess.",
+			CodePasswordTipCommon:        "Avoid common words, names and passwords.",
+			CodePasswordTipKeyboard:      "Avoid keyboard patterns like 'qwerty'.",
+			CodePasswordTipRepeat:        "Avoid repeated characters like 'aaa'.",
+			CodePasswordTipSequence:      "Avoid sequences like 'abc' or '123'.",
+			CodePasswordTipDate:          "Avoid dates and years.",
+			CodePasswordTipMoreWords:     "Add another word or two; uncommon words are better.",
+		},
+	}
+)
+
+// RegisterMessages Adds messages for the locale, e.g., "fr" or "en-GB",
+// replacing any existing messages with the same codes.  Messages refer to
+// params in braces, e.g., "Doit contenir entre {min} et {max} caractères".
+// Call at start up
+func RegisterMessages(locale string, messages map[string]string) {
+	catalogueMu.Lock()
+	defer catalogueMu.Unlock()
+
+	locale = strings.ToLower(locale)
+	if catalogue[locale] == nil {
+		catalogue[locale] = map[string]string{}
+	}
+
+	for code, msg := range messages {
+		catalogue[locale][code] = msg
+	}
+}
+
+// WithLocale Returns a copy of ctx with the locale used for messages
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, vars.LocaleKey, locale)
+}
+
+// LocaleFromContext Returns the locale used for messages, or DefaultLocale if
+// none is set
+func LocaleFromContext(ctx context.Context) string {
+	if locale, ok := ctx.Value(vars.LocaleKey).(string); ok && len(locale) > 0 {
+		return locale
+	}
+
+	return DefaultLocale
+}
+
+// Message Returns the message for the code in the context's locale, with
+// its params filled in
+func Message(ctx context.Context, code string, params Params) string {
+	return message(LocaleFromContext(ctx), code, params)
+}
+
+// message Returns the message for the code in locale, falling back to the
+// locale's language and then DefaultLocale
+func message(locale string, code string, params Params) string {
+	catalogueMu.RLock()
+	template, ok := lookupMessage(locale, code)
+	catalogueMu.RUnlock()
+
+	if !ok {
+		return code
+	}
+
+	for name, value := range params {
+		var s string
+		switch v := value.(type) {
+		case MessageCodes:
+			parts := make([]string, len(v))
+			for i, c := range v {
+				parts[i] = message(locale, c, nil)
+			}
+			s = strings.Join(parts, "  ")
+		default:
+			s = fmt.Sprint(v)
+		}
+
+		template = strings.Replace(template, "{"+name+"}", s, -1)
+	}
+
+	return template
+}
+
+// lookupMessage Returns the message template for code.  catalogueMu must be
+// held
+func lookupMessage(locale string, code string) (string, bool) {
+	locale = strings.ToLower(locale)
+	candidates := []string{locale}
+	if i := strings.IndexByte(locale, '-'); i > 0 {
+		candidates = append(candidates, locale[:i])
+	}
+	candidates = append(candidates, DefaultLocale)
+
+	for _, l := range candidates {
+		if msg, ok := catalogue[l][code]; ok {
+			return msg, true
+		}
+	}
+
+	return "", false
+}
+
+// MatchLocale Returns the registered locale best matching an Accept-Language
+// header, e.g., "fr-CA,fr;q=0.9,en;q=0.8", or DefaultLocale if none match
+func MatchLocale(acceptLanguage string) string {
+	type tag struct {
+		name string
+		q    float64
+	}
+
+	var tags []tag
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if len(name) == 0 || name == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if v, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		if q > 0 {
+			tags = append(tags, tag{name: name, q: q})
+		}
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	catalogueMu.RLock()
+	defer catalogueMu.RUnlock()
+
+	for _, t := range tags {
+		if _, ok := catalogue[t.name]; ok {
+			return t.name
+		}
+
+		if i := strings.IndexByte(t.name, '-'); i > 0 {
+			if _, ok := catalogue[t.name[:i]]; ok {
+				return t.name[:i]
+			}
+		}
+	}
+
+	return DefaultLocale
+}
@@ -0,0 +1,84 @@
+package validate
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCodedErrors(t *testing.T) {
+	ctx := SetContext(context.Background())
+
+	Length(ctx, "name", "ab", 3, 64)
+	AddError(ctx, "other", "Custom message")
+
+	errs := ListErrors(ctx)
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 errors, but had %d", len(errs))
+	}
+
+	e := errs[0]
+	if e.Code != CodeLengthRange || e.Params["min"] != 3 || e.Params["max"] != 64 {
+		t.Errorf("Unexpected code or params: %+v", e)
+	}
+	if e.Message != "Must be between 3 and 64 characters long" {
+		t.Errorf("Unexpected message: %s", e.Message)
+	}
+
+	ext := e.Extensions()
+	if ext["code"] != CodeLengthRange || ext["field"] != "name" || ext["params"] == nil {
+		t.Errorf("Unexpected extensions: %+v", ext)
+	}
+
+	if errs[1].Code != CodeCustom || errs[1].Message != "Custom message" {
+		t.Errorf("Unexpected custom error: %+v", errs[1])
+	}
+	if _, ok := errs[1].Extensions()["params"]; ok {
+		t.Errorf("Expected no params for custom error")
+	}
+}
+
+func TestMessageLocale(t *testing.T) {
+	RegisterMessages("fr", map[string]string{
+		CodeLengthRange: "Doit contenir entre {min} et {max} caractères",
+	})
+
+	ctx := WithLocale(SetContext(context.Background()), "fr-CA")
+	Length(ctx, "name", "ab", 3, 64)
+	Positive(ctx, "count", -1)
+
+	errs := ListErrors(ctx)
+	if errs[0].Message != "Doit contenir entre 3 et 64 caractères" {
+		t.Errorf("Expected French message, but was: %s", errs[0].Message)
+	}
+
+	// Missing from the catalogue for fr, so falls back to the default:
+	if errs[1].Message != "Must be positive" {
+		t.Errorf("Expected default message, but was: %s", errs[1].Message)
+	}
+}
+
+func TestMatchLocale(t *testing.T) {
+	RegisterMessages("de", map[string]string{CodeInvalid: "Ungültiger Wert"})
+	RegisterMessages("pt-BR", map[string]string{CodeInvalid: "Valor inválido"})
+
+	var tests = []struct {
+		Header string
+		Locale string
+	}{
+		{"", DefaultLocale},
+		{"de", "de"},
+		{"de-AT,en;q=0.5", "de"},
+		{"ja,en;q=0.8,de;q=0.9", "de"},
+		{"pt-BR", "pt-br"},
+		{"pt", DefaultLocale},
+		{"ja, zh;q=0.5", DefaultLocale},
+		{"de;q=0, en", "en"},
+		{"*", DefaultLocale},
+	}
+
+	for _, test := range tests {
+		if locale := MatchLocale(test.Header); locale != test.Locale {
+			t.Errorf("'%s': Expected locale '%s', but was '%s'", test.Header, test.Locale, locale)
+		}
+	}
+}
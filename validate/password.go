@@ -2,13 +2,15 @@ package validate
 
 import (
 	"context"
-	"fmt"
 	"unicode"
 )
 
 // PasswordValidator Provides some base regexps for enforcing password policy
 // https://stackoverflow.com/questions/19605150/regex-for-password-must-contain-at-least-eight-characters-at-least-one-number-a
 type PasswordValidator struct {
+	// Code Error code whose catalogue message is used on failure, with the
+	// param minLength.  When empty, Failure is used
+	Code     string
 	Failure  string
 	Validate func(string, uint) bool
 }
@@ -17,7 +19,8 @@ var (
 	// PasswordUpperLowerNumber Ensures password contains at least one upper,
 	// lower, and number
 	PasswordUpperLowerNumber = PasswordValidator{
-		Failure:  "Password must contain at least one upper case character, one lower, and one number, with a minium length of %d",
+		Code:     CodePasswordUpperLowerNumber,
+		Failure:  "Password must contain at least one upper case character, one lower, and one number, with a minimum length of %d",
 		Validate: passwordUpperLowerNumber,
 	}
 )
@@ -30,28 +33,29 @@ func Password(
 	validator PasswordValidator,
 	field string,
 ) bool {
-	ok := validator.Validate(password, minLength)
-	if !ok {
-		return Fail(ctx, field, fmt.Sprintf(validator.Failure, minLength))
+	f := validator.Policy(minLength)(password, nil)
+	if f != nil {
+		addFailure(ctx, field, *f)
+		return false
 	}
-	return ok
+	return true
 }
 
 func passwordUpperLowerNumber(password string, length uint) bool {
-	number, upper, _ := passwordFingerprint(password)
+	number, upper, lower, _ := passwordFingerprint(password)
 
 	if uint(len(password)) < length {
 		return false
 	}
 
-	if !number || !upper {
+	if !number || !upper || !lower {
 		return false
 	}
 
 	return true
 }
 
-func passwordFingerprint(password string) (number, upper, special bool) {
+func passwordFingerprint(password string) (number, upper, lower, special bool) {
 	letters := 0
 	for _, c := range password {
 		switch {
@@ -60,6 +64,9 @@ func passwordFingerprint(password string) (number, upper, special bool) {
 		case unicode.IsUpper(c):
 			upper = true
 			letters++
+		case unicode.IsLower(c):
+			lower = true
+			letters++
 		case unicode.IsPunct(c) || unicode.IsSymbol(c):
 			special = true
 		case unicode.IsLetter(c) || c == ' ':
@@ -28,6 +28,10 @@ var PasswordUpperLowerNumberTests = []passwordTest{
 		Password: "2iJo",
 		Accept:   true,
 	},
+	{
+		Password: "2IJO",
+		Accept:   false,
+	},
 	{
 		Password: "2i Jo",
 		Accept:   true,
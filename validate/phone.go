@@ -0,0 +1,157 @@
+package validate
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// phoneRegion How phone numbers are written in a region
+type phoneRegion struct {
+	// code Country calling code
+	code string
+	// trunk Prefix dialled before national numbers within the region, and
+	// dropped in international format
+	trunk string
+	// min, max Length of the national significant number, which follows the
+	// calling code in international format
+	min, max int
+	// pattern Optional.  National significant numbers in use
+	pattern *regexp.Regexp
+}
+
+// phoneRegions Regions by ISO 3166 code, covering AU, NZ, the UK and the EU
+var phoneRegions = map[string]phoneRegion{
+	"AU": {code: "61", trunk: "0", min: 6, max: 10, pattern: regexp.MustCompile(`^([23478]\d{8}|1[38]00\d{6}|13\d{4})$`)},
+	"NZ": {code: "64", trunk: "0", min: 8, max: 10, pattern: regexp.MustCompile(`^([3-79]\d{7}|2\d{7,9}|(800|508)\d{6,7})$`)},
+	"GB": {code: "44", trunk: "0", min: 9, max: 10, pattern: regexp.MustCompile(`^([1-3]\d{8,9}|[5789]\d{9}|8\d{8})$`)},
+	"AT": {code: "43", trunk: "0", min: 4, max: 13},
+	"BE": {code: "32", trunk: "0", min: 8, max: 9},
+	"BG": {code: "359", trunk: "0", min: 6, max: 9},
+	"HR": {code: "385", trunk: "0", min: 8, max: 9},
+	"CY": {code: "357", min: 8, max: 8},
+	"CZ": {code: "420", min: 9, max: 9},
+	"DK": {code: "45", min: 8, max: 8},
+	"EE": {code: "372", min: 7, max: 8},
+	"FI": {code: "358", trunk: "0", min: 5, max: 12},
+	"FR": {code: "33", trunk: "0", min: 9, max: 9, pattern: regexp.MustCompile(`^[1-9]\d{8}$`)},
+	"DE": {code: "49", trunk: "0", min: 6, max: 13},
+	"GR": {code: "30", min: 10, max: 10},
+	"HU": {code: "36", trunk: "06", min: 8, max: 9},
+	"IE": {code: "353", trunk: "0", min: 7, max: 9},
+	// Italian numbers keep their leading 0 in international format:
+	"IT": {code: "39", min: 6, max: 11},
+	"LV": {code: "371", min: 8, max: 8},
+	"LT": {code: "370", trunk: "8", min: 8, max: 8},
+	"LU": {code: "352", min: 4, max: 11},
+	"MT": {code: "356", min: 8, max: 8},
+	"NL": {code: "31", trunk: "0", min: 9, max: 9},
+	"PL": {code: "48", min: 9, max: 9},
+	"PT": {code: "351", min: 9, max: 9},
+	"RO": {code: "40", trunk: "0", min: 9, max: 9},
+	"SK": {code: "421", trunk: "0", min: 9, max: 9},
+	"SI": {code: "386", trunk: "0", min: 8, max: 8},
+	"ES": {code: "34", min: 9, max: 9},
+	"SE": {code: "46", trunk: "0", min: 7, max: 13},
+}
+
+// phoneFormattingRx Characters commonly used to format phone numbers
+var phoneFormattingRx = regexp.MustCompile(`[\s\-.()/]`)
+
+var digitsRx = regexp.MustCompile(`^\d+$`)
+
+// normaliseRegion Returns the ISO 3166 code for region, accepting UK for GB
+func normaliseRegion(region string) string {
+	region = strings.ToUpper(strings.TrimSpace(region))
+	if region == "UK" {
+		return "GB"
+	}
+
+	return region
+}
+
+// NormalisePhone Returns the phone number in E.164 format, e.g.,
+// +61412345678, and false if it isn't valid.  Numbers in international
+// format, starting with + or 00 (0011 in AU), are checked against the rules
+// of the region for their calling code, and numbers in national format
+// against the rules of region.  International numbers for regions without
+// rules only need to be a valid length
+func NormalisePhone(v string, region string) (string, bool) {
+	region = normaliseRegion(region)
+	v = phoneFormattingRx.ReplaceAllString(strings.TrimSpace(v), "")
+
+	switch {
+	case strings.HasPrefix(v, "+"):
+		v = v[1:]
+	case region == "AU" && strings.HasPrefix(v, "0011"):
+		v = v[4:]
+	case region != "AU" && strings.HasPrefix(v, "00"):
+		v = v[2:]
+	default:
+		return nationalPhone(v, region)
+	}
+
+	if !digitsRx.MatchString(v) {
+		return "", false
+	}
+
+	// Calling codes are one to three digits, and none is a prefix of another:
+	for n := 3; n > 0; n-- {
+		if len(v) <= n {
+			continue
+		}
+
+		for _, r := range phoneRegions {
+			if r.code == v[:n] {
+				return r.e164(v[n:])
+			}
+		}
+	}
+
+	// E.164 numbers are at most 15 digits:
+	if len(v) < 8 || len(v) > 15 || v[0] == '0' {
+		return "", false
+	}
+
+	return "+" + v, true
+}
+
+// nationalPhone Normalises a number in the national format of region
+func nationalPhone(v string, region string) (string, bool) {
+	r, ok := phoneRegions[region]
+	if !ok || !digitsRx.MatchString(v) {
+		return "", false
+	}
+
+	if len(r.trunk) > 0 {
+		v = strings.TrimPrefix(v, r.trunk)
+	}
+
+	return r.e164(v)
+}
+
+// e164 Returns the national significant number in E.164 format, if valid
+// for the region
+func (r phoneRegion) e164(nsn string) (string, bool) {
+	if len(nsn) < r.min || len(nsn) > r.max {
+		return "", false
+	}
+
+	if r.pattern != nil && !r.pattern.MatchString(nsn) {
+		return "", false
+	}
+
+	return "+" + r.code + nsn, true
+}
+
+// PhoneInRegion Checks that v is a valid phone number for region, e.g., AU,
+// or in international format.  Use NormalisePhone to store it in E.164
+// format
+func PhoneInRegion(ctx context.Context, field string, v string, region string) bool {
+	if _, ok := NormalisePhone(v, region); !ok {
+		AddCodedError(ctx, field, CodePhone, Params{"region": normaliseRegion(region)})
+		return false
+	}
+
+	return true
+}
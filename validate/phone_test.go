@@ -0,0 +1,109 @@
+package validate
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNormalisePhone(t *testing.T) {
+	var tests = []struct {
+		Phone  string
+		Region string
+		E164   string
+	}{
+		{"0412 345 678", "AU", "+61412345678"},
+		{"(02) 9876 5432", "au", "+61298765432"},
+		{"1300 123 456", "AU", "+611300123456"},
+		{"+61 2 9876 5432", "NZ", "+61298765432"},
+		{"0011 44 20 7946 0958", "AU", "+442079460958"},
+		{"021 123 4567", "NZ", "+64211234567"},
+		{"09-123 4567", "NZ", "+6491234567"},
+		{"020 7946 0958", "UK", "+442079460958"},
+		{"07700 900123", "GB", "+447700900123"},
+		{"06 12 34 56 78", "FR", "+33612345678"},
+		{"030 123456", "DE", "+4930123456"},
+		{"06 1234 5678", "IT", "+390612345678"},
+		{"0039 06 1234 5678", "DE", "+390612345678"},
+		{"06 30 123 4567", "HU", "+36301234567"},
+		{"+1 415 555 2671", "AU", "+14155552671"},
+		{"0412 345", "AU", ""},
+		{"0412345678", "", ""},
+		{"+61 5 1234 5678", "AU", ""},
+		{"+44 20 7946", "GB", ""},
+		{"06 12 34 56 78 9", "FR", ""},
+		{"+1 415 CALL NOW", "", ""},
+		{"0412345678", "US", ""},
+	}
+
+	for _, test := range tests {
+		e164, ok := NormalisePhone(test.Phone, test.Region)
+		if ok != (len(test.E164) > 0) || e164 != test.E164 {
+			t.Errorf("'%s' in %s: Expected '%s', but was '%s' (%t)", test.Phone, test.Region, test.E164, e164, ok)
+		}
+	}
+}
+
+func TestPhone(t *testing.T) {
+	var tests = []struct {
+		Phone  string
+		Accept bool
+	}{
+		{"0412345678", true},
+		{"+61 412 345 678", true},
+		{"+6141", false},
+		{"04123", false},
+	}
+
+	for _, test := range tests {
+		ctx := SetContext(context.Background())
+
+		if res := Phone(ctx, "phone", test.Phone); res != test.Accept {
+			t.Errorf("Expected '%s' accepted %t, but was %t", test.Phone, test.Accept, res)
+		}
+	}
+
+	ctx := SetContext(context.Background())
+	PhoneInRegion(ctx, "phone", "12345", "uk")
+
+	errs := ListErrors(ctx)
+	if len(errs) != 1 || errs[0].Code != CodePhone || errs[0].Params["region"] != "GB" {
+		t.Errorf("Unexpected errors: %+v", errs)
+	}
+}
+
+func TestPostcode(t *testing.T) {
+	var tests = []struct {
+		Postcode string
+		Country  string
+		Accept   bool
+	}{
+		{"3000", "AU", true},
+		{"300", "AU", false},
+		{"6011", "NZ", true},
+		{"SW1A 1AA", "GB", true},
+		{"sw1a1aa", "UK", true},
+		{"M1 1AE", "GB", true},
+		{"EC1A 1BB", "GB", true},
+		{"Q1 1AA", "GB", false},
+		{"D02 X285", "IE", true},
+		{"D02 X28", "IE", false},
+		{"1234 AB", "NL", true},
+		{"0123 AB", "NL", false},
+		{"00-950", "PL", true},
+		{"00950", "PL", false},
+		{"1000-001", "PT", true},
+		{"28013", "ES", true},
+		{"53000", "ES", false},
+		{"LV-1050", "LV", true},
+		{"90210", "US", true},
+		{"", "US", false},
+	}
+
+	for _, test := range tests {
+		ctx := SetContext(context.Background())
+
+		if res := Postcode(ctx, "postcode", test.Postcode, test.Country); res != test.Accept {
+			t.Errorf("Expected '%s' in %s accepted %t, but was %t", test.Postcode, test.Country, test.Accept, res)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package validate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	zxcvbn "github.com/nbutton23/zxcvbn-go"
+	"github.com/nbutton23/zxcvbn-go/match"
+	"github.com/sirupsen/logrus"
+)
+
+// PasswordPolicy One rule for passwords.  Returns why the password failed,
+// telling the user how to fix it, or nil if the password passes.  userInputs
+// are values specific to the user, such as their username and email address,
+// which the password shouldn't be based on
+type PasswordPolicy func(password string, userInputs []string) *Failure
+
+// Failure Why a value was rejected, as an error code and the params for its
+// message
+type Failure struct {
+	Code   string
+	Params Params
+	// Message Optional.  Used instead of the code's message from the
+	// catalogue
+	Message string
+}
+
+// addFailure Adds the failure as a validation error
+func addFailure(ctx context.Context, field string, f Failure) {
+	if len(f.Message) > 0 {
+		addError(ctx, Error{Field: field, Message: f.Message, Code: f.Code, Params: f.Params})
+		return
+	}
+
+	AddCodedError(ctx, field, f.Code, f.Params)
+}
+
+// PasswordPolicies Checks the password against each policy, adding an error
+// to field for every policy it fails
+func PasswordPolicies(ctx context.Context, field string, password string, userInputs []string, policies ...PasswordPolicy) bool {
+	ok := true
+
+	for _, policy := range policies {
+		if f := policy(password, userInputs); f != nil {
+			addFailure(ctx, field, *f)
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+// NISTPasswordPolicies Returns policies following NIST SP 800-63B: at least 8
+// characters, up to 64 allowed, no repetitive or sequential characters, no
+// user specific values, and not in the breach list if one is given.  NIST
+// recommends against composition rules such as requiring upper case letters
+func NISTPasswordPolicies(breaches *BreachList) []PasswordPolicy {
+	policies := []PasswordPolicy{
+		PasswordMinLength(8),
+		PasswordMaxLength(64),
+		PasswordNotRepetitive(),
+		PasswordNoUserInputs(),
+	}
+
+	if breaches != nil {
+		policies = append(policies, PasswordNotBreached(*breaches))
+	}
+
+	return policies
+}
+
+// Policy Returns the validator as a PasswordPolicy, so that it can be
+// combined with others
+func (v PasswordValidator) Policy(minLength uint) PasswordPolicy {
+	return func(password string, userInputs []string) *Failure {
+		if v.Validate(password, minLength) {
+			return nil
+		}
+
+		if len(v.Code) > 0 {
+			return &Failure{Code: v.Code, Params: Params{"minLength": minLength}}
+		}
+
+		return &Failure{Code: CodeCustom, Message: fmt.Sprintf(v.Failure, minLength)}
+	}
+}
+
+// PasswordMinLength Password must have at least n characters
+func PasswordMinLength(n int) PasswordPolicy {
+	return func(password string, userInputs []string) *Failure {
+		if utf8.RuneCountInString(password) < n {
+			return &Failure{Code: CodeLengthMin, Params: Params{"min": n}}
+		}
+
+		return nil
+	}
+}
+
+// PasswordMaxLength Password must have at most n characters.  Limits the
+// work done hashing very long passwords.  Counts characters, not bytes, so
+// when hashing with bcrypt, which security.Hash refuses for passwords over 72
+// bytes, a password within n characters may still be too long
+func PasswordMaxLength(n int) PasswordPolicy {
+	return func(password string, userInputs []string) *Failure {
+		if utf8.RuneCountInString(password) > n {
+			return &Failure{Code: CodeLengthMax, Params: Params{"max": n}}
+		}
+
+		return nil
+	}
+}
+
+// PasswordStrength Password must have a zxcvbn score of at least minScore,
+// from 0 (guessable in moments) to 4 (very hard to guess).  User inputs are
+// included in zxcvbn's dictionaries, so passwords based on them score low.
+// 3 is a reasonable minimum for most projects
+func PasswordStrength(minScore int) PasswordPolicy {
+	return func(password string, userInputs []string) *Failure {
+		result := zxcvbn.PasswordStrength(password, passwordInputs(userInputs))
+		if result.Score >= minScore {
+			return nil
+		}
+
+		return &Failure{
+			Code: CodePasswordWeak,
+			Params: Params{
+				"score":    result.Score,
+				"minScore": minScore,
+				"tips":     strengthTips(result.MatchSequence),
+			},
+		}
+	}
+}
+
+// strengthTips Returns codes of tips for avoiding the weaknesses zxcvbn
+// found
+func strengthTips(matches []match.Match) MessageCodes {
+	seen := map[string]bool{}
+	var tips MessageCodes
+
+	add := func(tip string) {
+		if !seen[tip] {
+			seen[tip] = true
+			tips = append(tips, tip)
+		}
+	}
+
+	for _, m := range matches {
+		switch m.Pattern {
+		case "dictionary":
+			switch {
+			case strings.HasPrefix(m.DictionaryName, "user_inputs"):
+				add(CodePasswordTipUserInputs)
+			case strings.HasSuffix(m.DictionaryName, "_3117"):
+				add(CodePasswordTipSubstitution)
+			default:
+				add(CodePasswordTipCommon)
+			}
+		case "spatial":
+			add(CodePasswordTipKeyboard)
+		case "repeat":
+			add(CodePasswordTipRepeat)
+		case "sequence":
+			add(CodePasswordTipSequence)
+		case "date":
+			add(CodePasswordTipDate)
+		}
+	}
+
+	add(CodePasswordTipMoreWords)
+
+	return tips
+}
+
+// PasswordNoUserInputs Password must not contain any of the user inputs, or
+// the name part of an email address
+func PasswordNoUserInputs() PasswordPolicy {
+	return func(password string, userInputs []string) *Failure {
+		lower := strings.ToLower(password)
+
+		for _, input := range passwordInputs(userInputs) {
+			// Very short values would match too many passwords by chance:
+			if len(input) >= 3 && strings.Contains(lower, input) {
+				return &Failure{Code: CodePasswordUserInputs}
+			}
+		}
+
+		return nil
+	}
+}
+
+// PasswordNotRepetitive Password must not be only a repeated character or
+// short pattern, e.g., 'aaaaaaaa' or 'abcabcabc', or a sequence, e.g.,
+// '12345678' or 'abcdefgh'
+func PasswordNotRepetitive() PasswordPolicy {
+	return func(password string, userInputs []string) *Failure {
+		runes := []rune(strings.ToLower(password))
+
+		if len(runes) > 0 && (repeatsUnit(runes, 3) || sequential(runes)) {
+			return &Failure{Code: CodePasswordRepetitive}
+		}
+
+		return nil
+	}
+}
+
+// repeatsUnit Returns true if runes is made of a unit of up to max runes
+// repeated at least twice
+func repeatsUnit(runes []rune, max int) bool {
+	for n := 1; n <= max && n*2 <= len(runes); n++ {
+		if len(runes)%n != 0 {
+			continue
+		}
+
+		repeats := true
+		for i := n; i < len(runes); i++ {
+			if runes[i] != runes[i-n] {
+				repeats = false
+				break
+			}
+		}
+
+		if repeats {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sequential Returns true if each rune is one more, or each one less, than
+// the one before
+func sequential(runes []rune) bool {
+	if len(runes) < 3 {
+		return false
+	}
+
+	step := runes[1] - runes[0]
+	if step != 1 && step != -1 {
+		return false
+	}
+
+	for i := 2; i < len(runes); i++ {
+		if runes[i]-runes[i-1] != step {
+			return false
+		}
+	}
+
+	return true
+}
+
+// PasswordNotBreached Password must not appear in the breach list.  Passes if
+// the list can't be read, logging the error, rather than preventing every
+// user from setting a password
+func PasswordNotBreached(breaches BreachList) PasswordPolicy {
+	return func(password string, userInputs []string) *Failure {
+		found, err := breaches.Contains(password)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{"error": err, "dir": breaches.Dir}).Error("Failed to read password breach list")
+			return nil
+		}
+
+		if !found {
+			return nil
+		}
+
+		return &Failure{Code: CodePasswordBreached}
+	}
+}
+
+// passwordInputs Returns the user inputs in lower case, adding the name part
+// of any email addresses
+func passwordInputs(userInputs []string) []string {
+	var inputs []string
+
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if len(input) == 0 {
+			continue
+		}
+
+		inputs = append(inputs, input)
+		if i := strings.Index(input, "@"); i > 0 {
+			inputs = append(inputs, input[:i])
+		}
+	}
+
+	return inputs
+}
@@ -0,0 +1,163 @@
+package validate
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var passwordPolicyTests = []struct {
+	Name       string
+	Policy     PasswordPolicy
+	Password   string
+	UserInputs []string
+	Accept     bool
+}{
+	{Name: "Min length", Policy: PasswordMinLength(8), Password: "short", Accept: false},
+	{Name: "Min length counts characters", Policy: PasswordMinLength(4), Password: "日本語", Accept: false},
+	{Name: "Min length", Policy: PasswordMinLength(8), Password: "longenough", Accept: true},
+	{Name: "Max length", Policy: PasswordMaxLength(8), Password: "muchtoolong", Accept: false},
+	{Name: "Max length", Policy: PasswordMaxLength(8), Password: "fine", Accept: true},
+	{Name: "Strength", Policy: PasswordStrength(3), Password: "password1", Accept: false},
+	{Name: "Strength", Policy: PasswordStrength(3), Password: "correct horse battery staple", Accept: true},
+	{Name: "Strength user input", Policy: PasswordStrength(3), Password: "coolcat1987", UserInputs: []string{"coolcat"}, Accept: false},
+	{Name: "No user inputs", Policy: PasswordNoUserInputs(), Password: "IamCoolCat!", UserInputs: []string{"coolcat"}, Accept: false},
+	{Name: "No user inputs email", Policy: PasswordNoUserInputs(), Password: "jane.doe99", UserInputs: []string{"Jane.Doe@example.com"}, Accept: false},
+	{Name: "No user inputs", Policy: PasswordNoUserInputs(), Password: "unrelated words", UserInputs: []string{"coolcat", "ab"}, Accept: true},
+	{Name: "Repeated", Policy: PasswordNotRepetitive(), Password: "aaaaaaaa", Accept: false},
+	{Name: "Repeated unit", Policy: PasswordNotRepetitive(), Password: "abcabcabc", Accept: false},
+	{Name: "Ascending", Policy: PasswordNotRepetitive(), Password: "12345678", Accept: false},
+	{Name: "Descending", Policy: PasswordNotRepetitive(), Password: "HGFEDCBA", Accept: false},
+	{Name: "Not repetitive", Policy: PasswordNotRepetitive(), Password: "abcdefgx", Accept: true},
+	{Name: "Validator", Policy: PasswordUpperLowerNumber.Policy(4), Password: "2IJO", Accept: false},
+	{Name: "Validator", Policy: PasswordUpperLowerNumber.Policy(4), Password: "2iJo", Accept: true},
+}
+
+func TestPasswordPolicies(t *testing.T) {
+	for _, test := range passwordPolicyTests {
+		ctx := SetContext(context.Background())
+
+		res := PasswordPolicies(ctx, "password", test.Password, test.UserInputs, test.Policy)
+		if res != test.Accept {
+			t.Errorf("%s: Expected password '%s' accepted %t, but was %t: %s", test.Name, test.Password, test.Accept, res, ErrorsString(ctx))
+		}
+
+		if n := len(ListErrors(ctx)); res == (n > 0) {
+			t.Errorf("%s: Expected errors only when rejected, but had %d", test.Name, n)
+		}
+	}
+}
+
+func TestPasswordPoliciesReportsEach(t *testing.T) {
+	ctx := SetContext(context.Background())
+
+	PasswordPolicies(ctx, "password", "aaa", nil, NISTPasswordPolicies(nil)...)
+
+	errs := ListErrors(ctx)
+	if len(errs) != 2 {
+		t.Fatalf("Expected errors for length and repetition, but had: %s", ErrorsString(ctx))
+	}
+
+	for _, e := range errs {
+		if e.Field != "password" {
+			t.Errorf("Expected error on field 'password', but was '%s'", e.Field)
+		}
+	}
+}
+
+func TestPasswordStrengthFeedback(t *testing.T) {
+	f := PasswordStrength(3)("poiuytrewq", nil)
+	if f == nil || f.Code != CodePasswordWeak {
+		t.Fatalf("Expected %s failure, but was %+v", CodePasswordWeak, f)
+	}
+
+	msg := message("en", f.Code, f.Params)
+	if !strings.Contains(msg, "keyboard") {
+		t.Errorf("Expected feedback about keyboard patterns, but was: %s", msg)
+	}
+}
+
+// writeBreachList Writes the passwords to a breach list in a new directory
+func writeBreachList(t *testing.T, passwords ...string) string {
+	dir, err := ioutil.TempDir("", "breaches")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range passwords {
+		sum := sha1.Sum([]byte(p))
+		hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+		f, err := os.OpenFile(filepath.Join(dir, hash[:5]), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(hash[5:] + ":42\r\n")
+		f.Close()
+	}
+
+	return dir
+}
+
+func TestBreachList(t *testing.T) {
+	dir := writeBreachList(t, "password", "letmein")
+	defer os.RemoveAll(dir)
+
+	list, err := NewBreachList(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		Password string
+		Breached bool
+	}{
+		{"password", true},
+		{"letmein", true},
+		{"Password", false},
+		{"correct horse battery staple", false},
+	}
+
+	for _, test := range tests {
+		found, err := list.Contains(test.Password)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if found != test.Breached {
+			t.Errorf("Expected '%s' breached %t, but was %t", test.Password, test.Breached, found)
+		}
+
+		accepted := PasswordNotBreached(*list)(test.Password, nil) == nil
+		if accepted == test.Breached {
+			t.Errorf("Expected '%s' accepted %t, but was %t", test.Password, !test.Breached, accepted)
+		}
+	}
+
+	if _, err := NewBreachList(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("Expected error for missing breach list")
+	}
+
+	// A list that can't be read lets the password through:
+	err = os.Mkdir(filepath.Join(dir, "unreadable"), 0700)
+	if err == nil {
+		err = os.Mkdir(filepath.Join(dir, "unreadable", "5BAA6"), 0700)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unreadable := BreachList{Dir: filepath.Join(dir, "unreadable")}
+	if _, err := unreadable.Contains("password"); err == nil {
+		t.Errorf("Expected error reading breach list")
+	}
+
+	if PasswordNotBreached(unreadable)("password", nil) != nil {
+		t.Errorf("Expected password accepted when the breach list can't be read")
+	}
+}
@@ -0,0 +1,70 @@
+package validate
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// postcodeRxs Postcode formats by ISO 3166 code, for AU, NZ, the UK and the
+// EU.  Postcodes are upper cased before matching
+var postcodeRxs = map[string]*regexp.Regexp{
+	"AU": regexp.MustCompile(`^\d{4}$`),
+	"NZ": regexp.MustCompile(`^\d{4}$`),
+	"GB": regexp.MustCompile(`^(GIR ?0AA|[A-PR-UWYZ](\d[A-HJKPSTUW]?|\d{2}|[A-HK-Y]\d[ABEHMNPRV-Y]?|[A-HK-Y]\d{2}) ?\d[ABD-HJLNP-UW-Z]{2})$`),
+	"AT": regexp.MustCompile(`^\d{4}$`),
+	"BE": regexp.MustCompile(`^\d{4}$`),
+	"BG": regexp.MustCompile(`^\d{4}$`),
+	"HR": regexp.MustCompile(`^\d{5}$`),
+	"CY": regexp.MustCompile(`^\d{4}$`),
+	"CZ": regexp.MustCompile(`^\d{3} ?\d{2}$`),
+	"DK": regexp.MustCompile(`^\d{4}$`),
+	"EE": regexp.MustCompile(`^\d{5}$`),
+	"FI": regexp.MustCompile(`^\d{5}$`),
+	"FR": regexp.MustCompile(`^\d{5}$`),
+	"DE": regexp.MustCompile(`^\d{5}$`),
+	"GR": regexp.MustCompile(`^\d{3} ?\d{2}$`),
+	"HU": regexp.MustCompile(`^\d{4}$`),
+	// Eircodes:
+	"IE": regexp.MustCompile(`^([AC-FHKNPRTV-Y]\d{2}|D6W) ?[0-9AC-FHKNPRTV-Y]{4}$`),
+	"IT": regexp.MustCompile(`^\d{5}$`),
+	"LV": regexp.MustCompile(`^(LV-)?\d{4}$`),
+	"LT": regexp.MustCompile(`^(LT-)?\d{5}$`),
+	"LU": regexp.MustCompile(`^(L-)?\d{4}$`),
+	"MT": regexp.MustCompile(`^[A-Z]{3} ?\d{2,4}$`),
+	"NL": regexp.MustCompile(`^[1-9]\d{3} ?[A-Z]{2}$`),
+	"PL": regexp.MustCompile(`^\d{2}-\d{3}$`),
+	"PT": regexp.MustCompile(`^\d{4}-\d{3}$`),
+	"RO": regexp.MustCompile(`^\d{6}$`),
+	"SK": regexp.MustCompile(`^\d{3} ?\d{2}$`),
+	"SI": regexp.MustCompile(`^(SI-)?\d{4}$`),
+	"ES": regexp.MustCompile(`^(0[1-9]|[1-4]\d|5[0-2])\d{3}$`),
+	"SE": regexp.MustCompile(`^\d{3} ?\d{2}$`),
+}
+
+// ValidPostcode Returns true if v is a valid postcode for country, e.g., AU.
+// Postcodes for countries without a known format are accepted, so long as
+// they're not empty
+func ValidPostcode(v string, country string) bool {
+	v = strings.ToUpper(strings.TrimSpace(v))
+	if len(v) == 0 {
+		return false
+	}
+
+	rx, ok := postcodeRxs[normaliseRegion(country)]
+	if !ok {
+		return true
+	}
+
+	return rx.MatchString(v)
+}
+
+// Postcode Checks that v is a valid postcode for country, e.g., AU
+func Postcode(ctx context.Context, field string, v string, country string) bool {
+	if !ValidPostcode(v, country) {
+		AddCodedError(ctx, field, CodePostcode, Params{"country": normaliseRegion(country)})
+		return false
+	}
+
+	return true
+}
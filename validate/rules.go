@@ -0,0 +1,416 @@
+package validate
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/episub/pqt"
+	"github.com/sirupsen/logrus"
+)
+
+// Op A comparison between two fields
+type Op string
+
+// Comparisons used by Rules.Compare
+const (
+	OpEqual          Op = "=="
+	OpNotEqual       Op = "!="
+	OpLess           Op = "<"
+	OpLessOrEqual    Op = "<="
+	OpGreater        Op = ">"
+	OpGreaterOrEqual Op = ">="
+)
+
+// opCodes Error code added when each comparison fails
+var opCodes = map[Op]string{
+	OpEqual:          CodeEqual,
+	OpNotEqual:       CodeNotEqual,
+	OpLess:           CodeLess,
+	OpLessOrEqual:    CodeLessOrEqual,
+	OpGreater:        CodeGreater,
+	OpGreaterOrEqual: CodeGreaterOrEqual,
+}
+
+// AsyncCheck Checks a value that needs a slow lookup, such as a database
+// query.  Returns a failure if the value is invalid, or an error if the
+// check couldn't be made
+type AsyncCheck func(ctx context.Context) (*Failure, error)
+
+// Rules Builds a set of checks that depend on more than one value, run
+// together by Validate.  E.g.:
+//
+//	ok, err := validate.NewRules().
+//		RequiredWith("postcode", input.Postcode, "address", input.Address).
+//		Compare("endDate", input.EndDate, validate.OpGreater, "startDate", input.StartDate).
+//		Unique("email", func(ctx context.Context) (bool, error) {
+//			return emailUsed(ctx, input.Email)
+//		}).
+//		Validate(ctx)
+type Rules struct {
+	checks []func(ctx context.Context) bool
+	async  []asyncRule
+}
+
+type asyncRule struct {
+	field string
+	check AsyncCheck
+}
+
+// NewRules Returns an empty set of rules
+func NewRules() *Rules {
+	return &Rules{}
+}
+
+// Check Adds a check, e.g., one of the validators in this package:
+//
+//	r.Check(func(ctx context.Context) bool {
+//		return validate.Email(ctx, "email", input.Email)
+//	})
+func (r *Rules) Check(check func(ctx context.Context) bool) *Rules {
+	r.checks = append(r.checks, check)
+	return r
+}
+
+// When Adds the checks only if cond is true, e.g., to check a field only
+// when another has a particular value
+func (r *Rules) When(cond bool, checks func(r *Rules)) *Rules {
+	if cond {
+		checks(r)
+	}
+
+	return r
+}
+
+// RequiredIf Requires v to be set if cond is true
+func (r *Rules) RequiredIf(field string, v interface{}, cond bool) *Rules {
+	return r.Check(func(ctx context.Context) bool {
+		if cond && !IsSet(v) {
+			AddCodedError(ctx, field, CodeRequired, nil)
+			return false
+		}
+
+		return true
+	})
+}
+
+// RequiredWith Requires v to be set if other, the value of otherField, is
+// set
+func (r *Rules) RequiredWith(field string, v interface{}, otherField string, other interface{}) *Rules {
+	return r.Check(func(ctx context.Context) bool {
+		if IsSet(other) && !IsSet(v) {
+			AddCodedError(ctx, field, CodeRequiredWith, Params{"other": otherField})
+			return false
+		}
+
+		return true
+	})
+}
+
+// Compare Requires a, the value of field, to compare to b, the value of
+// otherField, by op.  E.g., Compare("endDate", end, OpGreater, "startDate",
+// start) requires the end date to be after the start.  Values may be
+// numbers, strings, bools (equality only), time.Time, civil.Date, pqt.Date
+// or pqt.NullDate, and pointers to these.  The check is skipped if either
+// value isn't set, so use RequiredIf or RequiredWith as well if needed.  An
+// unknown op, or values that can't be compared, are logged and fail the
+// check with an INVALID error
+func (r *Rules) Compare(field string, a interface{}, op Op, otherField string, b interface{}) *Rules {
+	code, ok := opCodes[op]
+	if !ok {
+		return r.Check(func(ctx context.Context) bool {
+			return compareError(ctx, field, fmt.Errorf("Unknown comparison '%s'", op))
+		})
+	}
+
+	return r.Check(func(ctx context.Context) bool {
+		if !IsSet(a) || !IsSet(b) {
+			return true
+		}
+
+		res, err := compare(a, b, op)
+		if err != nil {
+			return compareError(ctx, field, err)
+		}
+
+		if !res {
+			AddCodedError(ctx, field, code, Params{"other": otherField})
+			return false
+		}
+
+		return true
+	})
+}
+
+// compareError Logs a comparison that couldn't be made, and fails the field
+// with an INVALID error, since this is a programming error rather than bad
+// input
+func compareError(ctx context.Context, field string, err error) bool {
+	logrus.WithFields(logrus.Fields{"field": field, "error": err}).Error("Invalid comparison")
+	AddCodedError(ctx, field, CodeInvalid, nil)
+	return false
+}
+
+// Async Adds a check run concurrently with the other async checks, once the
+// other rules have been checked.  It's skipped if the field already has an
+// error, e.g., there's no need to look up an invalid email address
+func (r *Rules) Async(field string, check AsyncCheck) *Rules {
+	r.async = append(r.async, asyncRule{field: field, check: check})
+	return r
+}
+
+// Unique Adds an async check that the field's value isn't already used,
+// where exists looks up the value, e.g., in the database
+func (r *Rules) Unique(field string, exists func(ctx context.Context) (bool, error)) *Rules {
+	return r.Async(field, func(ctx context.Context) (*Failure, error) {
+		found, err := exists(ctx)
+		if err != nil || !found {
+			return nil, err
+		}
+
+		return &Failure{Code: CodeUnique}, nil
+	})
+}
+
+// Validate Runs the checks, adding an error for each that fails, and returns
+// true if all passed.  The async checks are run concurrently, and their
+// failures added in the order the checks were added.  Returns the first
+// error from an async check, including one that panicked, in which case the
+// rules should be treated as failed
+func (r *Rules) Validate(ctx context.Context) (bool, error) {
+	sctx := Scope(ctx)
+
+	ok := true
+	for _, check := range r.checks {
+		ok = check(sctx) && ok
+	}
+
+	// Fields with errors from this set of rules:
+	failed := map[string]bool{}
+	for _, e := range ListErrors(sctx) {
+		failed[e.Field] = true
+	}
+
+	type result struct {
+		failure *Failure
+		err     error
+	}
+
+	results := make([]result, len(r.async))
+	var wg sync.WaitGroup
+
+	for i, a := range r.async {
+		if failed[a.field] {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, a asyncRule) {
+			defer wg.Done()
+			defer func() {
+				if p := recover(); p != nil {
+					logrus.WithFields(logrus.Fields{"field": a.field, "panic": p}).Error("Async validation check panicked")
+					results[i] = result{err: fmt.Errorf("Async check of '%s' panicked: %v", a.field, p)}
+				}
+			}()
+
+			f, err := a.check(ctx)
+			results[i] = result{failure: f, err: err}
+		}(i, a)
+	}
+
+	wg.Wait()
+
+	var err error
+	for i, res := range results {
+		if res.err != nil {
+			if err == nil {
+				err = res.err
+			}
+			continue
+		}
+
+		if res.failure != nil {
+			addFailure(sctx, r.async[i].field, *res.failure)
+			ok = false
+		}
+	}
+
+	return ok && err == nil, err
+}
+
+// IsSet Returns true if v is set.  Nil pointers, interfaces, slices and
+// maps, empty strings and lists, and null pqt.NullDates aren't set.  Zero
+// numbers and false are set, since they're valid values of inputs, and
+// optional inputs are nil when left out
+func IsSet(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return false
+		}
+		rv = rv.Elem()
+	}
+
+	if !rv.IsValid() {
+		return false
+	}
+
+	if d, ok := rv.Interface().(pqt.NullDate); ok {
+		return d.Valid
+	}
+
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return rv.Len() > 0
+	}
+
+	return true
+}
+
+// compare Returns true if a op b holds, or an error if a and b can't be
+// compared
+func compare(a interface{}, b interface{}, op Op) (bool, error) {
+	av, bv := indirect(a), indirect(b)
+
+	var c int
+	switch x := av.(type) {
+	case time.Time:
+		y, ok := bv.(time.Time)
+		if !ok {
+			return false, compareTypeError(av, bv)
+		}
+		c = compareTimes(x, y)
+	case civil.Date:
+		y, ok := bv.(civil.Date)
+		if !ok {
+			return false, compareTypeError(av, bv)
+		}
+		c = compareDates(x, y)
+	case pqt.Date:
+		y, ok := bv.(pqt.Date)
+		if !ok {
+			return false, compareTypeError(av, bv)
+		}
+		c = compareDates(x.Date, y.Date)
+	case pqt.NullDate:
+		y, ok := bv.(pqt.NullDate)
+		if !ok {
+			return false, compareTypeError(av, bv)
+		}
+		c = compareDates(x.Date, y.Date)
+	case bool:
+		y, ok := bv.(bool)
+		if !ok {
+			return false, compareTypeError(av, bv)
+		}
+		if op != OpEqual && op != OpNotEqual {
+			return false, fmt.Errorf("Cannot compare bools with '%s'", op)
+		}
+		if x != y {
+			c = 1
+		}
+	default:
+		var err error
+		c, err = compareValues(reflect.ValueOf(av), reflect.ValueOf(bv))
+		if err != nil {
+			return false, err
+		}
+	}
+
+	switch op {
+	case OpEqual:
+		return c == 0, nil
+	case OpNotEqual:
+		return c != 0, nil
+	case OpLess:
+		return c < 0, nil
+	case OpLessOrEqual:
+		return c <= 0, nil
+	case OpGreater:
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+// compareValues Compares numbers or strings, returning -1, 0 or 1
+func compareValues(a reflect.Value, b reflect.Value) (int, error) {
+	switch {
+	case a.Kind() == reflect.String && b.Kind() == reflect.String:
+		return strings.Compare(a.String(), b.String()), nil
+	case isNumber(a) && isNumber(b):
+		x, y := toFloat(a), toFloat(b)
+		switch {
+		case x < y:
+			return -1, nil
+		case x > y:
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	return 0, compareTypeError(a.Interface(), b.Interface())
+}
+
+func compareTimes(a time.Time, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+
+	return 0
+}
+
+func compareDates(a civil.Date, b civil.Date) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+
+	return 0
+}
+
+func compareTypeError(a interface{}, b interface{}) error {
+	return fmt.Errorf("Cannot compare %T with %T", a, b)
+}
+
+// indirect Returns the value pointed to by v, if it's a pointer
+func indirect(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+
+	return rv.Interface()
+}
+
+func isNumber(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return false
+}
+
+func toFloat(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
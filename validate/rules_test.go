@@ -0,0 +1,242 @@
+package validate
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/episub/pqt"
+)
+
+func TestRequiredRules(t *testing.T) {
+	var empty *string
+	var noPostcode *int
+	street := "1 Main St"
+	zero := 0
+
+	var tests = []struct {
+		Name   string
+		Rules  *Rules
+		Fields []string
+	}{
+		{"RequiredIf unset", NewRules().RequiredIf("abn", "", true), []string{"abn"}},
+		{"RequiredIf set", NewRules().RequiredIf("abn", "51824753556", true), nil},
+		{"RequiredIf not needed", NewRules().RequiredIf("abn", "", false), nil},
+		{"RequiredIf zero", NewRules().RequiredIf("discount", &zero, true), nil},
+		{"RequiredIf false", NewRules().RequiredIf("subscribe", false, true), nil},
+		{"RequiredWith nil", NewRules().RequiredWith("postcode", noPostcode, "street", empty), nil},
+		{"RequiredWith", NewRules().RequiredWith("postcode", noPostcode, "street", &street), []string{"postcode"}},
+		{"RequiredWith set", NewRules().RequiredWith("postcode", 3000, "street", &street), nil},
+		{"RequiredWith empty", NewRules().RequiredWith("postcode", "", "street", &street), []string{"postcode"}},
+		{"When", NewRules().When(true, func(r *Rules) { r.RequiredIf("a", "", true).RequiredIf("b", "", true) }), []string{"a", "b"}},
+		{"When false", NewRules().When(false, func(r *Rules) { r.RequiredIf("a", "", true) }), nil},
+	}
+
+	for _, test := range tests {
+		ctx := SetContext(context.Background())
+
+		ok, err := test.Rules.Validate(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok != (len(test.Fields) == 0) {
+			t.Errorf("%s: Expected valid %t, but was %t", test.Name, len(test.Fields) == 0, ok)
+		}
+
+		errs := ListErrors(ctx)
+		if len(errs) != len(test.Fields) {
+			t.Errorf("%s: Expected %d errors, but had: %s", test.Name, len(test.Fields), ErrorsString(ctx))
+			continue
+		}
+
+		for i, e := range errs {
+			if e.Field != test.Fields[i] {
+				t.Errorf("%s: Expected error on '%s', but was '%s'", test.Name, test.Fields[i], e.Field)
+			}
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	now := time.Now()
+	today := civil.DateOf(now)
+	ten := 10
+
+	var tests = []struct {
+		A      interface{}
+		Op     Op
+		B      interface{}
+		Accept bool
+	}{
+		{5, OpLess, 10, true},
+		{5, OpGreater, 10, false},
+		{&ten, OpGreaterOrEqual, 10, true},
+		{int64(10), OpEqual, 10.0, true},
+		{"a", OpLess, "b", true},
+		{"a", OpNotEqual, "a", false},
+		{true, OpNotEqual, true, false},
+		{now.Add(time.Hour), OpGreater, now, true},
+		{today, OpLessOrEqual, today.AddDays(-1), false},
+		{today, OpLessOrEqual, today, true},
+		{pqt.Date{Date: today}, OpLess, pqt.Date{Date: today.AddDays(1)}, true},
+		{pqt.NullDate{Date: today, Valid: true}, OpGreater, pqt.NullDate{Date: today, Valid: true}, false},
+		{pqt.NullDate{}, OpGreater, pqt.NullDate{Date: today, Valid: true}, true},
+		// Zero and false are values like any other:
+		{0, OpGreater, 10, false},
+		{0, OpLessOrEqual, 0, true},
+		{false, OpEqual, true, false},
+		// Unset values are left to the required rules:
+		{(*int)(nil), OpGreater, 10, true},
+		{"", OpEqual, "a", true},
+	}
+
+	for _, test := range tests {
+		ctx := SetContext(context.Background())
+
+		ok, _ := NewRules().Compare("a", test.A, test.Op, "b", test.B).Validate(ctx)
+		if ok != test.Accept {
+			t.Errorf("Expected %v %s %v accepted %t, but was %t", test.A, test.Op, test.B, test.Accept, ok)
+		}
+
+		if ok == HasErrors(ctx) {
+			t.Errorf("Expected errors only when rejected for %v %s %v", test.A, test.Op, test.B)
+		}
+	}
+}
+
+func TestCompareCode(t *testing.T) {
+	ctx := SetContext(context.Background())
+	NewRules().Compare("endDate", 1, OpGreater, "startDate", 2).Validate(ctx)
+
+	e := (ListErrors(ctx))[0]
+	if e.Code != CodeGreater || e.Message != "Must be greater than startDate" {
+		t.Errorf("Unexpected error: %+v", e)
+	}
+}
+
+func TestCompareInvalid(t *testing.T) {
+	var tests = []struct {
+		Name string
+		A    interface{}
+		Op   Op
+		B    interface{}
+	}{
+		{"String with int", "1", OpEqual, 1},
+		{"Time with date", time.Now(), OpLess, civil.Date{Year: 2020, Month: 1, Day: 1}},
+		{"Bools by order", true, OpGreater, false},
+		{"Unknown operator", 1, Op("=~"), 2},
+	}
+
+	for _, test := range tests {
+		ctx := SetContext(context.Background())
+		ok, err := NewRules().Compare("a", test.A, test.Op, "b", test.B).Validate(ctx)
+		if ok || err != nil {
+			t.Errorf("%s: Expected rejected without error, but was %t, %v", test.Name, ok, err)
+		}
+
+		errs := ListErrors(ctx)
+		if len(errs) != 1 || errs[0].Field != "a" || errs[0].Code != CodeInvalid {
+			t.Errorf("%s: Expected %s on a, but had %+v", test.Name, CodeInvalid, errs)
+		}
+	}
+}
+
+func TestAsyncRules(t *testing.T) {
+	ctx := SetContext(context.Background())
+
+	var running, maxRunning int32
+	slowCheck := func(found bool) func(ctx context.Context) (bool, error) {
+		return func(ctx context.Context) (bool, error) {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+
+			time.Sleep(20 * time.Millisecond)
+			return found, nil
+		}
+	}
+
+	var emailChecked bool
+	ok, err := NewRules().
+		Check(func(ctx context.Context) bool { return Email(ctx, "email", "invalid") }).
+		Unique("email", func(ctx context.Context) (bool, error) {
+			emailChecked = true
+			return true, nil
+		}).
+		Unique("username", slowCheck(true)).
+		Unique("phone", slowCheck(false)).
+		Async("code", func(ctx context.Context) (*Failure, error) {
+			return &Failure{Code: CodeCustom, Message: "Code has expired"}, nil
+		}).
+		Validate(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok {
+		t.Errorf("Expected rules to fail")
+	}
+
+	if emailChecked {
+		t.Errorf("Expected uniqueness check skipped for invalid email")
+	}
+
+	if maxRunning < 2 {
+		t.Errorf("Expected async checks to run concurrently")
+	}
+
+	errs := ListErrors(ctx)
+	if len(errs) != 3 {
+		t.Fatalf("Expected 3 errors, but had: %s", ErrorsString(ctx))
+	}
+
+	if errs[0].Code != CodeEmail || errs[1].Field != "username" || errs[1].Code != CodeUnique || errs[2].Message != "Code has expired" {
+		t.Errorf("Unexpected errors: %s", ErrorsString(ctx))
+	}
+}
+
+func TestAsyncRulesError(t *testing.T) {
+	ctx := SetContext(context.Background())
+	lookupErr := errors.New("connection refused")
+
+	ok, err := NewRules().
+		Unique("email", func(ctx context.Context) (bool, error) { return false, lookupErr }).
+		Validate(ctx)
+
+	if ok || err != lookupErr {
+		t.Errorf("Expected lookup error, but was %t, %v", ok, err)
+	}
+
+	if HasErrors(ctx) {
+		t.Errorf("Expected no validation errors, but had: %s", ErrorsString(ctx))
+	}
+}
+
+func TestAsyncRulesPanic(t *testing.T) {
+	ctx := SetContext(context.Background())
+
+	ok, err := NewRules().
+		Async("code", func(ctx context.Context) (*Failure, error) { panic("lookup failed") }).
+		Unique("email", func(ctx context.Context) (bool, error) { return true, nil }).
+		Validate(ctx)
+
+	if ok || err == nil || !strings.Contains(err.Error(), "lookup failed") {
+		t.Errorf("Expected panic returned as an error, but was %t, %v", ok, err)
+	}
+
+	if errs := ListErrors(ctx); len(errs) != 1 || errs[0].Field != "email" {
+		t.Errorf("Expected other checks' failures still added, but had: %s", ErrorsString(ctx))
+	}
+}
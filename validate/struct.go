@@ -0,0 +1,562 @@
+package validate
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// tagName Name of the struct tag holding rules
+const tagName = "validate"
+
+// Rule Checks a field's value, adding errors to field if invalid.  v is never
+// a pointer, since Struct dereferences them first.  arg is the text after '='
+// in the tag, e.g., "3..64" for len=3..64
+type Rule func(ctx context.Context, field string, v reflect.Value, arg string) bool
+
+var (
+	rulesMu sync.RWMutex
+	rules   = map[string]Rule{
+		"email":      stringRule(Email),
+		"number":     stringRule(Numbers),
+		"phone":      phoneRule,
+		"postcode":   postcodeRule,
+		"iban":       stringRule(IBAN),
+		"abn":        stringRule(ABN),
+		"vat":        stringRule(VAT),
+		"username":   stringRule(Username),
+		"letters":    stringRule(LettersWithSpaces),
+		"alnum":      stringRule(LettersWithNumbers),
+		"alnumspace": stringRule(LettersSpacesAndNumbers),
+		"url":        stringRule(URL),
+		"uuid":       uuidRule,
+		"len":        lenRule,
+		"min":        minRule,
+		"max":        maxRule,
+		"positive":   positiveRule,
+		"true":       trueRule,
+		"in":         inRule,
+	}
+)
+
+// ruleChecks Check the field type and argument of the built in rules when a
+// struct's tags are parsed, so that bad tags are found before any values are
+// checked
+var ruleChecks = map[string]func(t reflect.Type, arg string) error{
+	"email":      checkString,
+	"number":     checkString,
+	"phone":      checkString,
+	"postcode":   checkString,
+	"iban":       checkString,
+	"abn":        checkString,
+	"vat":        checkString,
+	"username":   checkString,
+	"letters":    checkString,
+	"alnum":      checkString,
+	"alnumspace": checkString,
+	"url":        checkString,
+	"uuid":       checkString,
+	"len":        checkLen,
+	"min":        checkBound,
+	"max":        checkBound,
+	"positive":   checkInt,
+	"true":       checkBool,
+	"in":         checkString,
+}
+
+// RegisterRule Makes a rule available to tags under name, replacing any rule
+// with that name.  Call at start up, before any structs using it are checked
+func RegisterRule(name string, rule Rule) {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	rules[name] = rule
+	delete(ruleChecks, name)
+}
+
+// tagRule A rule from a validate tag, with its argument
+type tagRule struct {
+	name  string
+	arg   string
+	rule  Rule
+	check func(t reflect.Type, arg string) error
+}
+
+// fieldRules The rules parsed from a field's validate tag
+type fieldRules struct {
+	required bool
+	rules    []tagRule
+	// dynamic Set for interfaces, whose rules can only be checked against
+	// the type of each value
+	dynamic bool
+	err     error
+}
+
+// structField A field of a struct, with the rules from its tag
+type structField struct {
+	index    int
+	name     string
+	embedded bool
+	rules    fieldRules
+}
+
+// structFields Parsed fields of each struct type, so tags are only parsed and
+// checked the first time a type is used
+var structFields sync.Map
+
+// fieldsOf Returns the fields of the struct type t that are validated
+func fieldsOf(t reflect.Type) []structField {
+	if fields, ok := structFields.Load(t); ok {
+		return fields.([]structField)
+	}
+
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get(tagName)
+		if tag == "-" || len(f.PkgPath) > 0 && !f.Anonymous {
+			continue
+		}
+
+		// Embedded structs' fields belong to the parent:
+		if f.Anonymous {
+			fields = append(fields, structField{index: i, embedded: true})
+			continue
+		}
+
+		fields = append(fields, structField{index: i, name: fieldName(f), rules: parseTag(f.Type, tag)})
+	}
+
+	structFields.Store(t, fields)
+	return fields
+}
+
+// parseTag Returns the rules in the tag of a field of type t, with an error
+// if a rule is unknown, or doesn't suit the field or its argument
+func parseTag(t reflect.Type, tag string) fieldRules {
+	var fr fieldRules
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	fr.dynamic = t.Kind() == reflect.Interface
+
+	for _, r := range strings.Split(tag, ",") {
+		r = strings.TrimSpace(r)
+		if len(r) == 0 {
+			continue
+		}
+
+		if r == "required" {
+			fr.required = true
+			continue
+		}
+
+		var arg string
+		if i := strings.IndexByte(r, '='); i >= 0 {
+			r, arg = r[:i], r[i+1:]
+		}
+
+		rulesMu.RLock()
+		rule, found := rules[r]
+		check := ruleChecks[r]
+		rulesMu.RUnlock()
+
+		if !found {
+			fr.err = fmt.Errorf("Unknown validation rule '%s'", r)
+			return fr
+		}
+
+		if check != nil && !fr.dynamic {
+			if err := check(t, arg); err != nil {
+				fr.err = fmt.Errorf("Validation rule '%s' %s", r, err)
+				return fr
+			}
+		}
+
+		fr.rules = append(fr.rules, tagRule{name: r, arg: arg, rule: rule, check: check})
+	}
+
+	return fr
+}
+
+// CheckTags Returns an error for the first bad validate tag in v's type, or
+// the structs nested in it, such as an unknown rule or a rule that doesn't
+// suit its field.  Struct doesn't panic on these, but logs them and rejects
+// the field, so call CheckTags at start up or in tests to find them before a
+// request does
+func CheckTags(v interface{}) error {
+	return checkTags(reflect.TypeOf(v), make(map[reflect.Type]bool))
+}
+
+func checkTags(t reflect.Type, seen map[reflect.Type]bool) error {
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct || seen[t] {
+		return nil
+	}
+	seen[t] = true
+
+	for _, f := range fieldsOf(t) {
+		if f.rules.err != nil {
+			return fmt.Errorf("%s.%s: %s", t, t.Field(f.index).Name, f.rules.err)
+		}
+
+		err := checkTags(t.Field(f.index).Type, seen)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Struct Validates the fields of v, a struct or pointer to one, according to
+// their validate tags.  Rules are separated by commas, e.g.:
+//
+//	Email string `json:"email" validate:"required,email,len=3..64"`
+//
+// Fields are named by their json tag, prefixed by path and any parent
+// fields, e.g., client.person.email, matching the loader's update paths.
+// Nested structs are always validated, and slice elements are named by their
+// index, e.g., client.phones.0.number.  Nil pointers and empty strings and
+// lists are only checked if required, but other rules apply to zero numbers
+// and false.  A field with a bad tag, such as an unknown rule, is logged and
+// rejected with an INVALID error, as is v if it isn't a struct
+func Struct(ctx context.Context, path string, v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return true
+		}
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return tagError(ctx, path, fmt.Errorf("validate.Struct needs a struct, but was given %T", v))
+	}
+
+	return validateStruct(ctx, path, rv)
+}
+
+func validateStruct(ctx context.Context, path string, rv reflect.Value) bool {
+	ok := true
+
+	for _, f := range fieldsOf(rv.Type()) {
+		fv := rv.Field(f.index)
+
+		if f.embedded {
+			ok = validateValue(ctx, path, fv, fieldRules{}) && ok
+			continue
+		}
+
+		ok = validateValue(ctx, joinPath(path, f.name), fv, f.rules) && ok
+	}
+
+	return ok
+}
+
+// validateValue Applies the rules to v, then validates any nested structs
+func validateValue(ctx context.Context, field string, v reflect.Value, fr fieldRules) bool {
+	if fr.err != nil {
+		return tagError(ctx, field, fr.err)
+	}
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return checkRequired(ctx, field, fr, false)
+		}
+		v = v.Elem()
+	}
+
+	if !checkRequired(ctx, field, fr, !isEmpty(v)) {
+		return false
+	}
+
+	ok := true
+	if !isEmpty(v) {
+		ok = applyRules(ctx, field, v, fr)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		// Values such as times are checked as a whole, not by their fields:
+		if hasExportedFields(v.Type()) {
+			ok = validateStruct(ctx, field, v) && ok
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if isStructLike(v.Index(i)) {
+				ok = validateValue(ctx, joinPath(field, strconv.Itoa(i)), v.Index(i), fieldRules{}) && ok
+			}
+		}
+	}
+
+	return ok
+}
+
+// checkRequired Adds an error if the field requires a value and there isn't
+// one
+func checkRequired(ctx context.Context, field string, fr fieldRules, present bool) bool {
+	if present || !fr.required {
+		return true
+	}
+
+	AddCodedError(ctx, field, CodeRequired, nil)
+	return false
+}
+
+// applyRules Runs each rule against v.  Rules on interfaces are checked
+// against the value's type first
+func applyRules(ctx context.Context, field string, v reflect.Value, fr fieldRules) bool {
+	ok := true
+
+	for _, r := range fr.rules {
+		if fr.dynamic && r.check != nil {
+			if err := r.check(v.Type(), r.arg); err != nil {
+				return tagError(ctx, field, fmt.Errorf("Validation rule '%s' %s", r.name, err))
+			}
+		}
+
+		ok = r.rule(ctx, field, v, r.arg) && ok
+	}
+
+	return ok
+}
+
+// tagError Logs a bad validate tag, and rejects the field with an INVALID
+// error, so that input isn't let through unchecked
+func tagError(ctx context.Context, field string, err error) bool {
+	logrus.WithFields(logrus.Fields{"field": field, "error": err}).Error("Invalid validate tag")
+	AddCodedError(ctx, field, CodeInvalid, nil)
+	return false
+}
+
+// fieldName Returns the name of the field in paths, from its json tag
+func fieldName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if len(name) == 0 || name == "-" {
+		return f.Name
+	}
+
+	return name
+}
+
+// joinPath Appends name to the dot separated path
+func joinPath(path string, name string) string {
+	if len(path) == 0 {
+		return name
+	}
+
+	return path + "." + name
+}
+
+// isEmpty Returns true for empty strings and lists.  Zero numbers and false
+// aren't empty, so rules such as min=18 and true still check them
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	default:
+		return false
+	}
+}
+
+func isStructLike(v reflect.Value) bool {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+
+	return v.Kind() == reflect.Struct
+}
+
+func hasExportedFields(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if len(t.Field(i).PkgPath) == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isInt Returns true for signed and unsigned integers
+func isInt(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
+
+// intValue Returns the value of an integer, signed or not
+func intValue(v reflect.Value) int64 {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	default:
+		return v.Int()
+	}
+}
+
+// intArg Parses the rule's argument as an integer
+func intArg(arg string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(arg))
+	if err != nil {
+		return 0, fmt.Errorf("needs an integer argument, but was '%s'", arg)
+	}
+
+	return n, nil
+}
+
+// lenArgs Parses n or m..n as a length range
+func lenArgs(arg string) (int, int, error) {
+	parts := strings.SplitN(arg, "..", 2)
+	m, err := intArg(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(parts) == 1 {
+		return m, m, nil
+	}
+
+	n, err := intArg(parts[1])
+	return m, n, err
+}
+
+func checkString(t reflect.Type, arg string) error {
+	if t.Kind() != reflect.String {
+		return fmt.Errorf("needs a string, but was used on %s", t)
+	}
+
+	return nil
+}
+
+func checkInt(t reflect.Type, arg string) error {
+	if !isInt(t.Kind()) {
+		return fmt.Errorf("needs an integer, but was used on %s", t)
+	}
+
+	return nil
+}
+
+func checkBool(t reflect.Type, arg string) error {
+	if t.Kind() != reflect.Bool {
+		return fmt.Errorf("needs a bool, but was used on %s", t)
+	}
+
+	return nil
+}
+
+func checkLen(t reflect.Type, arg string) error {
+	if err := checkString(t, arg); err != nil {
+		return err
+	}
+
+	_, _, err := lenArgs(arg)
+	return err
+}
+
+// checkBound min and max take a string or an integer
+func checkBound(t reflect.Type, arg string) error {
+	if t.Kind() != reflect.String && !isInt(t.Kind()) {
+		return fmt.Errorf("needs a string or an integer, but was used on %s", t)
+	}
+
+	_, err := intArg(arg)
+	return err
+}
+
+// stringRule Adapts a validator of strings to a Rule
+func stringRule(f func(context.Context, string, string) bool) Rule {
+	return func(ctx context.Context, field string, v reflect.Value, arg string) bool {
+		return f(ctx, field, v.String())
+	}
+}
+
+func uuidRule(ctx context.Context, field string, v reflect.Value, arg string) bool {
+	return UUID(ctx, field, v.String(), Message(ctx, CodeUUID, nil))
+}
+
+// phoneRule phone for any phone number, or phone=AU for a region's numbers
+func phoneRule(ctx context.Context, field string, v reflect.Value, arg string) bool {
+	if len(arg) == 0 {
+		return Phone(ctx, field, v.String())
+	}
+
+	return PhoneInRegion(ctx, field, v.String(), arg)
+}
+
+// postcodeRule postcode=AU
+func postcodeRule(ctx context.Context, field string, v reflect.Value, arg string) bool {
+	return Postcode(ctx, field, v.String(), arg)
+}
+
+// lenRule len=n for an exact length, or len=m..n for a range
+func lenRule(ctx context.Context, field string, v reflect.Value, arg string) bool {
+	m, n, _ := lenArgs(arg)
+
+	return Length(ctx, field, v.String(), m, n)
+}
+
+// minRule Minimum length of a string, or minimum value of an integer
+func minRule(ctx context.Context, field string, v reflect.Value, arg string) bool {
+	n, _ := intArg(arg)
+
+	if v.Kind() == reflect.String {
+		return MinimumLength(ctx, n, v.String(), field)
+	}
+
+	if intValue(v) < int64(n) {
+		AddCodedError(ctx, field, CodeMin, Params{"min": n})
+		return false
+	}
+
+	return true
+}
+
+// maxRule Maximum length of a string, or maximum value of an integer
+func maxRule(ctx context.Context, field string, v reflect.Value, arg string) bool {
+	n, _ := intArg(arg)
+
+	if v.Kind() == reflect.String {
+		if len(v.String()) > n {
+			AddCodedError(ctx, field, CodeLengthMax, Params{"max": n})
+			return false
+		}
+		return true
+	}
+
+	if intValue(v) > int64(n) {
+		AddCodedError(ctx, field, CodeMax, Params{"max": n})
+		return false
+	}
+
+	return true
+}
+
+func positiveRule(ctx context.Context, field string, v reflect.Value, arg string) bool {
+	return Positive(ctx, field, int(intValue(v)))
+}
+
+func trueRule(ctx context.Context, field string, v reflect.Value, arg string) bool {
+	return True(ctx, field, v.Bool())
+}
+
+// inRule in=a|b|c
+func inRule(ctx context.Context, field string, v reflect.Value, arg string) bool {
+	return IN(ctx, field, v.String(), strings.Split(arg, "|"))
+}
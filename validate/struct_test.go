@@ -0,0 +1,219 @@
+package validate
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type structTestAddress struct {
+	Address1 string `json:"address1" validate:"required,len=1..64"`
+	Postcode string `json:"postcode" validate:"number,len=4"`
+}
+
+type structTestPhone struct {
+	Number string `json:"number" validate:"phone"`
+}
+
+type structTestAudit struct {
+	CreatedBy string `json:"createdBy" validate:"uuid"`
+}
+
+type structTestPerson struct {
+	structTestAudit
+	Email    string             `json:"email" validate:"required,email,len=3..64"`
+	Username string             `json:"username,omitempty" validate:"username"`
+	Age      int                `json:"age" validate:"min=18,max=130"`
+	Role     string             `json:"role" validate:"in=admin|staff"`
+	Address  *structTestAddress `json:"address"`
+	Phones   []structTestPhone  `json:"phones"`
+	Ignored  string             `json:"ignored" validate:"-"`
+	NoTag    string
+	internal string
+}
+
+func TestStruct(t *testing.T) {
+	var tests = []struct {
+		Name   string
+		Value  structTestPerson
+		Fields []string
+	}{
+		{
+			Name:  "Valid",
+			Value: structTestPerson{Email: "jane@example.com", Age: 30, Role: "staff"},
+		},
+		{
+			Name:   "Required",
+			Value:  structTestPerson{},
+			Fields: []string{"client.email", "client.age"},
+		},
+		{
+			Name:   "Rules",
+			Value:  structTestPerson{Email: "jane", Username: "_jane", Age: 12, Role: "owner"},
+			Fields: []string{"client.email", "client.username", "client.age", "client.role"},
+		},
+		{
+			Name: "Nested",
+			Value: structTestPerson{
+				structTestAudit: structTestAudit{CreatedBy: "nope"},
+				Email:           "jane@example.com",
+				Age:             30,
+				Address:         &structTestAddress{Postcode: "12a"},
+				Phones:          []structTestPhone{{"0412345678"}, {"041"}},
+			},
+			Fields: []string{
+				"client.createdBy",
+				"client.address.address1",
+				"client.address.postcode",
+				"client.address.postcode",
+				"client.phones.1.number",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		ctx := SetContext(context.Background())
+
+		res := Struct(ctx, "client", &test.Value)
+		if res != (len(test.Fields) == 0) {
+			t.Errorf("%s: Expected valid %t, but was %t: %s", test.Name, len(test.Fields) == 0, res, ErrorsString(ctx))
+		}
+
+		errs := ListErrors(ctx)
+		if len(errs) != len(test.Fields) {
+			t.Errorf("%s: Expected %d errors, but had: %s", test.Name, len(test.Fields), ErrorsString(ctx))
+			continue
+		}
+
+		for i, e := range errs {
+			if e.Field != test.Fields[i] {
+				t.Errorf("%s: Expected error on '%s', but was '%s'", test.Name, test.Fields[i], e.Field)
+			}
+		}
+	}
+}
+
+func TestStructCodes(t *testing.T) {
+	ctx := SetContext(context.Background())
+
+	Struct(ctx, "", structTestPerson{Age: 200})
+
+	errs := ListErrors(ctx)
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 errors, but had: %s", ErrorsString(ctx))
+	}
+
+	if errs[0].Field != "email" || errs[0].Code != CodeRequired {
+		t.Errorf("Expected %s on email, but was %+v", CodeRequired, errs[0])
+	}
+
+	if errs[1].Field != "age" || errs[1].Code != CodeMax || errs[1].Params["max"] != 130 {
+		t.Errorf("Expected %s on age, but was %+v", CodeMax, errs[1])
+	}
+}
+
+func TestStructZeroValues(t *testing.T) {
+	type input struct {
+		Accepted bool    `json:"accepted" validate:"true"`
+		Age      int     `json:"age" validate:"min=18"`
+		Count    uint    `json:"count" validate:"max=10"`
+		Nickname *string `json:"nickname" validate:"len=2..16"`
+		Notes    string  `json:"notes" validate:"len=2..16"`
+	}
+
+	ctx := SetContext(context.Background())
+	Struct(ctx, "", input{})
+
+	errs := ListErrors(ctx)
+	if len(errs) != 2 || errs[0].Field != "accepted" || errs[1].Field != "age" {
+		t.Errorf("Expected errors on accepted and age only, but had: %s", ErrorsString(ctx))
+	}
+}
+
+func TestRegisterRule(t *testing.T) {
+	RegisterRule("even", func(ctx context.Context, field string, v reflect.Value, arg string) bool {
+		if intValue(v)%2 != 0 {
+			AddCodedError(ctx, field, CodeInvalid, nil)
+			return false
+		}
+		return true
+	})
+
+	type input struct {
+		Count int `json:"count" validate:"even"`
+	}
+
+	ctx := SetContext(context.Background())
+	if Struct(ctx, "", input{Count: 3}) {
+		t.Errorf("Expected odd count rejected")
+	}
+
+	if !Struct(SetContext(context.Background()), "", input{Count: 4}) {
+		t.Errorf("Expected even count accepted")
+	}
+}
+
+func TestStructBadTags(t *testing.T) {
+	type unknown struct {
+		Name string `json:"name" validate:"nonsense"`
+	}
+
+	type wrongType struct {
+		Count int `json:"count" validate:"email"`
+	}
+
+	type badArg struct {
+		Name string `json:"name" validate:"len=a..b"`
+	}
+
+	type nested struct {
+		Items []badArg `json:"items"`
+	}
+
+	type dynamic struct {
+		Value interface{} `json:"value" validate:"true"`
+	}
+
+	var tests = []struct {
+		Name  string
+		Value interface{}
+		Field string
+		Check bool
+	}{
+		{"Unknown rule", unknown{Name: "x"}, "name", true},
+		{"Wrong field type", wrongType{Count: 1}, "count", true},
+		{"Non-integer argument", badArg{Name: "x"}, "name", true},
+		{"Nested", nested{Items: []badArg{{Name: "x"}}}, "items.0.name", true},
+		{"Interface of the wrong type", dynamic{Value: "yes"}, "value", false},
+		{"Not a struct", "x", "", false},
+	}
+
+	for _, test := range tests {
+		if err := CheckTags(test.Value); (err != nil) != test.Check {
+			t.Errorf("%s: Expected tag error %t, but was %v", test.Name, test.Check, err)
+		}
+
+		// Twice, as tags are only parsed the first time:
+		for i := 0; i < 2; i++ {
+			ctx := SetContext(context.Background())
+			if Struct(ctx, "", test.Value) {
+				t.Errorf("%s: Expected bad tag to reject the value", test.Name)
+			}
+
+			errs := ListErrors(ctx)
+			if len(errs) != 1 || errs[0].Field != test.Field || errs[0].Code != CodeInvalid {
+				t.Errorf("%s: Expected %s on '%s', but had %+v", test.Name, CodeInvalid, test.Field, errs)
+			}
+		}
+	}
+
+	if err := CheckTags(&structTestPerson{}); err != nil {
+		t.Errorf("Expected valid tags, but had %s", err)
+	}
+
+	if !Struct(SetContext(context.Background()), "", struct {
+		Value interface{} `json:"value" validate:"true"`
+	}{true}) {
+		t.Errorf("Expected interface of the right type accepted")
+	}
+}
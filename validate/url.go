@@ -0,0 +1,129 @@
+package validate
+
+import (
+	"context"
+	"net"
+	"net/mail"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ValidHostname Returns true if v is a syntactically valid domain name for a
+// public host, e.g., www.example.com: dot separated labels of letters,
+// numbers and hyphens, not starting or ending with a hyphen, and a top level
+// domain of letters or punycode.  Letters may be from any language.  This
+// doesn't look up the domain, so it may not exist
+func ValidHostname(v string) bool {
+	v = strings.TrimSuffix(v, ".")
+	if len(v) == 0 || len(v) > 253 {
+		return false
+	}
+
+	labels := strings.Split(v, ".")
+	if len(labels) < 2 {
+		return false
+	}
+
+	for _, l := range labels {
+		if len(l) == 0 || len(l) > 63 || l[0] == '-' || l[len(l)-1] == '-' {
+			return false
+		}
+
+		for _, c := range l {
+			if c != '-' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+				return false
+			}
+		}
+	}
+
+	tld := labels[len(labels)-1]
+	if strings.HasPrefix(strings.ToLower(tld), "xn--") {
+		return true
+	}
+
+	if utf8.RuneCountInString(tld) < 2 {
+		return false
+	}
+
+	for _, c := range tld {
+		if !unicode.IsLetter(c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ValidURL Returns true if v is an http or https URL with a valid host name
+// or IP address, e.g., https://www.example.com/path.  The scheme may be left
+// out, e.g., www.example.com
+func ValidURL(v string) bool {
+	v = strings.TrimSpace(v)
+	if !strings.Contains(v, "://") {
+		v = "http://" + v
+	}
+
+	u, err := url.Parse(v)
+	if err != nil || u.Opaque != "" || u.User != nil {
+		return false
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+	default:
+		return false
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		return true
+	}
+
+	return ValidHostname(host)
+}
+
+// ValidEmail Returns true if v is an email address as defined in RFC 5322,
+// without a display name, e.g., jane.doe@example.com, and no longer than
+// RFC 5321 allows.  If checkDomain is true, the domain must also be a valid
+// public host name, as in ValidHostname, rather than anything RFC 5322
+// allows.  Nothing is looked up, so the domain may not exist or accept mail
+func ValidEmail(v string, checkDomain bool) bool {
+	if len(v) > 254 || strings.ContainsAny(v, "<>") {
+		return false
+	}
+
+	a, err := mail.ParseAddress(v)
+	if err != nil || len(a.Name) > 0 {
+		return false
+	}
+
+	at := strings.LastIndex(a.Address, "@")
+	local, domain := a.Address[:at], a.Address[at+1:]
+	if len(local) > 64 {
+		return false
+	}
+
+	if !checkDomain {
+		return true
+	}
+
+	// IP address literals, e.g., jane@[192.0.2.1]:
+	if strings.HasPrefix(domain, "[") && strings.HasSuffix(domain, "]") {
+		return net.ParseIP(strings.TrimPrefix(domain[1:len(domain)-1], "IPv6:")) != nil
+	}
+
+	return ValidHostname(domain)
+}
+
+// EmailWithDomain Checks that email address is valid, and its domain is a
+// valid public host name
+func EmailWithDomain(ctx context.Context, field string, email string) bool {
+	if !ValidEmail(email, true) {
+		AddCodedError(ctx, field, CodeEmail, Params{"value": email})
+		return false
+	}
+
+	return true
+}
@@ -2,37 +2,54 @@ package validate
 
 import (
 	"context"
-	"fmt"
 	"regexp"
-	"time"
+	"strings"
 
 	"github.com/gofrs/uuid"
-
-	"cloud.google.com/go/civil"
 )
 
 var numberRx = regexp.MustCompile(`^-?\d*$`)
-var emailRx = regexp.MustCompile(`^\S+@\S+$`)
 var lettersWithSpacesRx = regexp.MustCompile(`^[- 'a-zA-ZÀ-ÖØ-öø-ÿ]+$`)
 var lettersWithNumbersRx = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
 var usernameRx = regexp.MustCompile(`^[A-Za-z0-9]+(?:[_-][A-Za-z0-9]+)*$`)
 var lettersSpacesAndNumbersRx = regexp.MustCompile(`^[- 'a-zA-ZÀ-ÖØ-öø-ÿ0-9]+$`)
-var urlRx = regexp.MustCompile(`^(http:\/\/www\.|https:\/\/www\.|http:\/\/|https:\/\/)?[a-z0-9]+([\-\.]{1}[a-z0-9]+)*\.[a-z]{2,5}(:[0-9]{1,5})?(\/.*)?$`)
 var aTrueRx = regexp.MustCompile(`^true$`)
 
 // Regex Confirms that value matches the provided regex
 func Regex(ctx context.Context, rx *regexp.Regexp, field string, value string, message string) bool {
 	if !rx.MatchString(value) {
-		AddError(ctx, field, message)
+		addCustomError(ctx, field, CodePattern, message)
 		return false
 	}
 
 	return true
 }
 
-// Email Checks that email address is valid
+// regex Confirms that value matches rx, adding an error with the code if not
+func regex(ctx context.Context, rx *regexp.Regexp, field string, value string, code string, params Params) bool {
+	if !rx.MatchString(value) {
+		AddCodedError(ctx, field, code, params)
+		return false
+	}
+
+	return true
+}
+
+// addCustomError Adds an error with the caller's message, under a code
+// describing the check that failed
+func addCustomError(ctx context.Context, field string, code string, message string) {
+	addError(ctx, Error{Field: field, Message: message, Code: code})
+}
+
+// Email Checks that email address is valid, as defined in RFC 5322.  Use
+// EmailWithDomain to check the domain as well
 func Email(ctx context.Context, field string, email string) bool {
-	return Regex(ctx, emailRx, field, email, fmt.Sprintf("Email address '%s' is invalid", email))
+	if !ValidEmail(email, false) {
+		AddCodedError(ctx, field, CodeEmail, Params{"value": email})
+		return false
+	}
+
+	return true
 }
 
 // Fail Used for testing, always fails and adds the message
@@ -44,7 +61,7 @@ func Fail(ctx context.Context, field string, message string) bool {
 // NoError used when there's an error.  If there's an error, then it fails
 func NoError(ctx context.Context, err error, field string, message string) bool {
 	if err != nil {
-		AddError(ctx, field, message)
+		addCustomError(ctx, field, CodeInvalid, message)
 		return false
 	}
 
@@ -54,7 +71,7 @@ func NoError(ctx context.Context, err error, field string, message string) bool
 // False Checks that a value is true
 func False(ctx context.Context, field string, v bool, msg string) bool {
 	if v {
-		AddError(ctx, field, msg)
+		addCustomError(ctx, field, CodeInvalid, msg)
 	}
 
 	return !v
@@ -62,15 +79,12 @@ func False(ctx context.Context, field string, v bool, msg string) bool {
 
 // Length Requires the string to be a length between m and n inclusive
 func Length(ctx context.Context, field, v string, m int, n int) bool {
-	var msg string
-	if m == n {
-		msg = fmt.Sprintf("Must be exactly %d characters long", m)
-	} else {
-		msg = fmt.Sprintf("Must be between %d and %d characters long", m, n)
-	}
-
 	if len(v) < m || len(v) > n {
-		AddError(ctx, field, msg)
+		if m == n {
+			AddCodedError(ctx, field, CodeLengthExact, Params{"length": m})
+		} else {
+			AddCodedError(ctx, field, CodeLengthRange, Params{"min": m, "max": n})
+		}
 		return false
 	}
 
@@ -80,7 +94,7 @@ func Length(ctx context.Context, field, v string, m int, n int) bool {
 // MinimumLength Requires the minimum length for a string to be n characters
 func MinimumLength(ctx context.Context, n int, v string, field string) bool {
 	if len(v) < n {
-		AddError(ctx, field, fmt.Sprintf("Must be at least %d characters long", n))
+		AddCodedError(ctx, field, CodeLengthMin, Params{"min": n})
 		return false
 	}
 	return true
@@ -89,7 +103,7 @@ func MinimumLength(ctx context.Context, n int, v string, field string) bool {
 // StringsNotEqual Verifies that the two provided values are not equal
 func StringsNotEqual(ctx context.Context, field, a, b, msg string) bool {
 	if a == b {
-		AddError(ctx, field, msg)
+		addCustomError(ctx, field, CodeNotEqual, msg)
 		return false
 	}
 
@@ -101,7 +115,7 @@ func UUID(ctx context.Context, field, id string, msg string) bool {
 	_, err := uuid.FromString(id)
 
 	if err != nil {
-		AddError(ctx, field, msg)
+		addCustomError(ctx, field, CodeUUID, msg)
 		return false
 	}
 
@@ -110,18 +124,24 @@ func UUID(ctx context.Context, field, id string, msg string) bool {
 
 // Numbers Must be a string containing only numbers
 func Numbers(ctx context.Context, field string, v string) bool {
-	return !Regex(ctx, numberRx, field, v, "Must be a number")
+	return regex(ctx, numberRx, field, v, CodeNumber, nil)
 }
 
-// Phone Must be a string containing only numbers
+// Phone Must be a phone number in international format, e.g., +61 412 345
+// 678, or a string of 7 to 13 numbers.  Use PhoneInRegion to check numbers
+// against a region's rules
 func Phone(ctx context.Context, field string, v string) bool {
+	if strings.HasPrefix(strings.TrimSpace(v), "+") {
+		return PhoneInRegion(ctx, field, v, "")
+	}
+
 	return Numbers(ctx, field, v) && Length(ctx, field, v, 7, 13)
 }
 
 // Positive Checks that an integer is positive
 func Positive(ctx context.Context, field string, v int) bool {
 	if v < 0 {
-		AddError(ctx, field, "Must be positive")
+		AddCodedError(ctx, field, CodePositive, nil)
 		return false
 	}
 
@@ -130,65 +150,44 @@ func Positive(ctx context.Context, field string, v int) bool {
 
 // Username Username validation
 func Username(ctx context.Context, field string, v string) bool {
-	return !Regex(ctx, usernameRx, field, v, "Usernames can only contain letters, numbers, underscores and hyphens, and must not begin or end with an underscore or hyphen")
+	return regex(ctx, usernameRx, field, v, CodeUsername, nil)
 }
 
 // LettersWithSpaces Must only contain letters and spaces
 func LettersWithSpaces(ctx context.Context, field string, v string) bool {
-	return !Regex(ctx, lettersWithSpacesRx, field, v, "Must only contain letters and spaces")
+	return regex(ctx, lettersWithSpacesRx, field, v, CodeLettersSpaces, nil)
 }
 
 // LettersWithNumbers Must be a string containing only numbers
 func LettersWithNumbers(ctx context.Context, field string, v string) bool {
-	return !Regex(ctx, lettersWithNumbersRx, field, v, "Must only contain letters and numbers")
+	return regex(ctx, lettersWithNumbersRx, field, v, CodeLettersNumbers, nil)
 }
 
 // LettersSpacesAndNumbers Must be a string containing only numbers
 func LettersSpacesAndNumbers(ctx context.Context, field string, v string) bool {
-	return !Regex(ctx, lettersSpacesAndNumbersRx, field, v, "Must only contain letters, spaces and numbers")
+	return regex(ctx, lettersSpacesAndNumbersRx, field, v, CodeLettersSpacesNumbers, nil)
 }
 
-// URL Checks that URL is valid
+// URL Checks that URL is a valid http or https URL, with or without the
+// scheme
 func URL(ctx context.Context, field string, v string) bool {
-	return !Regex(ctx, urlRx, field, v, "Website URL is invalid")
+	if !ValidURL(v) {
+		AddCodedError(ctx, field, CodeURL, nil)
+		return false
+	}
+
+	return true
 }
 
 // True Checks that a value is true
 func True(ctx context.Context, field string, v bool) bool {
 	if !v {
-		AddError(ctx, field, fmt.Sprintf("Must be true"))
+		AddCodedError(ctx, field, CodeTrue, nil)
 	}
 
 	return v
 }
 
-// After Checks that a date value is after given date value to be compared with
-func After(ctx context.Context, field string, v civil.Date, dateToCompareWith civil.Date) bool {
-	if !v.After(dateToCompareWith) {
-		AddError(ctx, field, "Date should be after "+dateToCompareWith.String())
-		return false
-	}
-
-	return true
-}
-
-// AfterNow Checks that a date value is after now
-func AfterNow(ctx context.Context, field string, v civil.Date) bool {
-	now := civil.DateOf(time.Now().Add((time.Hour * -24)))
-	return After(ctx, field, v, now)
-}
-
-// DOB Checks that a date value is before 18 years from now
-func DOB(ctx context.Context, field string, v civil.Date) bool {
-	now := time.Now()
-	minAge := civil.Date{
-		Day:   (now.Year() - 18),
-		Month: now.Month(),
-		Year:  now.Day(),
-	}
-	return After(ctx, field, v, minAge)
-}
-
 // IN Checks that a value is an item within an array
 func IN(ctx context.Context, field string, v string, array []string) bool {
 	for _, element := range array {
@@ -197,14 +196,14 @@ func IN(ctx context.Context, field string, v string, array []string) bool {
 		}
 	}
 
-	AddError(ctx, field, "Value not allowed")
+	AddCodedError(ctx, field, CodeNotAllowed, nil)
 	return false
 }
 
 // IntsEqual Verifies that the two integers are equal
 func IntsEqual(ctx context.Context, field string, a, b int, msg string) bool {
 	if a != b {
-		AddError(ctx, field, msg)
+		addCustomError(ctx, field, CodeEqual, msg)
 		return false
 	}
 
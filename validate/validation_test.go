@@ -0,0 +1,76 @@
+package validate
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRegexValidators(t *testing.T) {
+	var tests = []struct {
+		Name      string
+		Validator func(context.Context, string, string) bool
+		Value     string
+		Accept    bool
+	}{
+		{"Numbers", Numbers, "12345", true},
+		{"Numbers", Numbers, "12a45", false},
+		{"Phone", Phone, "0412345678", true},
+		{"Phone", Phone, "04123", false},
+		{"Username", Username, "cool_cat", true},
+		{"Username", Username, "_coolcat", false},
+		{"LettersWithSpaces", LettersWithSpaces, "Anne-Marie O'Neil", true},
+		{"LettersWithSpaces", LettersWithSpaces, "R2D2", false},
+		{"LettersWithNumbers", LettersWithNumbers, "R2D2", true},
+		{"LettersWithNumbers", LettersWithNumbers, "R2 D2", false},
+		{"LettersSpacesAndNumbers", LettersSpacesAndNumbers, "R2 D2", true},
+		{"LettersSpacesAndNumbers", LettersSpacesAndNumbers, "R2-D2!", false},
+		{"URL", URL, "https://www.example.com/path", true},
+		{"URL", URL, "not a url", false},
+	}
+
+	for _, test := range tests {
+		ctx := SetContext(context.Background())
+
+		res := test.Validator(ctx, "field", test.Value)
+		if res != test.Accept {
+			t.Errorf("%s: Expected '%s' accepted %t, but was %t", test.Name, test.Value, test.Accept, res)
+		}
+
+		if HasErrors(ctx) == test.Accept {
+			t.Errorf("%s: Expected errors only when rejected for '%s': %s", test.Name, test.Value, ErrorsString(ctx))
+		}
+	}
+}
+
+// TestRegexValidatorsInRules Checks the validators' results can be used
+// directly, as they once returned the opposite of Regex
+func TestRegexValidatorsInRules(t *testing.T) {
+	var tests = []struct {
+		Name      string
+		Validator func(context.Context, string, string) bool
+		Valid     string
+		Invalid   string
+	}{
+		{"Numbers", Numbers, "12345", "12a45"},
+		{"Username", Username, "cool_cat", "_coolcat"},
+		{"LettersWithSpaces", LettersWithSpaces, "Anne Marie", "R2D2"},
+		{"LettersWithNumbers", LettersWithNumbers, "R2D2", "R2 D2"},
+		{"LettersSpacesAndNumbers", LettersSpacesAndNumbers, "R2 D2", "R2-D2!"},
+		{"URL", URL, "example.com", "not a url"},
+	}
+
+	for _, test := range tests {
+		for _, v := range []string{test.Valid, test.Invalid} {
+			value := v
+			validator := test.Validator
+
+			ok, err := NewRules().Check(func(ctx context.Context) bool {
+				return validator(ctx, "field", value)
+			}).Validate(SetContext(context.Background()))
+
+			if err != nil || ok != (v == test.Valid) {
+				t.Errorf("%s: Expected '%s' valid %t, but was %t with error %v", test.Name, v, v == test.Valid, ok, err)
+			}
+		}
+	}
+}
@@ -1,4 +1,26 @@
 package vars
 
-// SharedData Name of value in context that holds OPA related data
-const SharedData = "defaultSharedData"
+// ContextKey Type of the keys spawn uses for values in context, so that they
+// can't collide with keys set by other packages
+type ContextKey string
+
+const (
+	// SharedData Name of value in context that holds OPA related data
+	SharedData = ContextKey("defaultSharedData")
+	// UserKey Context key for the authenticated user
+	UserKey = ContextKey("user")
+	// ActorKey Context key for the real user behind an impersonated user
+	ActorKey = ContextKey("actor")
+	// SessionKey Context key for the current session
+	SessionKey = ContextKey("session")
+	// ScopesKey Context key for the scopes of the API key used
+	ScopesKey = ContextKey("scopes")
+	// CreatedByKey Context key for the ID of the user making changes
+	CreatedByKey = ContextKey("created_by")
+	// ValidationErrors Context key for the validation errors of a request
+	ValidationErrors = ContextKey("validationErrors")
+	// LocaleKey Context key for the locale validation messages are given in
+	LocaleKey = ContextKey("locale")
+	// TimezoneKey Context key for the user's timezone, used for today's date
+	TimezoneKey = ContextKey("timezone")
+)